@@ -1,6 +1,9 @@
 package api
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -29,7 +32,14 @@ func init() {
 		flushPointHandler(router)
 		flushOperateHandler(router)
 		flushMonitorHandler(router)
-		err := router.Run(fmt.Sprintf(":%d", global.Config.Port))
+		flushChannelHandler(router)
+		flushLifecycleHandler(router)
+		flushControlHandler(router)
+		flushInterlockHandler(router)
+		flushJobHandler(router)
+		flushSceneHandler(router)
+		flushValueMapHandler(router)
+		err := serve(router)
 		if err != nil {
 			global.SystemLog.Errorf("start http server err:%s", err.Error())
 			os.Exit(1)
@@ -37,6 +47,29 @@ func init() {
 	}()
 }
 
+// 配置了apiTlsCert时使用https，配置了apiClientCa时校验客户端提供的证书
+func serve(router *gin.Engine) error {
+	addr := fmt.Sprintf(":%d", global.Config.Port)
+	if global.Config.ApiTlsCert == "" {
+		return router.Run(addr)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if global.Config.ApiClientCa != "" {
+		pem, err := os.ReadFile(global.Config.ApiClientCa)
+		if err != nil {
+			return fmt.Errorf("read api client ca err: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in " + global.Config.ApiClientCa)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	server := &http.Server{Addr: addr, Handler: router, TLSConfig: cfg}
+	return server.ListenAndServeTLS(global.Config.ApiTlsCert, global.Config.ApiTlsKey)
+}
+
 func homeHandler(context *gin.Context) {
 	context.HTML(http.StatusOK, "home.html", gin.H{
 		"title": "哨兵",
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"sentinels/model"
+	"sentinels/store"
+	"sentinels/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+func flushChannelHandler(router *gin.Engine) {
+	router.GET("/api/devices/:id/channels", selectChannelsHandler)
+	router.GET("/api/devices/:id/channel-events", channelEventsHandler)
+	router.POST("/api/channels", saveChannelHandler)
+	router.PUT("/api/channels/:id", saveChannelHandler)
+	router.DELETE("/api/channels/:id", deleteChannelHandler)
+}
+
+// 查询设备的备用通道
+func selectChannelsHandler(context *gin.Context) {
+	channels, err := store.DbClient.SelectChannelsByDeviceId(context.Param("id"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, channels)
+}
+
+// 查询设备最近的通道切换记录，设备未运行时为空
+func channelEventsHandler(context *gin.Context) {
+	gtp, ok := task.GTP.Get(context.Param("id"))
+	if !ok {
+		context.JSON(http.StatusOK, []*model.ChannelEvent{})
+		return
+	}
+	context.JSON(http.StatusOK, gtp.ChannelEvents())
+}
+
+// 新增或修改备用通道，重新加载设备后生效
+func saveChannelHandler(context *gin.Context) {
+	var channel model.Channel
+	if err := context.ShouldBindJSON(&channel); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id := context.Param("id"); id != "" {
+		channel.ID = id
+	}
+	if channel.DeviceId == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "缺少deviceId字段"})
+		return
+	}
+	if _, err := store.DbClient.SelectDeviceById(channel.DeviceId); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := store.DbClient.SaveChannel(&channel)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 删除备用通道
+func deleteChannelHandler(context *gin.Context) {
+	err := store.DbClient.DeleteChannel(context.Param("id"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
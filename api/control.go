@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/hex"
+	"net/http"
+	"sentinels/catch"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"sentinels/task"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func flushControlHandler(router *gin.Engine) {
+	router.POST("/api/control", controlHandler)
+	router.GET("/api/control/audits", auditsHandler)
+	router.POST("/api/control/select", selectHandler)
+	router.POST("/api/control/execute", executeHandler)
+	router.POST("/api/control/cancel", cancelHandler)
+	router.GET("/api/control/selections", selectionsHandler)
+}
+
+// 请求方取已校验的客户端证书主题，没有证书时为客户端地址，不接受请求中填写的请求方
+func requesterOf(context *gin.Context) string {
+	state := context.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return context.ClientIP()
+	}
+	return state.VerifiedChains[0][0].Subject.String()
+}
+
+// 已校验的客户端证书中的角色，没有证书或没有角色扩展时为空
+func clientRole(context *gin.Context) string {
+	state := context.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	role, _, err := catch.CertRole(state.VerifiedChains[0][0])
+	if err != nil {
+		global.SystemLog.Warnf("client %s certificate role err:%s", context.ClientIP(), err.Error())
+		return ""
+	}
+	return role
+}
+
+// controlRequest 下发控制的请求
+type controlRequest struct {
+	UniqueIdentifier string              `json:"uniqueIdentifier"` //唯一标识，重试时保持不变，为空时自动生成
+	DeviceId         string              `json:"deviceId"`         //设备id
+	Table            string              `json:"table"`            //设备标志，设备id为空时使用
+	ReplySize        int                 `json:"replySize"`        //重试次数
+	ValidityPeriod   int64               `json:"validityPeriod"`   //过期时间，毫秒时间戳，0时为10秒后
+	Bypass           string              `json:"bypass"`           //旁路联锁的原因，只有客户端证书的角色在bypassRoles中时可以旁路
+	Cmd              *command.OperateCmd `json:"cmd"`
+}
+
+// 下发控制
+func controlHandler(context *gin.Context) {
+	var req controlRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var opt *command.ControlCarrier
+	if req.DeviceId != "" {
+		opt = command.NewCarrierByDevId(req.DeviceId)
+	} else {
+		opt = command.NewCarrierByTableFlag(req.Table)
+	}
+	if strings.TrimSpace(req.UniqueIdentifier) != "" {
+		opt.FlushUniqueIdentifier(req.UniqueIdentifier)
+	}
+	opt.FlushRequester(requesterOf(context)).FlushBypass(req.Bypass).FlushRole(clientRole(context))
+	opt.ReplySize = req.ReplySize
+	if req.ValidityPeriod > 0 {
+		opt.ValidityPeriod = req.ValidityPeriod
+	}
+	if req.Cmd != nil {
+		opt.Cmd = req.Cmd
+	}
+	resp, err := task.GTP.Exec(opt)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"uniqueIdentifier": opt.UniqueIdentifier(), "error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"uniqueIdentifier": opt.UniqueIdentifier(),
+		"response":         hex.EncodeToString(resp),
+		"time":             time.Now().UnixMilli(),
+	})
+}
+
+// 查询控制审计记录
+func auditsHandler(context *gin.Context) {
+	var query model.AuditQuery
+	if err := context.ShouldBindQuery(&query); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	total, audits, err := store.DbClient.SelectControlAudits(&query)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, &model.AuditResponse{
+		TotalCount: total,
+		Page:       query.Page,
+		PageSize:   len(audits),
+		Audits:     audits,
+	})
+}
+
+// selectRequest 选择后执行的请求
+type selectRequest struct {
+	DeviceId string  `json:"deviceId"`
+	Tag      string  `json:"tag"`
+	Value    float64 `json:"value"`   //工程值
+	Timeout  int     `json:"timeout"` //等待执行的时间，秒，0为默认值
+	Token    string  `json:"token"`   //执行与取消时填写
+}
+
+// 选择点位
+func selectHandler(context *gin.Context) {
+	var req selectRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sel, err := task.GTP.Select(req.DeviceId, req.Tag, req.Value, requesterOf(context), time.Duration(req.Timeout)*time.Second)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, sel)
+}
+
+// 执行选择
+func executeHandler(context *gin.Context) {
+	var req selectRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := task.GTP.Execute(req.Token, requesterOf(context))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"response": hex.EncodeToString(resp), "time": time.Now().UnixMilli()})
+}
+
+// 取消选择
+func cancelHandler(context *gin.Context) {
+	var req selectRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := task.GTP.Cancel(req.Token, requesterOf(context))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 所有没有超时的选择
+func selectionsHandler(context *gin.Context) {
+	context.JSON(http.StatusOK, task.GTP.Selections())
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"sentinels/store"
+	"sentinels/task"
 )
 
 func flushDeviceHandler(router *gin.Engine) {
@@ -87,6 +88,12 @@ func statusDeviceHandler(context *gin.Context) {
 		context.JSON(http.StatusBadRequest, gin.H{"error": "更新切入切出失败"})
 		return
 	}
+	//切入的设备开始采集，切出的设备停止采集
+	err = task.GTP.ReloadDevice(deviceID)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	context.JSON(http.StatusOK, nil)
 }
 
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"sentinels/model"
+	"sentinels/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func flushInterlockHandler(router *gin.Engine) {
+	router.GET("/api/interlocks", selectInterlocksHandler)
+	router.POST("/api/interlocks", saveInterlockHandler)
+	router.PUT("/api/interlocks/:id", saveInterlockHandler)
+	router.DELETE("/api/interlocks/:id", deleteInterlockHandler)
+}
+
+// 查询联锁规则，deviceId为空时查询所有
+func selectInterlocksHandler(context *gin.Context) {
+	interlocks, err := store.DbClient.SelectInterlocks(context.Query("deviceId"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, interlocks)
+}
+
+// 新增或修改联锁规则，下一次控制时生效
+func saveInterlockHandler(context *gin.Context) {
+	var interlock model.Interlock
+	if err := context.ShouldBindJSON(&interlock); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id := context.Param("id"); id != "" {
+		interlock.ID = id
+	}
+	if interlock.DeviceId == "" || interlock.Expression == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "缺少deviceId或expression字段"})
+		return
+	}
+	err := store.DbClient.SaveInterlock(&interlock)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 删除联锁规则
+func deleteInterlockHandler(context *gin.Context) {
+	err := store.DbClient.DeleteInterlock(context.Param("id"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
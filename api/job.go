@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"sentinels/task"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func flushJobHandler(router *gin.Engine) {
+	router.GET("/api/jobs", selectJobsHandler)
+	router.POST("/api/jobs", saveJobHandler)
+	router.PUT("/api/jobs/:id", saveJobHandler)
+	router.DELETE("/api/jobs/:id", deleteJobHandler)
+	router.PUT("/api/jobs/:id/enable", enableJobHandler(true))
+	router.PUT("/api/jobs/:id/disable", enableJobHandler(false))
+	router.GET("/api/jobs/:id/history", jobHistoryHandler)
+}
+
+// 查询所有定时任务
+func selectJobsHandler(context *gin.Context) {
+	jobs, err := store.DbClient.SelectJobs()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, jobs)
+}
+
+// 新增或修改定时任务，保存后重新计算下次执行时间
+func saveJobHandler(context *gin.Context) {
+	var job model.ControlJob
+	if err := context.ShouldBindJSON(&job); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id := context.Param("id"); id != "" {
+		job.ID = id
+	}
+	if err := task.ValidateJob(&job); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	job.NextRun = 0
+	if job.Kind == global.JobOnce {
+		//修改单次任务后重新执行
+		job.LastRun = 0
+	}
+	if err := store.DbClient.SaveJob(&job); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := task.GTP.ReloadJobs(); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 删除定时任务与执行记录
+func deleteJobHandler(context *gin.Context) {
+	if err := store.DbClient.DeleteJob(context.Param("id")); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := task.GTP.ReloadJobs(); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 启用或停用定时任务
+func enableJobHandler(enabled bool) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		job, err := store.DbClient.SelectJobById(context.Param("id"))
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		job.Enabled = enabled
+		job.NextRun = 0
+		if err = store.DbClient.SaveJob(job); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err = task.GTP.ReloadJobs(); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		context.JSON(http.StatusOK, nil)
+	}
+}
+
+// 定时任务最近的执行记录，limit默认50
+func jobHistoryHandler(context *gin.Context) {
+	limit, _ := strconv.Atoi(context.DefaultQuery("limit", "50"))
+	if limit <= 0 {
+		limit = 50
+	}
+	runs, err := task.GTP.JobRuns(context.Param("id"), limit)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"sentinels/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+func flushLifecycleHandler(router *gin.Engine) {
+	router.GET("/api/devices/:id/lifecycle", lifecycleHandler)
+	router.GET("/api/system/events", eventsHandler)
+}
+
+// 设备当前的生命周期状态与最近的变化
+func lifecycleHandler(context *gin.Context) {
+	gtp, ok := task.GTP.Get(context.Param("id"))
+	if !ok {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "设备未运行"})
+		return
+	}
+	context.JSON(http.StatusOK, gtp.Lifecycle())
+}
+
+// 以SSE推送所有设备的生命周期事件
+func eventsHandler(context *gin.Context) {
+	events, cancel := task.GTP.Subscribe(0)
+	defer cancel()
+	context.Stream(func(w io.Writer) bool {
+		select {
+		case <-context.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			context.SSEvent("lifecycle", event)
+			return true
+		}
+	})
+}
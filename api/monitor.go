@@ -1,12 +1,13 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
 	"sentinels/global"
 	"sentinels/model"
+	"sentinels/snap"
+	"sentinels/task"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,23 +15,52 @@ import (
 func flushMonitorHandler(router *gin.Engine) {
 	router.POST("/api/system/monitor", monitorHandler)
 	router.GET("/api/system/monitor", alarmsHandler)
+	router.GET("/api/devices/:id/schedule", scheduleHandler)
+	router.POST("/api/devices/:id/read", readPointsHandler)
+	router.GET("/api/devices/:id/realtime", realtimeHandler)
+	router.GET("/api/devices/:id/read-plan", readPlanHandler)
+	router.GET("/api/lua/errors", luaErrorsHandler)
 }
 
+// 所有运行中设备的状态，包括当前使用的通道
 func monitorHandler(context *gin.Context) {
-	var ms []*model.DeviceMonitor
-	for index := 0; index < 10; index++ {
-		dm := model.DeviceMonitor{
-			ID:                    index,
-			Name:                  fmt.Sprintf("test%d", index),
-			Code:                  fmt.Sprintf("test%d", index),
-			TotalPoints:           239,
-			CurrentAlarmCount:     index,
-			Status:                "在线",
-			LastCommunicationTime: time.Now(),
-		}
-		ms = append(ms, &dm)
+	context.JSON(http.StatusOK, task.GTP.Monitor())
+}
+
+// 设备各采集组的调度情况，包括采集间隔与超时次数
+func scheduleHandler(context *gin.Context) {
+	gtp, ok := task.GTP.Get(context.Param("id"))
+	if !ok {
+		context.JSON(http.StatusOK, []*model.GroupSchedule{})
+		return
+	}
+	context.JSON(http.StatusOK, gtp.Schedule())
+}
+
+// 立即抄读指定点位
+func readPointsHandler(context *gin.Context) {
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	values, err := task.GTP.ReadPoints(context.Param("id"), req.Tags)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	context.JSON(http.StatusOK, ms)
+	context.JSON(http.StatusOK, values)
+}
+
+// 点位的实时值，tags以逗号分隔，为空时返回所有点位
+func realtimeHandler(context *gin.Context) {
+	var tags []string
+	if query := strings.TrimSpace(context.Query("tags")); query != "" {
+		tags = strings.Split(query, ",")
+	}
+	context.JSON(http.StatusOK, task.GTP.Realtime(context.Param("id"), tags...))
 }
 
 func alarmsHandler(context *gin.Context) {
@@ -49,3 +79,18 @@ func alarmsHandler(context *gin.Context) {
 	}
 	context.JSON(http.StatusOK, result)
 }
+
+// modbus设备的读取计划，按数据库中的配置生成
+func readPlanHandler(context *gin.Context) {
+	plan, err := task.GTP.ReadPlan(context.Param("id"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, plan)
+}
+
+// 当前执行失败的点位lua表达式，deviceId为空时查询所有设备
+func luaErrorsHandler(context *gin.Context) {
+	context.JSON(http.StatusOK, snap.LuaErrors(context.Query("deviceId")))
+}
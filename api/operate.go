@@ -1,29 +1,121 @@
 package api
 
 import (
+	"errors"
+	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"sentinels/global"
+	"sentinels/task"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func flushOperateHandler(router *gin.Engine) {
 	router.POST("/api/system/pause", pauseHandler)
+	router.POST("/api/system/resume", resumeHandler)
+	router.GET("/api/system/pause", pauseStateHandler)
+	router.POST("/api/devices/:id/pause", pauseDeviceHandler)
+	router.POST("/api/devices/:id/resume", resumeDeviceHandler)
 	router.POST("/api/system/flush", flushHandler)
 	router.POST("/api/data/clear", clearHandler)
 	router.POST("/api/config/import", importHandler)
 	router.GET("/api/config/template", templateHandler)
 }
 
+// pauseRequest 暂停参数，请求体为空时一直暂停
+type pauseRequest struct {
+	Duration int    `json:"duration"` //暂停时长，秒，0为不自动恢复
+	Reason   string `json:"reason"`
+	Persist  bool   `json:"persist"` //重启后保持暂停
+}
+
+func bindPause(context *gin.Context) (*pauseRequest, error) {
+	req := &pauseRequest{}
+	if context.Request.ContentLength == 0 {
+		return req, nil
+	}
+	err := context.ShouldBindJSON(req)
+	if errors.Is(err, io.EOF) {
+		return req, nil
+	}
+	return req, err
+}
+
+// 暂停所有设备的采集，连接保持，控制不受影响
 func pauseHandler(context *gin.Context) {
 	global.SystemLog.Debug("暂停数据采集和监控")
+	req, err := bindPause(context)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = task.GTP.Pause(time.Duration(req.Duration)*time.Second, req.Reason, req.Persist)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 全局的暂停状态
+func pauseStateHandler(context *gin.Context) {
+	context.JSON(http.StatusOK, task.GTP.PauseState())
+}
+
+func resumeHandler(context *gin.Context) {
+	global.SystemLog.Debug("恢复数据采集和监控")
+	err := task.GTP.Resume()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 暂停单个设备的采集
+func pauseDeviceHandler(context *gin.Context) {
+	gtp, ok := task.GTP.Get(context.Param("id"))
+	if !ok {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "设备未运行"})
+		return
+	}
+	req, err := bindPause(context)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = gtp.Pause(time.Duration(req.Duration)*time.Second, req.Reason, req.Persist)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+func resumeDeviceHandler(context *gin.Context) {
+	gtp, ok := task.GTP.Get(context.Param("id"))
+	if !ok {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "设备未运行"})
+		return
+	}
+	err := gtp.Resume()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	context.JSON(http.StatusOK, nil)
 }
 
+// 刷新采集控制配置，只重新加载发生变化的设备
 func flushHandler(context *gin.Context) {
 	global.SystemLog.Debug("刷新采集控制配置")
+	err := task.GTP.Reload()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	context.JSON(http.StatusOK, nil)
 }
 
@@ -32,6 +124,7 @@ func clearHandler(context *gin.Context) {
 	context.JSON(http.StatusOK, nil)
 }
 
+// 导入按模板填写的值映射与点位，值映射先于点位导入，点位的值映射列引用映射的ID或名称
 func importHandler(context *gin.Context) {
 	global.SystemLog.Debug("导入已经配置好的配置文件")
 	file, err := context.FormFile("file")
@@ -48,33 +141,24 @@ func importHandler(context *gin.Context) {
 		})
 		return
 	}
-	dst := "./uploads/" + file.Filename
-	if err := context.SaveUploadedFile(file, dst); err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{
-			"error": "文件保存失败: " + err.Error(),
-		})
+	src, err := file.Open()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	context.JSON(http.StatusOK, nil)
+	defer src.Close()
+	imported, err := importWorkbook(src)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, imported)
 }
 
+// 下载导入模板，模板缺少点位、值映射表或列时补齐
 func templateHandler(context *gin.Context) {
 	global.SystemLog.Debug("下载导入模板文件")
-	if _, err := os.Stat(global.TemplatePath); os.IsNotExist(err) {
-		context.JSON(http.StatusNotFound, gin.H{
-			"error": "模板文件不存在",
-		})
-		return
-	}
-	// 设置响应头，告诉浏览器这是要下载的文件
-	context.Header("Content-Description", "File Transfer")
-	context.Header("Content-Disposition", "attachment; filename="+filepath.Base(global.TemplatePath))
-	context.Header("Content-Type", "application/octet-stream")
-	context.Header("Content-Transfer-Encoding", "binary")
-	context.Header("Expires", "0")
-	context.Header("Cache-Control", "must-revalidate")
-	context.Header("Pragma", "public")
-
-	// 发送文件
-	context.File(global.TemplatePath)
+	f := openTemplate()
+	defer f.Close()
+	writeWorkbook(context, f, filepath.Base(global.TemplatePath))
 }
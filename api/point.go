@@ -1,10 +1,13 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"sentinels/global"
 	"sentinels/model"
+	"sentinels/snap"
 	"sentinels/store"
+	"sentinels/task"
 	"strconv"
 	"strings"
 
@@ -62,6 +65,7 @@ func deletePointHandler(context *gin.Context) {
 		})
 		return
 	}
+	snap.ForgetLua(deviceID)
 	context.JSON(http.StatusOK, nil)
 }
 
@@ -85,33 +89,64 @@ func savePointsHandler(context *gin.Context) {
 		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if strings.TrimSpace(point.DeviceID) == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "deviceId is empty"})
+	if err := validatePoint(&point); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := store.DbClient.SavePoint(&point)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 检查点位所属设备与地址、数据类型、lua表达式，保存与导入时使用
+func validatePoint(point *model.Point) error {
+	if strings.TrimSpace(point.DeviceID) == "" {
+		return errors.New("deviceId is empty")
+	}
 	device, err := store.DbClient.SelectDeviceById(point.DeviceID)
 	if err != nil || device == nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": "device not exist"})
-		return
+		return errors.New("device not exist")
 	}
 	if device.ProtocolType == global.ModbusRTU {
-		_, err = strconv.ParseUint(point.Address, 0, 16)
-		if err != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
+		if _, err = strconv.ParseUint(point.Address, 0, 16); err != nil {
+			return err
 		}
-		_, err = strconv.ParseUint(point.FunctionCode, 0, 8)
-		if err != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
+		if _, err = strconv.ParseUint(point.FunctionCode, 0, 8); err != nil {
+			return err
 		}
 	}
-	err = store.DbClient.SavePoint(&point)
-	if err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	if device.ProtocolType == global.ModbusTCP || device.ProtocolType == global.ModbusRTU {
+		if err = task.CheckPointWidth(device, point); err != nil {
+			return err
+		}
 	}
-	context.JSON(http.StatusOK, nil)
+	if device.ProtocolType == global.CanRaw || device.ProtocolType == global.CANopen {
+		_, _, _, isObject, pe := snap.ParseCanAddress(point.Address)
+		if pe != nil {
+			return pe
+		}
+		if isObject && device.ProtocolType != global.CANopen {
+			return errors.New("index:subindex address needs protocol " + global.CANopen)
+		}
+		if _, pe = snap.CanDataSize(point.DataType); pe != nil {
+			return pe
+		}
+	}
+	if device.ProtocolType == global.Virtual && strings.TrimSpace(point.LuaExpression) == "" {
+		return errors.New("virtual point needs lua expression")
+	}
+	for _, expr := range []string{point.LuaExpression, point.InverseLua} {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		if err = snap.CompileLua(expr); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func collectRulesHandler(context *gin.Context) {
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"sentinels/model"
+	"sentinels/store"
+	"sentinels/task"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func flushSceneHandler(router *gin.Engine) {
+	router.GET("/api/scenes", selectScenesHandler)
+	router.POST("/api/scenes", saveSceneHandler)
+	router.PUT("/api/scenes/:id", saveSceneHandler)
+	router.DELETE("/api/scenes/:id", deleteSceneHandler)
+	router.POST("/api/scenes/:id/run", runSceneHandler)
+	router.GET("/api/scenes/:id/runs", sceneRunsHandler)
+	router.GET("/api/scene-runs/:runId", sceneRunHandler)
+	router.POST("/api/scene-runs/:runId/abort", abortSceneHandler)
+	router.GET("/api/scene-runs/events", sceneEventsHandler)
+}
+
+// 查询所有场景
+func selectScenesHandler(context *gin.Context) {
+	scenes, err := store.DbClient.SelectScenes()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, scenes)
+}
+
+// 新增或修改场景
+func saveSceneHandler(context *gin.Context) {
+	var scene model.Scene
+	if err := context.ShouldBindJSON(&scene); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id := context.Param("id"); id != "" {
+		scene.ID = id
+	}
+	if err := task.ValidateScene(&scene); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.DbClient.SaveScene(&scene); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 删除场景与执行记录
+func deleteSceneHandler(context *gin.Context) {
+	if err := store.DbClient.DeleteScene(context.Param("id")); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 开始执行场景，立即返回执行记录
+func runSceneHandler(context *gin.Context) {
+	run, err := task.GTP.RunScene(context.Param("id"), requesterOf(context))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, run)
+}
+
+// 场景最近的执行记录，limit默认20
+func sceneRunsHandler(context *gin.Context) {
+	limit, _ := strconv.Atoi(context.DefaultQuery("limit", "20"))
+	if limit <= 0 {
+		limit = 20
+	}
+	runs, err := store.DbClient.SelectSceneRuns(context.Param("id"), limit)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, runs)
+}
+
+// 一次执行的状态与每个步骤的结果
+func sceneRunHandler(context *gin.Context) {
+	runId, err := strconv.ParseUint(context.Param("runId"), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "runId错误"})
+		return
+	}
+	run, steps, err := task.GTP.SceneRunDetail(uint(runId))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"run": run, "steps": steps})
+}
+
+// 中止正在执行的场景
+func abortSceneHandler(context *gin.Context) {
+	runId, err := strconv.ParseUint(context.Param("runId"), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "runId错误"})
+		return
+	}
+	if err = task.GTP.AbortScene(uint(runId)); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 以SSE推送所有场景的执行进度
+func sceneEventsHandler(context *gin.Context) {
+	events, cancel := task.GTP.SubscribeScenes(0)
+	defer cancel()
+	context.Stream(func(w io.Writer) bool {
+		select {
+		case <-context.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			context.SSEvent("scene", event)
+			return true
+		}
+	})
+}
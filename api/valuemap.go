@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"path/filepath"
+	"sentinels/model"
+	"sentinels/store"
+	"sentinels/task"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+func flushValueMapHandler(router *gin.Engine) {
+	router.GET("/api/value-maps", selectValueMapsHandler)
+	router.POST("/api/value-maps", saveValueMapHandler)
+	router.PUT("/api/value-maps/:id", saveValueMapHandler)
+	router.DELETE("/api/value-maps/:id", deleteValueMapHandler)
+	router.GET("/api/value-maps/export", exportValueMapsHandler)
+	router.POST("/api/value-maps/import", importValueMapsHandler)
+}
+
+func selectValueMapsHandler(context *gin.Context) {
+	maps, err := store.DbClient.SelectValueMaps()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, maps)
+}
+
+// 新增或修改值映射，重新加载后生效
+func saveValueMapHandler(context *gin.Context) {
+	var m model.ValueMap
+	if err := context.ShouldBindJSON(&m); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if id := context.Param("id"); id != "" {
+		m.ID = id
+	}
+	if err := task.ValidateValueMap(&m); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.DbClient.SaveValueMap(&m); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, m)
+}
+
+// 删除值映射，仍有点位使用时返回错误
+func deleteValueMapHandler(context *gin.Context) {
+	err := store.DbClient.DeleteValueMap(context.Param("id"))
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, nil)
+}
+
+// 导出所有值映射到导入模板的值映射表
+func exportValueMapsHandler(context *gin.Context) {
+	maps, err := store.DbClient.SelectValueMaps()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f := openTemplate()
+	defer f.Close()
+	if err = writeValueMaps(f, maps); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	writeWorkbook(context, f, "value-maps.xlsx")
+}
+
+// 从导入模板导入值映射，有ID时保留ID，没有ID时按名称新增或覆盖，任意一行错误时不导入
+func importValueMapsHandler(context *gin.Context) {
+	file, err := context.FormFile("file")
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "无法获取上传文件: " + err.Error()})
+		return
+	}
+	if ext := filepath.Ext(file.Filename); ext != ".xlsx" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文件类型: " + ext})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer src.Close()
+	f, err := excelize.OpenReader(src)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	maps, _, err := readValueMaps(f)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, m := range maps {
+		if err = store.DbClient.SaveValueMap(m); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	context.JSON(http.StatusOK, gin.H{"imported": len(maps)})
+}
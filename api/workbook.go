@@ -0,0 +1,318 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"sentinels/task"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// 导入模板中的工作表
+const (
+	pointSheet    = "点位"
+	valueMapSheet = "值映射"
+)
+
+// pointColumn 点位表的一列，表头与点位字段的转换
+type pointColumn struct {
+	title string
+	set   func(p *model.Point, v string) error
+}
+
+func textColumn(title string, field func(p *model.Point) *string) pointColumn {
+	return pointColumn{title: title, set: func(p *model.Point, v string) error { *field(p) = v; return nil }}
+}
+
+func intColumn(title string, field func(p *model.Point) *int) pointColumn {
+	return pointColumn{title: title, set: func(p *model.Point, v string) (err error) {
+		if v == "" {
+			*field(p) = 0
+			return nil
+		}
+		*field(p), err = strconv.Atoi(v)
+		return err
+	}}
+}
+
+func floatColumn(title string, field func(p *model.Point) *float64) pointColumn {
+	return pointColumn{title: title, set: func(p *model.Point, v string) (err error) {
+		if v == "" {
+			*field(p) = 0
+			return nil
+		}
+		*field(p), err = strconv.ParseFloat(v, 64)
+		return err
+	}}
+}
+
+func boolColumn(title string, field func(p *model.Point) *bool) pointColumn {
+	return pointColumn{title: title, set: func(p *model.Point, v string) error {
+		switch strings.ToLower(v) {
+		case "", "0", "false", "否":
+			*field(p) = false
+		case "1", "true", "是":
+			*field(p) = true
+		default:
+			return fmt.Errorf("invalid bool %s", v)
+		}
+		return nil
+	}}
+}
+
+// 点位表的列，值映射列填写映射的ID或名称
+var pointColumns = []pointColumn{
+	textColumn("ID", func(p *model.Point) *string { return &p.ID }),
+	textColumn("设备ID", func(p *model.Point) *string { return &p.DeviceID }),
+	textColumn("标签", func(p *model.Point) *string { return &p.Tag }),
+	textColumn("功能码", func(p *model.Point) *string { return &p.FunctionCode }),
+	textColumn("地址", func(p *model.Point) *string { return &p.Address }),
+	textColumn("数据类型", func(p *model.Point) *string { return &p.DataType }),
+	textColumn("字节序", func(p *model.Point) *string { return &p.Endianness }),
+	intColumn("长度", func(p *model.Point) *int { return &p.Length }),
+	textColumn("编码", func(p *model.Point) *string { return &p.Encoding }),
+	boolColumn("去空格", func(p *model.Point) *bool { return &p.Trim }),
+	textColumn("位计算", func(p *model.Point) *string { return &p.BitCalculation }),
+	intColumn("起始bit", func(p *model.Point) *int { return &p.StartBit }),
+	intColumn("结束bit", func(p *model.Point) *int { return &p.EndBit }),
+	floatColumn("倍率", func(p *model.Point) *float64 { return &p.Multiplier }),
+	floatColumn("偏移量", func(p *model.Point) *float64 { return &p.Offset }),
+	textColumn("lua表达式", func(p *model.Point) *string { return &p.LuaExpression }),
+	textColumn("反向lua表达式", func(p *model.Point) *string { return &p.InverseLua }),
+	textColumn("单位", func(p *model.Point) *string { return &p.Unit }),
+	textColumn("描述", func(p *model.Point) *string { return &p.Description }),
+	intColumn("采集间隔", func(p *model.Point) *int { return &p.Interval }),
+	intColumn("入库间隔", func(p *model.Point) *int { return &p.Store }),
+	boolColumn("需要选择", func(p *model.Point) *bool { return &p.Sbo }),
+	textColumn(valueMapSheet, func(p *model.Point) *string { return &p.ValueMap }),
+}
+
+var valueMapTitles = []string{"ID", "名称", "类型", "映射", "默认文字"}
+
+// 打开导入模板，模板文件不存在或无法读取时新建，缺少的工作表与列补齐表头
+func openTemplate() *excelize.File {
+	f, err := excelize.OpenFile(global.TemplatePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			global.SystemLog.Warnf("template %s can not be read, use built-in layout: %s", global.TemplatePath, err.Error())
+		}
+		f = excelize.NewFile()
+		f.SetSheetName(f.GetSheetName(0), pointSheet)
+	}
+	titles := make([]string, 0, len(pointColumns))
+	for _, c := range pointColumns {
+		titles = append(titles, c.title)
+	}
+	ensureTitles(f, pointSheet, titles)
+	ensureTitles(f, valueMapSheet, valueMapTitles)
+	return f
+}
+
+// 以xlsx附件返回工作簿
+func writeWorkbook(context *gin.Context, f *excelize.File, name string) {
+	context.Header("Content-Disposition", "attachment; filename="+name)
+	context.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	if err := f.Write(context.Writer); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// 工作表不存在时创建，表头缺少的列追加到最后
+func ensureTitles(f *excelize.File, sheet string, titles []string) {
+	if idx, _ := f.GetSheetIndex(sheet); idx < 0 {
+		_, _ = f.NewSheet(sheet)
+	}
+	rows, _ := f.GetRows(sheet)
+	var header []string
+	if len(rows) > 0 {
+		header = rows[0]
+	}
+	for _, title := range titles {
+		if slices.Contains(header, title) {
+			continue
+		}
+		cell, _ := excelize.CoordinatesToCellName(len(header)+1, 1)
+		_ = f.SetCellStr(sheet, cell, title)
+		header = append(header, title)
+	}
+}
+
+// 按表头读取工作表，返回每行以表头为key的值与行号，空行跳过
+func sheetRecords(f *excelize.File, sheet string) ([]map[string]string, []int, error) {
+	rows, err := f.GetRows(sheet)
+	if err != nil || len(rows) == 0 {
+		return nil, nil, err
+	}
+	header := rows[0]
+	var records []map[string]string
+	var lines []int
+	for i, row := range rows[1:] {
+		record := make(map[string]string, len(header))
+		empty := true
+		for j, title := range header {
+			if j < len(row) {
+				record[strings.TrimSpace(title)] = strings.TrimSpace(row[j])
+				empty = empty && strings.TrimSpace(row[j]) == ""
+			}
+		}
+		if !empty {
+			records = append(records, record)
+			lines = append(lines, i+2)
+		}
+	}
+	return records, lines, nil
+}
+
+// 按表头写入一行
+func writeRecord(f *excelize.File, sheet string, line int, record map[string]interface{}) error {
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return err
+	}
+	for j, title := range rows[0] {
+		value, ok := record[strings.TrimSpace(title)]
+		if !ok {
+			continue
+		}
+		cell, _ := excelize.CoordinatesToCellName(j+1, line)
+		if err = f.SetCellValue(sheet, cell, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 把值映射写入模板的值映射表
+func writeValueMaps(f *excelize.File, maps []*model.ValueMap) error {
+	for i, m := range maps {
+		record := map[string]interface{}{"ID": m.ID, "名称": m.Name, "类型": m.Kind, "映射": m.Entries, "默认文字": m.Default}
+		if err := writeRecord(f, valueMapSheet, i+2, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 读取值映射表，有ID的行保留ID，没有ID的行按名称覆盖已有的映射或使用新的ID
+// 返回表中的ID与名称对应的映射ID，点位表按ID或名称引用
+func readValueMaps(f *excelize.File) ([]*model.ValueMap, map[string]string, error) {
+	records, lines, err := sheetRecords(f, valueMapSheet)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := time.Now().UnixNano()
+	var maps []*model.ValueMap
+	refs := make(map[string]string)
+	for i, r := range records {
+		m := &model.ValueMap{ID: r["ID"], Name: r["名称"], Kind: r["类型"], Entries: r["映射"], Default: r["默认文字"]}
+		if err = task.ValidateValueMap(m); err != nil {
+			return nil, nil, fmt.Errorf("%s第%d行: %w", valueMapSheet, lines[i], err)
+		}
+		if old, oe := store.DbClient.SelectValueMapByName(m.Name); oe == nil && old != nil {
+			if m.ID == "" {
+				m.ID = old.ID
+			} else if m.ID != old.ID {
+				return nil, nil, fmt.Errorf("%s第%d行: 名称%s已被映射%s使用", valueMapSheet, lines[i], m.Name, old.ID)
+			}
+		}
+		if m.ID == "" {
+			m.ID = strconv.FormatInt(base+int64(i), 10)
+		}
+		refs[m.ID] = m.ID
+		refs[m.Name] = m.ID
+		maps = append(maps, m)
+	}
+	return maps, refs, nil
+}
+
+// 点位引用的值映射，可以是表中或已有映射的ID、名称
+func resolveValueMap(ref string, refs map[string]string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	if id, ok := refs[ref]; ok {
+		return id, nil
+	}
+	maps, err := store.DbClient.SelectValueMaps()
+	if err != nil {
+		return "", err
+	}
+	for _, m := range maps {
+		if m.ID == ref || m.Name == ref {
+			return m.ID, nil
+		}
+	}
+	return "", fmt.Errorf("value map %s not found", ref)
+}
+
+// 读取点位表，ID为空时按设备与标签覆盖已有的点位或使用新的ID
+func readPoints(f *excelize.File, refs map[string]string) ([]*model.Point, error) {
+	records, lines, err := sheetRecords(f, pointSheet)
+	if err != nil {
+		return nil, err
+	}
+	base := time.Now().UnixNano()
+	var points []*model.Point
+	for i, r := range records {
+		p := &model.Point{}
+		for _, c := range pointColumns {
+			if err = c.set(p, r[c.title]); err != nil {
+				return nil, fmt.Errorf("%s第%d行%s: %w", pointSheet, lines[i], c.title, err)
+			}
+		}
+		if p.ValueMap, err = resolveValueMap(p.ValueMap, refs); err != nil {
+			return nil, fmt.Errorf("%s第%d行: %w", pointSheet, lines[i], err)
+		}
+		if err = validatePoint(p); err != nil {
+			return nil, fmt.Errorf("%s第%d行: %w", pointSheet, lines[i], err)
+		}
+		if p.ID == "" {
+			if old, oe := store.DbClient.SelectPointByTag(p.DeviceID, p.Tag); oe == nil && old != nil {
+				p.ID = old.ID
+			} else {
+				p.ID = strconv.FormatInt(base+int64(i), 10)
+			}
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// 导入模板中的值映射与点位，点位的值映射列引用表中或已有的映射，任意一行错误时都不导入
+func importWorkbook(src io.Reader) (map[string]int, error) {
+	f, err := excelize.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	maps, refs, err := readValueMaps(f)
+	if err != nil {
+		return nil, err
+	}
+	points, err := readPoints(f, refs)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range maps {
+		if err = store.DbClient.SaveValueMap(m); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range points {
+		if err = store.DbClient.SavePoint(p); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]int{"valueMaps": len(maps), "points": len(points)}, nil
+}
@@ -0,0 +1,370 @@
+package catch
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/protocol"
+	"sentinels/snap"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Connector = (*CanClient)(nil)
+
+func init() {
+	ConnectorBuilder[global.Can] = func(device *model.Device) Connector {
+		return &CanClient{
+			ConnSyllable: &ConnSyllable{Device: device},
+		}
+	}
+}
+
+// canFilter CAN接收过滤，(id & mask) == (filterId & mask)时接收
+type canFilter struct {
+	id       uint32
+	mask     uint32
+	extended bool //扩展帧，只接收29位id的帧，否则只接收标准帧
+}
+
+// 解析过滤配置，id[/mask]以逗号分隔，没有mask时精确匹配
+// id大于0x7FF或写成超过3位的十六进制（例如0x00000123）时为扩展帧，与candump相同
+func parseCanFilters(conf string) ([]canFilter, error) {
+	var filters []canFilter
+	for _, item := range strings.Split(conf, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idStr, maskStr, hasMask := strings.Cut(item, "/")
+		id, err := strconv.ParseUint(strings.TrimSpace(idStr), 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid can filter %s: %w", item, err)
+		}
+		mask := uint64(0x1FFFFFFF)
+		if id <= 0x7FF {
+			mask = 0x7FF
+		}
+		if hasMask {
+			mask, err = strconv.ParseUint(strings.TrimSpace(maskStr), 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid can filter %s: %w", item, err)
+			}
+		}
+		digits := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(idStr)), "0x")
+		extended := id > 0x7FF || len(digits) > 3
+		if extended && !hasMask {
+			mask = 0x1FFFFFFF
+		}
+		filters = append(filters, canFilter{id: uint32(id), mask: uint32(mask), extended: extended})
+	}
+	return filters, nil
+}
+
+// CanClient SocketCAN连接器，Address为接口名，例如can0、vcan0
+type CanClient struct {
+	*ConnSyllable
+	conn    io.ReadWriteCloser
+	reader  *bufio.Reader
+	ctx     context.Context
+	cancel  context.CancelFunc
+	lock    sync.Mutex
+	sdoLock sync.Mutex //同一节点的SDO不能并发
+
+	transfer  sync.Map //等待回复的请求
+	listeners sync.Map //被动接收的点位，map[key]snap.PointSnap
+
+	heartbeatLock sync.Mutex
+	lastHeartbeat time.Time
+	nmtState      byte
+}
+
+func (c *CanClient) Open() error {
+	filters, err := parseCanFilters(c.CanFilter)
+	var conn io.ReadWriteCloser
+	if err == nil {
+		conn, err = openCanSocket(strings.TrimSpace(c.Address), filters)
+	}
+	if err != nil {
+		if c.fc != nil {
+			c.fc(c.Device, err)
+		}
+		return err
+	}
+	reader := bufio.NewReaderSize(conn, 16*64)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.listeners.Range(func(key, _ any) bool {
+		c.listeners.Delete(key)
+		return true
+	})
+	c.heartbeatLock.Lock()
+	c.lastHeartbeat = time.Now()
+	c.heartbeatLock.Unlock()
+	c.lock.Lock()
+	c.conn, c.reader, c.ctx, c.cancel = conn, reader, ctx, cancel
+	c.lock.Unlock()
+	c.flushLinkedFlag(true)
+	//读取协程只使用本次打开的连接，重新打开后不会读取或关闭新的连接
+	go func() {
+		_, re := c.read(ctx, reader)
+		if errors.Is(re, io.EOF) {
+			_ = c.closeConn(conn, DisConnectedError)
+		}
+	}()
+	if guard, ok := c.pc.(protocol.NodeGuard); ok {
+		//启动节点
+		err = c.Write(guard.StartFrame())
+		if err != nil {
+			c.logger.Errorf("nmt start err:%s", err.Error())
+		}
+		if c.Heartbeat > 0 {
+			go c.superviseHeartbeat(ctx, conn)
+		}
+	}
+	return nil
+}
+
+func (c *CanClient) Close() error {
+	c.lock.Lock()
+	conn := c.conn
+	c.lock.Unlock()
+	return c.closeConn(conn, DisConnectedError)
+}
+
+// 关闭指定的连接并通过失败回调通知断开的原因，所有断开都经过这里，已经关闭或被重新打开时不处理
+func (c *CanClient) closeConn(conn io.ReadWriteCloser, reason error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if conn == nil || c.conn != conn {
+		return nil
+	}
+	c.cancel()
+	err := c.conn.Close()
+	c.conn = nil
+	c.flushUnlinked(reason)
+	return err
+}
+
+func (c *CanClient) Type() string {
+	return global.Can
+}
+
+func (c *CanClient) Flush() error {
+	return nil
+}
+
+func (c *CanClient) Write(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		return DisConnectedError
+	}
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *CanClient) WriteByTimeout(_ time.Duration, data []byte) error {
+	//SocketCAN的发送不会长时间阻塞
+	return c.Write(data)
+}
+
+func (c *CanClient) Read() ([]byte, error) {
+	c.lock.Lock()
+	ctx, reader := c.ctx, c.reader
+	c.lock.Unlock()
+	if ctx == nil {
+		return nil, DisConnectedError
+	}
+	return c.read(ctx, reader)
+}
+
+// 读取并分发收到的帧，直到ctx结束或连接断开
+func (c *CanClient) read(ctx context.Context, reader *bufio.Reader) ([]byte, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+			frame, resp, err := c.pc.Decode(reader)
+			if err != nil {
+				if errors.Is(err, protocol.CanErrorFrame) {
+					c.logger.Warnf("received can error frame")
+					continue
+				}
+				return nil, io.EOF
+			}
+			c.logger.Debugf("received -> %s", frame)
+			key := c.pc.Key()
+			if guard, ok := c.pc.(protocol.NodeGuard); ok {
+				if state, isHeartbeat := guard.Heartbeat(key, resp); isHeartbeat {
+					c.onHeartbeat(guard, state)
+					continue
+				}
+			}
+			sch, ok := c.transfer.Load(key)
+			if ok {
+				if s, flag := sch.(*model.SCH); flag {
+					s.Set(append([]byte(nil), resp...))
+				}
+				continue
+			}
+			ps, ok := c.listeners.Load(key)
+			if !ok {
+				continue
+			}
+			point := ps.(snap.PointSnap)
+			err = c.parse(resp, point)
+			if err != nil && c.cps != nil {
+				c.cps(c.Device, point, err)
+			}
+		}
+	}
+}
+
+func (c *CanClient) onHeartbeat(guard protocol.NodeGuard, state byte) {
+	c.heartbeatLock.Lock()
+	c.lastHeartbeat = time.Now()
+	changed := c.nmtState != state
+	c.nmtState = state
+	c.heartbeatLock.Unlock()
+	if changed {
+		c.logger.Infof("nmt state -> 0x%02x", state)
+	}
+	if state == protocol.NmtBootUp {
+		//节点重启后需要重新启动
+		err := c.Write(guard.StartFrame())
+		if err != nil {
+			c.logger.Errorf("nmt start err:%s", err.Error())
+		}
+	}
+}
+
+// 心跳超时视为断开连接，与其他断开一样关闭连接并调用失败回调
+func (c *CanClient) superviseHeartbeat(ctx context.Context, conn io.ReadWriteCloser) {
+	timeout := time.Duration(c.Heartbeat) * time.Millisecond
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.heartbeatLock.Lock()
+			last := c.lastHeartbeat
+			c.heartbeatLock.Unlock()
+			if time.Since(last) > timeout {
+				c.logger.Errorf("heartbeat timeout, last:%s", last.Format(time.DateTime))
+				_ = c.closeConn(conn, fmt.Errorf("%w: heartbeat timeout", DisConnectedError))
+				return
+			}
+		}
+	}
+}
+
+func (c *CanClient) ReadByTimeout(_ time.Duration) ([]byte, error) {
+	return nil, errors.New("can frames are dispatched by key, use SendAndWaitForReplyByTimeOut")
+}
+
+func (c *CanClient) SendAndWaitForReply(key string, data []byte) ([]byte, error) {
+	return c.SendAndWaitForReplyByTimeOut(key, data, c.readTimeout())
+}
+
+// 等待应答的时间，与串口、TCP相同使用设备的readTimeout（秒），未配置时为默认值
+func (c *CanClient) readTimeout() time.Duration {
+	if c.ReadTimeout > 0 {
+		return time.Duration(c.ReadTimeout) * time.Second
+	}
+	return global.DefaultTimeout
+}
+
+func (c *CanClient) SendAndWaitForReplyByTimeOut(key string, data []byte, timeout time.Duration) ([]byte, error) {
+	c.logger.Debugf("send -> %s", hex.EncodeToString(data))
+	if key == "" {
+		//没有应答的报文
+		return nil, c.Write(data)
+	}
+	sch := model.NewSCH(timeout)
+	defer c.transfer.Delete(key)
+	defer sch.Close()
+	c.transfer.Store(key, sch)
+	err := c.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = sch.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return sch.GetBytes()
+}
+
+// 完成一次可能包含多帧的传输
+func (c *CanClient) transact(pc protocol.ProtoConvener, key string, frame []byte, timeout time.Duration) ([]byte, error) {
+	seg, ok := pc.(protocol.Segmented)
+	if !ok || key == "" {
+		return c.SendAndWaitForReplyByTimeOut(key, frame, timeout)
+	}
+	c.sdoLock.Lock()
+	defer c.sdoLock.Unlock()
+	var result []byte
+	for frame != nil {
+		resp, err := c.SendAndWaitForReplyByTimeOut(key, frame, timeout)
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		frame, data, err = seg.Segment(frame, resp)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data...)
+	}
+	return result, nil
+}
+
+func (c *CanClient) Collect(key string, data []byte, point snap.PointSnap) error {
+	if len(data) == 0 {
+		//被动接收的点位只需要登记
+		c.listeners.Store(key, point)
+		return nil
+	}
+	resp, err := c.transact(c.pc.Copy(), key, data, c.readTimeout())
+	if err != nil {
+		return err
+	}
+	return c.parse(resp, point)
+}
+
+func (c *CanClient) parse(resp []byte, point snap.PointSnap) error {
+	if len(resp) == 0 {
+		return errors.New("empty response")
+	}
+	result, err := point.Parse(resp)
+	if err != nil {
+		return err
+	}
+	c.swap(c.Device, result, time.Now().UnixMilli())
+	return nil
+}
+
+func (c *CanClient) Operate(opt *command.OperateCmd) ([]byte, error) {
+	pc := c.pc.Copy()
+	key, frame, err := pc.Opt(opt)
+	if err != nil {
+		return nil, err
+	}
+	opt.FlushFrame(frame)
+	timeout := c.readTimeout()
+	if opt.Timeout > 0 {
+		timeout = time.Duration(opt.Timeout) * time.Millisecond
+	}
+	return c.transact(pc, key, frame, timeout)
+}
@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package catch
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// linux/can/raw.h
+const canRawFilter = 1
+
+// 打开SocketCAN原始套接字，每次读写一个struct can_frame
+func openCanSocket(name string, filters []canFilter) (io.ReadWriteCloser, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("can interface %s: %w", name, err)
+	}
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.CAN_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("can socket: %w", err)
+	}
+	if len(filters) > 0 {
+		cfs := make([]unix.CanFilter, 0, len(filters))
+		for _, f := range filters {
+			//掩码带上扩展帧标志，标准帧与扩展帧的过滤互不匹配
+			cf := unix.CanFilter{Id: f.id, Mask: f.mask | unix.CAN_EFF_FLAG}
+			if f.extended {
+				cf.Id |= unix.CAN_EFF_FLAG
+			}
+			cfs = append(cfs, cf)
+		}
+		err = unix.SetsockoptCanRawFilter(fd, unix.SOL_CAN_RAW, canRawFilter, cfs)
+		if err != nil {
+			_ = unix.Close(fd)
+			return nil, fmt.Errorf("can filter: %w", err)
+		}
+	}
+	err = unix.Bind(fd, &unix.SockaddrCAN{Ifindex: ifi.Index})
+	if err == nil {
+		//交给runtime的poller，关闭时可以打断阻塞的读取
+		err = unix.SetNonblock(fd, true)
+	}
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("can bind %s: %w", name, err)
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package catch
+
+import (
+	"errors"
+	"io"
+)
+
+func openCanSocket(_ string, _ []canFilter) (io.ReadWriteCloser, error) {
+	return nil, errors.New("socketcan is only supported on linux")
+}
@@ -0,0 +1,45 @@
+package catch
+
+import (
+	"sentinels/global"
+	"sentinels/model"
+	"testing"
+	"time"
+)
+
+func TestParseCanFilters(t *testing.T) {
+	filters, err := parseCanFilters("0x181, 0x700/0x780, 0x18FF50E5, 0x00000123, 0x1ABCDE00/0x1FFFFF00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []canFilter{
+		{id: 0x181, mask: 0x7FF},
+		{id: 0x700, mask: 0x780},
+		{id: 0x18FF50E5, mask: 0x1FFFFFFF, extended: true},
+		{id: 0x123, mask: 0x1FFFFFFF, extended: true},
+		{id: 0x1ABCDE00, mask: 0x1FFFFF00, extended: true},
+	}
+	if len(filters) != len(want) {
+		t.Fatalf("got %d filters, want %d", len(filters), len(want))
+	}
+	for i := range want {
+		if filters[i] != want[i] {
+			t.Errorf("filter %d: got %+v, want %+v", i, filters[i], want[i])
+		}
+	}
+	if _, err = parseCanFilters("0x1g"); err == nil {
+		t.Error("expected error for invalid id")
+	}
+}
+
+func TestCanReadTimeout(t *testing.T) {
+	for _, c := range []struct {
+		seconds int
+		want    time.Duration
+	}{{0, global.DefaultTimeout}, {-1, global.DefaultTimeout}, {3, 3 * time.Second}} {
+		client := &CanClient{ConnSyllable: &ConnSyllable{Device: &model.Device{ReadTimeout: c.seconds}}}
+		if got := client.readTimeout(); got != c.want {
+			t.Errorf("readTimeout %d: got %v, want %v", c.seconds, got, c.want)
+		}
+	}
+}
@@ -95,6 +95,16 @@ func (c *ConnSyllable) flushLinkedFlag(flag bool) {
 	c.isLinked = flag
 }
 
+// 连接断开，失败回调中带上断开的原因
+func (c *ConnSyllable) flushUnlinked(reason error) {
+	c.linkedLock.Lock()
+	defer c.linkedLock.Unlock()
+	if c.fc != nil {
+		c.fc(c.Device, reason)
+	}
+	c.isLinked = false
+}
+
 func (c *ConnSyllable) IsLinked() bool {
 	c.linkedLock.Lock()
 	defer c.linkedLock.Unlock()
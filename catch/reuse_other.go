@@ -0,0 +1,17 @@
+//go:build !windows
+
+package catch
+
+import "syscall"
+
+// 设置 SO_REUSEADDR
+func reuseAddrControl(_, _ string, c syscall.RawConn) error {
+	var err error
+	ce := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if ce != nil {
+		return ce
+	}
+	return err
+}
@@ -0,0 +1,32 @@
+package catch
+
+import (
+	"sentinels/global"
+	"sentinels/model"
+)
+
+var _ Connector = (*RS232Client)(nil)
+
+func init() {
+	ConnectorBuilder[global.RS232] = func(device *model.Device) Connector {
+		return &RS232Client{
+			serialSyllable: &serialSyllable{
+				ConnSyllable: &ConnSyllable{Device: device},
+				failSize:     6,
+			},
+		}
+	}
+}
+
+// RS232Client RS232的连接器，支持RTS/CTS与XON/XOFF流控
+type RS232Client struct {
+	*serialSyllable
+}
+
+func (R *RS232Client) Open() error {
+	return R.open(R.options())
+}
+
+func (R *RS232Client) Type() string {
+	return global.RS232
+}
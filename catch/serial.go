@@ -0,0 +1,320 @@
+package catch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/snap"
+	"strings"
+	"sync"
+	"time"
+)
+
+var serialTimeoutError = errors.New("serial read timeout")
+
+// 帧间静默的下限，usb转串口存在调度延时，过小会把一帧拆成多段
+const minSilence = 10 * time.Millisecond
+
+// serialOptions 打开串口的参数
+type serialOptions struct {
+	name        string
+	baud        int
+	dataBits    int
+	stopBits    int
+	parity      string
+	flowControl string
+	readTimeout time.Duration
+	rs485       *rs485Options //为空时不设置内核485模式
+}
+
+// rs485Options 内核TIOCSRS485参数
+type rs485Options struct {
+	rtsOnSend   bool
+	delayBefore time.Duration
+	delayAfter  time.Duration
+}
+
+// serialPort 不同平台的串口实现
+type serialPort interface {
+	io.ReadWriteCloser
+	Flush() error                                              //清空收发缓冲区
+	Drain() error                                              //等待发送缓冲区中的数据全部发出
+	SetRTS(on bool) error                                      //设置RTS电平
+	ReadTimeout(p []byte, timeout time.Duration) (int, error)  //带超时的读取
+	WriteTimeout(p []byte, timeout time.Duration) (int, error) //带超时的发送，流控时对端长时间未就绪返回超时
+}
+
+// serialSyllable 串口类连接器的公共部分
+type serialSyllable struct {
+	*ConnSyllable
+	failSize  int
+	failNum   int
+	conn      serialPort
+	lock      sync.Mutex
+	reader    *bufio.Reader
+	manualRts bool //发送时手动翻转RTS
+}
+
+func (s *serialSyllable) options() *serialOptions {
+	opts := &serialOptions{
+		name:        s.Address,
+		baud:        s.BaudRate,
+		dataBits:    s.DataBits,
+		stopBits:    s.StopBits,
+		parity:      s.Parity,
+		flowControl: strings.TrimSpace(s.FlowControl),
+		readTimeout: global.DefaultTimeout,
+	}
+	if s.ReadTimeout > 0 {
+		opts.readTimeout = time.Duration(s.ReadTimeout) * time.Second
+	}
+	return opts
+}
+
+func (s *serialSyllable) open(opts *serialOptions) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	port, err := openSerialPort(opts)
+	if err != nil {
+		if s.fc != nil {
+			s.fc(s.Device, err)
+		}
+		return err
+	}
+	s.conn = port
+	s.reader = bufio.NewReader(s.conn)
+	if s.manualRts {
+		//空闲时处于接收状态
+		_ = s.conn.SetRTS(s.RtsInvert)
+	}
+	s.flushLinkedFlag(true)
+	return nil
+}
+
+func (s *serialSyllable) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	s.reader = nil
+	s.flushLinkedFlag(false)
+	return err
+}
+
+func (s *serialSyllable) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return DisConnectedError
+	}
+	return s.conn.Flush()
+}
+
+func (s *serialSyllable) Write(data []byte) error {
+	return s.WriteByTimeout(0, data)
+}
+
+// WriteByTimeout 持有锁同步发送，timeout不大于0时使用设备的writeTimeout，超时后返回serialTimeoutError
+func (s *serialSyllable) WriteByTimeout(timeout time.Duration, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return DisConnectedError
+	}
+	return s.write(data, timeout)
+}
+
+// 清空缓冲区后发送，需要持有锁
+func (s *serialSyllable) write(data []byte, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = global.DefaultTimeout
+		if s.WriteTimeout > 0 {
+			timeout = time.Duration(s.WriteTimeout) * time.Second
+		}
+	}
+	err := s.conn.Flush()
+	if err != nil {
+		return err
+	}
+	if s.reader != nil {
+		s.reader.Reset(s.conn)
+	}
+	if !s.manualRts {
+		_, err = s.conn.WriteTimeout(data, timeout)
+		return err
+	}
+	//切换到发送状态
+	err = s.conn.SetRTS(!s.RtsInvert)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = s.conn.SetRTS(s.RtsInvert)
+	}()
+	if s.RtsDelayBefore > 0 {
+		time.Sleep(time.Duration(s.RtsDelayBefore) * time.Millisecond)
+	}
+	_, err = s.conn.WriteTimeout(data, timeout)
+	if err != nil {
+		return err
+	}
+	//最后一个字节离开移位寄存器后才能切回接收
+	err = s.conn.Drain()
+	if s.RtsDelayAfter > 0 {
+		time.Sleep(time.Duration(s.RtsDelayAfter) * time.Millisecond)
+	}
+	return err
+}
+
+func (s *serialSyllable) Read() ([]byte, error) {
+	frame, result, err := s.pc.Decode(s.reader)
+	if err == nil {
+		s.logger.Debugf("received -> %s", frame)
+	}
+	return result, err
+}
+
+// ReadByTimeout 持有锁读取一帧，在timeout内等待首字节，之后以帧间静默作为一帧的结束
+func (s *serialSyllable) ReadByTimeout(timeout time.Duration) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil, DisConnectedError
+	}
+	return s.readByTimeout(timeout)
+}
+
+// 读取一帧，需要持有锁
+func (s *serialSyllable) readByTimeout(timeout time.Duration) ([]byte, error) {
+	var frame []byte
+	//先取出缓冲中残留的数据
+	if s.reader != nil && s.reader.Buffered() > 0 {
+		frame, _ = s.reader.Peek(s.reader.Buffered())
+		frame = append([]byte(nil), frame...)
+		_, _ = s.reader.Discard(len(frame))
+	}
+	buf := make([]byte, 256)
+	silence := s.silence()
+	wait := timeout
+	if len(frame) > 0 {
+		wait = silence
+	}
+	for {
+		n, err := s.conn.ReadTimeout(buf, wait)
+		if n > 0 {
+			frame = append(frame, buf[:n]...)
+			wait = silence
+			continue
+		}
+		if errors.Is(err, serialTimeoutError) && len(frame) > 0 {
+			return frame, nil
+		}
+		if err == nil {
+			err = serialTimeoutError
+		}
+		return nil, err
+	}
+}
+
+// 计算3.5个字符的静默时间，波特率高于19200时固定为1.75ms
+func (s *serialSyllable) silence() time.Duration {
+	if s.BaudRate <= 0 {
+		return minSilence
+	}
+	t := 1750 * time.Microsecond
+	if s.BaudRate <= 19200 {
+		t = time.Duration(math.Ceil(3.5*11*1e6/float64(s.BaudRate))) * time.Microsecond
+	}
+	if t < minSilence {
+		t = minSilence
+	}
+	return t
+}
+
+func (s *serialSyllable) SendAndWaitForReply(key string, data []byte) ([]byte, error) {
+	return s.SendAndWaitForReplyByTimeOut(key, data, 0)
+}
+
+func (s *serialSyllable) SendAndWaitForReplyByTimeOut(_ string, data []byte, timeout time.Duration) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil, DisConnectedError
+	}
+	if timeout <= 0 {
+		timeout = s.options().readTimeout
+	}
+	s.logger.Debugf("send -> %s", hex.EncodeToString(data))
+	err := s.write(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.readByTimeout(timeout + s.calculateTimeout(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	frame, result, err := s.pc.Decode(bufio.NewReader(bytes.NewReader(resp)))
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Debugf("received -> %s", frame)
+	return result, nil
+}
+
+// 计算报文在线路上的传输时间
+func (s *serialSyllable) calculateTimeout(length int) time.Duration {
+	if s.BaudRate <= 0 {
+		return 0
+	}
+	totalBits := length * 10
+	transmissionTime := float64(totalBits) / float64(s.BaudRate)
+	return time.Duration(math.Ceil(transmissionTime*1000)) * time.Millisecond
+}
+
+func (s *serialSyllable) Collect(key string, data []byte, point snap.PointSnap) error {
+	resp, err := s.SendAndWaitForReplyByTimeOut(key, data, 0)
+	if err != nil {
+		return err
+	}
+	return s.parse(resp, point)
+}
+
+func (s *serialSyllable) parse(resp []byte, point snap.PointSnap) error {
+	if resp == nil || len(resp) == 0 {
+		return errors.New("empty response")
+	}
+	result, err := point.Parse(resp)
+	if err != nil {
+		return err
+	}
+	s.swap(s.Device, result, time.Now().UnixMilli())
+	return nil
+}
+
+func (s *serialSyllable) Operate(opt *command.OperateCmd) ([]byte, error) {
+	key, frame, err := s.pc.Opt(opt)
+	if err != nil {
+		return nil, err
+	}
+	opt.FlushFrame(frame)
+	var timeout time.Duration
+	if opt.Timeout > 0 {
+		timeout = time.Duration(opt.Timeout) * time.Millisecond
+	}
+	result, err := s.SendAndWaitForReplyByTimeOut(key, frame, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, errors.New("empty response")
+	}
+	return result, s.pc.CheckResp(frame, result)
+}
@@ -0,0 +1,251 @@
+//go:build linux
+// +build linux
+
+package catch
+
+import (
+	"errors"
+	"fmt"
+	"sentinels/global"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// linux/serial.h，ioctl编号随架构不同，使用unix.TIOCSRS485
+const (
+	serRS485Enabled      = 1 << 0
+	serRS485RtsOnSend    = 1 << 1
+	serRS485RtsAfterSend = 1 << 2
+)
+
+// serialRS485 对应内核的struct serial_rs485
+type serialRS485 struct {
+	flags              uint32
+	delayRtsBeforeSend uint32
+	delayRtsAfterSend  uint32
+	padding            [5]uint32
+}
+
+var baudRates = map[int]uint32{
+	1200:    unix.B1200,
+	2400:    unix.B2400,
+	4800:    unix.B4800,
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	2000000: unix.B2000000,
+}
+
+var dataBitsSnap = map[int]uint32{
+	5: unix.CS5,
+	6: unix.CS6,
+	7: unix.CS7,
+	8: unix.CS8,
+}
+
+// linuxSerialPort 基于termios的串口，可以控制流控与RTS
+type linuxSerialPort struct {
+	fd          int
+	readTimeout time.Duration
+}
+
+func openSerialPort(opts *serialOptions) (serialPort, error) {
+	fd, err := unix.Open(opts.name, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", opts.name, err)
+	}
+	port := &linuxSerialPort{fd: fd, readTimeout: opts.readTimeout}
+	err = port.configure(opts)
+	if err == nil && opts.rs485 != nil {
+		err = port.enableRS485(opts.rs485)
+	}
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	return port, nil
+}
+
+func (l *linuxSerialPort) configure(opts *serialOptions) error {
+	rate, ok := baudRates[opts.baud]
+	if !ok {
+		return fmt.Errorf("unsupported baud rate: %d", opts.baud)
+	}
+	if opts.dataBits == 0 {
+		opts.dataBits = 8
+	}
+	size, ok := dataBitsSnap[opts.dataBits]
+	if !ok {
+		return fmt.Errorf("unsupported data bits: %d", opts.dataBits)
+	}
+	t, err := unix.IoctlGetTermios(l.fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	//raw模式
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CBAUD | unix.CSIZE | unix.PARENB | unix.PARODD | unix.CMSPAR | unix.CSTOPB | unix.CRTSCTS
+	t.Cflag |= unix.CREAD | unix.CLOCAL | size | rate
+	t.Ispeed = rate
+	t.Ospeed = rate
+	switch strings.ToUpper(strings.TrimSpace(opts.parity)) {
+	case "", "N":
+	case "O":
+		t.Cflag |= unix.PARENB | unix.PARODD
+		t.Iflag |= unix.INPCK
+	case "E":
+		t.Cflag |= unix.PARENB
+		t.Iflag |= unix.INPCK
+	case "M":
+		t.Cflag |= unix.PARENB | unix.PARODD | unix.CMSPAR
+		t.Iflag |= unix.INPCK
+	case "S":
+		t.Cflag |= unix.PARENB | unix.CMSPAR
+		t.Iflag |= unix.INPCK
+	default:
+		return fmt.Errorf("unsupported parity: %s", opts.parity)
+	}
+	switch opts.stopBits {
+	case 0, 1:
+	case 2:
+		t.Cflag |= unix.CSTOPB
+	default:
+		return fmt.Errorf("unsupported stop bits: %d", opts.stopBits)
+	}
+	switch opts.flowControl {
+	case "", global.FlowNone:
+	case global.FlowRtsCts:
+		t.Cflag |= unix.CRTSCTS
+	case global.FlowXonXoff:
+		t.Iflag |= unix.IXON | unix.IXOFF
+	default:
+		return fmt.Errorf("unsupported flow control: %s", opts.flowControl)
+	}
+	//读取超时由poll控制
+	t.Cc[unix.VMIN] = 0
+	t.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(l.fd, unix.TCSETS, t)
+}
+
+// 交给内核在发送时翻转RTS，适用于没有自动收发的转换器
+func (l *linuxSerialPort) enableRS485(opts *rs485Options) error {
+	conf := serialRS485{
+		flags:              serRS485Enabled,
+		delayRtsBeforeSend: uint32(opts.delayBefore / time.Millisecond),
+		delayRtsAfterSend:  uint32(opts.delayAfter / time.Millisecond),
+	}
+	if opts.rtsOnSend {
+		conf.flags |= serRS485RtsOnSend
+	} else {
+		conf.flags |= serRS485RtsAfterSend
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(l.fd), unix.TIOCSRS485, uintptr(unsafe.Pointer(&conf)))
+	if errno != 0 {
+		return fmt.Errorf("TIOCSRS485: %w", errno)
+	}
+	return nil
+}
+
+func (l *linuxSerialPort) Read(p []byte) (int, error) {
+	return l.ReadTimeout(p, l.readTimeout)
+}
+
+func (l *linuxSerialPort) ReadTimeout(p []byte, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		remain := time.Until(deadline)
+		if remain <= 0 {
+			return 0, serialTimeoutError
+		}
+		fds := []unix.PollFd{{Fd: int32(l.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int((remain+time.Millisecond-1)/time.Millisecond))
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return 0, err
+		}
+		if n == 0 {
+			return 0, serialTimeoutError
+		}
+		if fds[0].Revents&(unix.POLLERR|unix.POLLHUP|unix.POLLNVAL) != 0 {
+			return 0, DisConnectedError
+		}
+		n, err = unix.Read(l.fd, p)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return 0, err
+		}
+		return n, nil
+	}
+}
+
+func (l *linuxSerialPort) Write(p []byte) (int, error) {
+	return l.WriteTimeout(p, global.DefaultTimeout)
+}
+
+// WriteTimeout 非阻塞写入，流控时对端未就绪则等待可写，timeout内未写完返回serialTimeoutError
+func (l *linuxSerialPort) WriteTimeout(p []byte, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	written := 0
+	for written < len(p) {
+		n, err := unix.Write(l.fd, p[written:])
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				//流控时对端未就绪，等待可写
+				remain := time.Until(deadline)
+				if remain <= 0 {
+					return written, serialTimeoutError
+				}
+				fds := []unix.PollFd{{Fd: int32(l.fd), Events: unix.POLLOUT}}
+				ready, pe := unix.Poll(fds, int((remain+time.Millisecond-1)/time.Millisecond))
+				if pe != nil {
+					if errors.Is(pe, unix.EINTR) {
+						continue
+					}
+					return written, pe
+				}
+				if ready == 0 {
+					return written, serialTimeoutError
+				}
+				continue
+			}
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (l *linuxSerialPort) Close() error {
+	return unix.Close(l.fd)
+}
+
+func (l *linuxSerialPort) Flush() error {
+	return unix.IoctlSetInt(l.fd, unix.TCFLSH, unix.TCIOFLUSH)
+}
+
+// Drain 等同于tcdrain
+func (l *linuxSerialPort) Drain() error {
+	return unix.IoctlSetInt(l.fd, unix.TCSBRK, 1)
+}
+
+func (l *linuxSerialPort) SetRTS(on bool) error {
+	if on {
+		return unix.IoctlSetPointerInt(l.fd, unix.TIOCMBIS, unix.TIOCM_RTS)
+	}
+	return unix.IoctlSetPointerInt(l.fd, unix.TIOCMBIC, unix.TIOCM_RTS)
+}
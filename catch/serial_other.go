@@ -0,0 +1,96 @@
+//go:build !linux
+// +build !linux
+
+package catch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sentinels/global"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// 轮询读取的间隔
+const otherPollInterval = 10 * time.Millisecond
+
+var serialUnsupportedError = errors.New("serial flow control and rts are only supported on linux")
+
+// otherSerialPort 非linux平台使用tarm/serial，不支持流控与RTS控制
+type otherSerialPort struct {
+	port        *serial.Port
+	readTimeout time.Duration
+}
+
+func openSerialPort(opts *serialOptions) (serialPort, error) {
+	if opts.flowControl != "" && opts.flowControl != global.FlowNone {
+		return nil, fmt.Errorf("%w: flow control %s", serialUnsupportedError, opts.flowControl)
+	}
+	if opts.rs485 != nil {
+		return nil, fmt.Errorf("%w: TIOCSRS485", serialUnsupportedError)
+	}
+	if opts.dataBits == 0 {
+		opts.dataBits = 8
+	}
+	c := &serial.Config{
+		Name:        opts.name,
+		Baud:        opts.baud,
+		Size:        byte(opts.dataBits),
+		Parity:      paritySnap[opts.parity],
+		StopBits:    serial.StopBits(opts.stopBits),
+		ReadTimeout: otherPollInterval,
+	}
+	if c.StopBits == 0 {
+		c.StopBits = serial.Stop1
+	}
+	s, err := serial.OpenPort(c)
+	if err != nil {
+		return nil, err
+	}
+	return &otherSerialPort{port: s, readTimeout: opts.readTimeout}, nil
+}
+
+func (o *otherSerialPort) Read(p []byte) (int, error) {
+	return o.ReadTimeout(p, o.readTimeout)
+}
+
+func (o *otherSerialPort) ReadTimeout(p []byte, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		n, err := o.port.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+	}
+	return 0, serialTimeoutError
+}
+
+func (o *otherSerialPort) Write(p []byte) (int, error) {
+	return o.port.Write(p)
+}
+
+// WriteTimeout 不支持流控，按波特率发完即返回，不会长时间阻塞
+func (o *otherSerialPort) WriteTimeout(p []byte, _ time.Duration) (int, error) {
+	return o.port.Write(p)
+}
+
+func (o *otherSerialPort) Close() error {
+	return o.port.Close()
+}
+
+func (o *otherSerialPort) Flush() error {
+	return o.port.Flush()
+}
+
+func (o *otherSerialPort) Drain() error {
+	return nil
+}
+
+func (o *otherSerialPort) SetRTS(_ bool) error {
+	return serialUnsupportedError
+}
@@ -0,0 +1,24 @@
+package catch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// 串口没有打开时读写都返回DisConnectedError，不会使用空的连接
+func TestSerialDisconnected(t *testing.T) {
+	s := &serialSyllable{ConnSyllable: &ConnSyllable{}}
+	if _, err := s.ReadByTimeout(time.Millisecond); !errors.Is(err, DisConnectedError) {
+		t.Errorf("read: got %v", err)
+	}
+	if err := s.Write([]byte{0x01}); !errors.Is(err, DisConnectedError) {
+		t.Errorf("write: got %v", err)
+	}
+	if err := s.Flush(); !errors.Is(err, DisConnectedError) {
+		t.Errorf("flush: got %v", err)
+	}
+	if _, err := s.SendAndWaitForReplyByTimeOut("", []byte{0x01}, time.Millisecond); !errors.Is(err, DisConnectedError) {
+		t.Errorf("send: got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package catch
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"io"
@@ -61,6 +62,7 @@ type TcpClient struct {
 	reader     *bufio.Reader
 	ctx        context.Context
 	cancel     context.CancelFunc
+	permission int //客户端证书角色对应的权限
 
 	transfer sync.Map
 	bq       *snap.BufQueue
@@ -68,6 +70,7 @@ type TcpClient struct {
 
 func (t *TcpClient) Open() error {
 	var err error
+	dialer := &net.Dialer{Timeout: global.DefaultTimeout}
 	if t.reuse {
 		if t.localPort == 0 {
 			t.localPort, err = getFreePort()
@@ -76,47 +79,63 @@ func (t *TcpClient) Open() error {
 				return err
 			}
 		}
-		dialer := &net.Dialer{
-			Control: func(network, address string, c syscall.RawConn) error {
-				return c.Control(func(fd uintptr) {
-					// 设置 SO_REUSEADDR
-					err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
-					if err != nil {
-						return
-					}
-				})
-			},
-			LocalAddr: &net.TCPAddr{
-				IP:   net.IPv4(127, 0, 0, 1),
-				Port: t.localPort,
-			},
+		dialer.Control = reuseAddrControl
+		dialer.LocalAddr = &net.TCPAddr{
+			IP:   net.IPv4(127, 0, 0, 1),
+			Port: t.localPort,
 		}
-		t.conn, err = dialer.Dial("tcp", t.Device.Address)
+	}
+	if t.Tls {
+		t.conn, err = t.dialTls(dialer)
 	} else {
-		//不进行端口复用
-		t.conn, err = net.Dial("tcp", t.Device.Address)
+		t.conn, err = dialer.Dial("tcp", t.Device.Address)
 	}
 	if err != nil {
 		t.fc(t.Device, err)
 		return err
-	} else {
-		t.flushLinkedFlag(true)
-		t.reader = bufio.NewReader(t.conn)
-		go func() {
-			_, err = t.Read()
-			if err != nil && err == io.EOF {
-				_ = t.Close()
-				return
-			}
-		}()
 	}
+	t.reader = bufio.NewReader(t.conn)
 	t.ctx, t.cancel = context.WithCancel(context.Background())
-	return err
+	t.flushLinkedFlag(true)
+	go func() {
+		_, err := t.Read()
+		if err != nil && err == io.EOF {
+			_ = t.Close()
+			return
+		}
+	}()
+	return nil
+}
+
+// 建立TLS连接，握手失败时不会重试
+func (t *TcpClient) dialTls(dialer *net.Dialer) (net.Conn, error) {
+	cfg, permission, err := newTlsConfig(t.Device)
+	if err != nil {
+		return nil, err
+	}
+	address, err := tlsAddress(t.Device)
+	if err != nil {
+		return nil, err
+	}
+	td := &tls.Dialer{NetDialer: dialer, Config: cfg}
+	conn, err := td.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	t.permission = permission
+	state := conn.(*tls.Conn).ConnectionState()
+	t.logger.Infof("tls connected, version:%s cipher:%s read-only:%v", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), permission == permissionReadOnly)
+	return conn, nil
 }
 
 func (t *TcpClient) Close() error {
+	if t.conn == nil {
+		return nil
+	}
 	err := t.conn.Close()
-	t.cancel()
+	if t.cancel != nil {
+		t.cancel()
+	}
 	t.flushLinkedFlag(false)
 	return err
 }
@@ -156,7 +175,9 @@ func (t *TcpClient) Read() ([]byte, error) {
 		case <-t.ctx.Done():
 			return nil, t.ctx.Err()
 		default:
-			_ = t.conn.SetReadDeadline(time.Now().Add(time.Duration(t.ReadTimeout) * time.Second))
+			if t.ReadTimeout > 0 {
+				_ = t.conn.SetReadDeadline(time.Now().Add(time.Duration(t.ReadTimeout) * time.Second))
+			}
 			frame, resp, err := t.pc.Decode(t.reader)
 			if err != nil {
 				if t.isDisConnected(err) {
@@ -213,7 +234,9 @@ func (t *TcpClient) SendAndWaitForReplyByTimeOut(key string, data []byte, timeou
 }
 
 func (t *TcpClient) Collect(key string, data []byte, point snap.PointSnap) error {
-	_ = t.conn.SetWriteDeadline(time.Now().Add(time.Duration(t.WriteTimeout) * time.Second))
+	if t.WriteTimeout > 0 {
+		_ = t.conn.SetWriteDeadline(time.Now().Add(time.Duration(t.WriteTimeout) * time.Second))
+	}
 	t.bq.Add(key, point)
 	t.logger.Debugf("send -> %s", hex.EncodeToString(data))
 	_, err := t.conn.Write(data)
@@ -287,12 +310,16 @@ func (t *TcpClient) isDisConnected(err error) bool {
 }
 
 func (t *TcpClient) Operate(opt *command.OperateCmd) ([]byte, error) {
+	if t.permission == permissionReadOnly && opt.CmdType != global.CopyRead {
+		return nil, ReadOnlyError
+	}
 	//生成报文
 	pc := t.pc.Copy()
 	key, frame, err := pc.Opt(opt)
 	if err != nil {
 		return nil, err
 	}
+	opt.FlushFrame(frame)
 	var resp []byte
 	if opt.Timeout > 0 {
 		resp, err = t.SendAndWaitForReplyByTimeOut(key, frame, time.Duration(opt.Timeout)*time.Millisecond)
@@ -0,0 +1,169 @@
+package catch
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sentinels/global"
+	"sentinels/model"
+	"strconv"
+	"strings"
+)
+
+// Modbus/TCP Security规定的角色扩展
+var modbusRoleOid = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 50316, 802, 1}
+
+var ReadOnlyError = errors.New("connection role is read-only")
+
+// 证书角色对应的权限
+const (
+	permissionReadWrite = iota
+	permissionReadOnly
+)
+
+// 补全连接地址的端口，Modbus/TCP Security默认为802，其他协议没有默认端口，必须填写
+func tlsAddress(device *model.Device) (string, error) {
+	if _, _, err := net.SplitHostPort(device.Address); err == nil {
+		return device.Address, nil
+	}
+	if device.ProtocolType == global.ModbusTCP {
+		return net.JoinHostPort(device.Address, strconv.Itoa(global.ModbusSecurityPort)), nil
+	}
+	return "", fmt.Errorf("tls address %s has no port, protocol %s has no default port", device.Address, device.ProtocolType)
+}
+
+// 根据设备配置生成TLS配置，同时返回客户端证书角色对应的权限
+func newTlsConfig(device *model.Device) (*tls.Config, int, error) {
+	//Modbus/TCP Security要求TLS1.2及以上
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: device.TlsServerName,
+	}
+	if cfg.ServerName == "" {
+		address, err := tlsAddress(device)
+		if err != nil {
+			return nil, 0, err
+		}
+		cfg.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	if device.TlsCa != "" {
+		pem, err := os.ReadFile(device.TlsCa)
+		if err != nil {
+			return nil, 0, fmt.Errorf("read tls ca err: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, 0, errors.New("no certificate found in " + device.TlsCa)
+		}
+		cfg.RootCAs = pool
+	}
+	permission := permissionReadWrite
+	if device.TlsCert != "" || device.TlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(device.TlsCert, device.TlsKey)
+		if err != nil {
+			return nil, 0, fmt.Errorf("load client certificate err: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+		permission, err = certPermission(cert)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	pins, err := parsePins(device.TlsPin)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(pins) > 0 {
+		cfg.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPin(state, pins)
+		}
+	}
+	return cfg, permission, nil
+}
+
+// 解析证书固定的指纹，支持带冒号的写法
+func parsePins(conf string) ([][]byte, error) {
+	var pins [][]byte
+	for _, item := range strings.Split(conf, ",") {
+		item = strings.ReplaceAll(strings.TrimSpace(item), ":", "")
+		if item == "" {
+			continue
+		}
+		pin, err := hex.DecodeString(item)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid tls pin: %s", item)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// 服务端证书的公钥指纹必须与其中一个固定值一致
+func verifyPin(state tls.ConnectionState, pins [][]byte) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	sum := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	for _, pin := range pins {
+		if string(pin) == string(sum[:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("server certificate pin mismatch: %s", hex.EncodeToString(sum[:]))
+}
+
+// 读取客户端证书中的角色，没有角色扩展时为读写权限，未配置的角色为只读
+func certPermission(cert tls.Certificate) (int, error) {
+	if len(cert.Certificate) == 0 {
+		return permissionReadWrite, nil
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return 0, fmt.Errorf("parse client certificate err: %w", err)
+	}
+	role, ok, err := CertRole(leaf)
+	if err != nil || !ok {
+		return permissionReadWrite, err
+	}
+	return rolePermission(role), nil
+}
+
+// CertRole 证书中Modbus/TCP Security角色扩展的值，没有角色扩展时ok为false
+func CertRole(leaf *x509.Certificate) (string, bool, error) {
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(modbusRoleOid) {
+			continue
+		}
+		var role string
+		if _, err := asn1.Unmarshal(ext.Value, &role); err != nil {
+			return "", false, fmt.Errorf("invalid role extension: %w", err)
+		}
+		return role, true, nil
+	}
+	return "", false, nil
+}
+
+func rolePermission(role string) int {
+	if containsRole(global.Config.ReadWriteRoles, role) {
+		return permissionReadWrite
+	}
+	if !containsRole(global.Config.ReadOnlyRoles, role) {
+		global.SystemLog.Warnf("tls role %s is not configured, use read-only", role)
+	}
+	return permissionReadOnly
+}
+
+func containsRole(roles string, role string) bool {
+	for _, item := range strings.Split(roles, ",") {
+		if strings.TrimSpace(item) == role {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
@@ -9,12 +10,39 @@ import (
 	"strings"
 )
 
+// CAN命令的功能码
+const (
+	CanFuncSdo   = "sdo"   //SDO上传/下载
+	CanFuncNmt   = "nmt"   //NMT节点管理
+	CanFuncFrame = "frame" //原始帧，copyRead时发送远程帧
+)
+
+// NMT命令
+const (
+	CanNmtStart     = "start"
+	CanNmtStop      = "stop"
+	CanNmtPreOp     = "preop"
+	CanNmtReset     = "reset"
+	CanNmtResetComm = "resetComm"
+)
+
 // OperateCmd 实际参数
 type OperateCmd struct {
 	Timeout  int64             `json:"timeout"`  //毫秒
 	CmdType  string            `json:"cmdType"`  //命令类型,参照global.go中的【命令类型】
 	FuncCode string            `json:"funcCode"` //功能码
 	Value    map[string]string `json:"value"`
+	frame    []byte            //最后一次下发的报文，由连接器填写
+}
+
+// FlushFrame 记录下发的报文
+func (c *OperateCmd) FlushFrame(frame []byte) {
+	c.frame = frame
+}
+
+// Frame 最后一次下发的报文
+func (c *OperateCmd) Frame() []byte {
+	return c.frame
 }
 
 func (c *OperateCmd) Check() error {
@@ -22,9 +50,14 @@ func (c *OperateCmd) Check() error {
 		c.Timeout = 0
 	}
 	c.CmdType = strings.TrimSpace(c.CmdType)
-	if c.CmdType != global.CopyRead && c.CmdType != global.SetCmd && c.CmdType != global.Passthrough {
+	if c.CmdType != global.CopyRead && c.CmdType != global.SetCmd && c.CmdType != global.Passthrough && c.CmdType != global.WritePoint {
 		return errors.New("cmd type error")
 	}
+	if c.CmdType == global.WritePoint {
+		//功能码由点位决定
+		_, _, err := c.WritePointItems()
+		return err
+	}
 	c.FuncCode = strings.TrimSpace(c.FuncCode)
 	if c.FuncCode == "" {
 		return errors.New("funcCode error")
@@ -35,6 +68,38 @@ func (c *OperateCmd) Check() error {
 	return nil
 }
 
+// NewModbusSetCmd 创建modbus的设置命令
+func NewModbusSetCmd(funcCode byte, startAddress uint16, value ...uint16) *OperateCmd {
+	cmd := &OperateCmd{Value: make(map[string]string)}
+	cmd.flushModbusSet(funcCode, startAddress, value...)
+	return cmd
+}
+
+func (op *OperateCmd) flushModbusSet(funcCode byte, startAddress uint16, value ...uint16) {
+	op.CmdType = global.SetCmd
+	op.FuncCode = fmt.Sprintf("%d", funcCode)
+	op.Value[startAddrFlag] = fmt.Sprintf("%d", startAddress)
+	op.Value[lengthFlag] = fmt.Sprintf("%d", len(value))
+	strSlice := make([]string, len(value))
+	for i, v := range value {
+		strSlice[i] = strconv.Itoa(int(v))
+	}
+	op.Value[valueFlag] = strings.Join(strSlice, ",")
+}
+
+// WritePointItems 按点位写入的标签与工程值
+func (op *OperateCmd) WritePointItems() (string, float64, error) {
+	tag := strings.TrimSpace(op.Value[tagFlag])
+	if tag == "" {
+		return "", 0, errors.New("write point tag is empty")
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(op.Value[valueFlag]), 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("write point value error: %w", err)
+	}
+	return tag, value, nil
+}
+
 func (op *OperateCmd) modbusItem(key string) (value uint16, err error) {
 	if valueStr, ok := op.Value[key]; ok {
 		valueUint, err := strconv.ParseUint(valueStr, 0, 16)
@@ -110,6 +175,26 @@ func (op *OperateCmd) ModbusValueToBytes() (uint16, []byte, error) {
 
 }
 
+// ModbusBits 写多个线圈的值，以逗号分隔的0或1，按线圈顺序
+func (op *OperateCmd) ModbusBits() ([]uint16, error) {
+	valueStr, ok := op.Value[valueFlag]
+	if !ok || strings.TrimSpace(valueStr) == "" {
+		return nil, errors.New("modbus cmd item:value error")
+	}
+	var result []uint16
+	for _, v := range strings.Split(valueStr, ",") {
+		switch strings.TrimSpace(v) {
+		case "0":
+			result = append(result, 0)
+		case "1":
+			result = append(result, 1)
+		default:
+			return nil, errors.New("modbus cmd item:value error")
+		}
+	}
+	return result, nil
+}
+
 func (op *OperateCmd) ModbusMultipleValue() ([]byte, error) {
 	if op.Value == nil || op.Value[valueFlag] == "" {
 		return nil, errors.New("modbus copy read items error")
@@ -132,3 +217,75 @@ func (op *OperateCmd) ModbusMultipleValue() ([]byte, error) {
 	}
 	return result, nil
 }
+
+// CanObject CANopen对象字典的index与subindex
+func (op *OperateCmd) CanObject() (uint16, byte, error) {
+	index, err := op.modbusItem(indexFlag)
+	if err != nil {
+		return 0, 0, err
+	}
+	subStr, ok := op.Value[subIndexFlag]
+	if !ok {
+		return index, 0, nil
+	}
+	sub, err := strconv.ParseUint(strings.TrimSpace(subStr), 0, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	return index, byte(sub), nil
+}
+
+// CanSdoValue SDO下载的字节数与数值
+func (op *OperateCmd) CanSdoValue() (int, uint32, error) {
+	size := 4
+	if sizeStr, ok := op.Value[sizeFlag]; ok {
+		s, err := strconv.Atoi(strings.TrimSpace(sizeStr))
+		if err != nil {
+			return 0, 0, err
+		}
+		size = s
+	}
+	if size < 1 || size > 4 {
+		return 0, 0, fmt.Errorf("can sdo size must be 1~4, got %d", size)
+	}
+	valueStr, ok := op.Value[valueFlag]
+	if !ok {
+		return 0, 0, errors.New("can sdo value is empty")
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(valueStr), 0, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if value < math.MinInt32 || value > math.MaxUint32 {
+		return 0, 0, fmt.Errorf("can sdo value out of range: %s", valueStr)
+	}
+	return size, uint32(value), nil
+}
+
+// CanCobId 原始帧的COB-ID
+func (op *OperateCmd) CanCobId() (uint32, error) {
+	cobStr, ok := op.Value[cobIdFlag]
+	if !ok {
+		return 0, errors.New("can cob-id is empty")
+	}
+	cobId, err := strconv.ParseUint(strings.TrimSpace(cobStr), 0, 32)
+	if err != nil {
+		return 0, err
+	}
+	if cobId > 0x1FFFFFFF {
+		return 0, fmt.Errorf("can cob-id too large: %s", cobStr)
+	}
+	return uint32(cobId), nil
+}
+
+// CanData 原始帧的数据域，十六进制字符串
+func (op *OperateCmd) CanData() ([]byte, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(op.Value[valueFlag]))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 8 {
+		return nil, fmt.Errorf("can data too long: %d", len(data))
+	}
+	return data, nil
+}
@@ -14,6 +14,11 @@ const (
 	startAddrFlag = "startAddr"
 	lengthFlag    = "length"
 	valueFlag     = "value"
+	cobIdFlag     = "cobId"
+	indexFlag     = "index"
+	subIndexFlag  = "subIndex"
+	sizeFlag      = "size"
+	tagFlag       = "tag"
 )
 
 // NewDefaultCarrier 创建一个“控制信息传输的载体”
@@ -27,9 +32,23 @@ func NewDefaultCarrier() *ControlCarrier {
 	}
 }
 
+// NewCarrierByDevId 创建按设备id下发的载体
+func NewCarrierByDevId(id string) *ControlCarrier {
+	return NewDefaultCarrier().flushDevSignByDevId(id)
+}
+
+// NewCarrierByTableFlag 创建按设备标志下发的载体
+func NewCarrierByTableFlag(flag string) *ControlCarrier {
+	return NewDefaultCarrier().flushDevSignByTableFlag(flag)
+}
+
 // ControlCarrier 控制信息传输的载体
 type ControlCarrier struct {
 	uniqueIdentifier string      //唯一标识
+	requester        string      //请求方，记录在审计中
+	sboToken         string      //选择后执行的令牌
+	bypass           string      //旁路联锁的原因，为空时不旁路
+	role             string      //已认证的角色，只能取自校验过的客户端证书，决定能否旁路联锁
 	ReplySize        int         //重尝试次数
 	signType         string      //根据什么寻找指定的调度器， address， id
 	sign             string      //设备标识，与SignType相对应
@@ -78,6 +97,66 @@ func (c *ControlCarrier) UniqueIdentifier() string {
 	return c.uniqueIdentifier
 }
 
+// FlushUniqueIdentifier 使用调用方提供的唯一标识，相同标识的命令在去重窗口内只执行一次
+func (c *ControlCarrier) FlushUniqueIdentifier(id string) *ControlCarrier {
+	c.uniqueIdentifier = strings.TrimSpace(id)
+	return c
+}
+
+// FlushRequester 设置请求方
+func (c *ControlCarrier) FlushRequester(requester string) *ControlCarrier {
+	c.requester = requester
+	return c
+}
+
+// Requester 请求方
+func (c *ControlCarrier) Requester() string {
+	return c.requester
+}
+
+// FlushSboToken 携带选择时返回的令牌，写入需要先选择的点位时使用
+func (c *ControlCarrier) FlushSboToken(token string) *ControlCarrier {
+	c.sboToken = token
+	return c
+}
+
+// SboToken 选择后执行的令牌
+func (c *ControlCarrier) SboToken() string {
+	return c.sboToken
+}
+
+// FlushBypass 旁路联锁，只有配置的角色可以旁路，旁路会记录在日志与审计中
+func (c *ControlCarrier) FlushBypass(reason string) *ControlCarrier {
+	c.bypass = strings.TrimSpace(reason)
+	return c
+}
+
+// Bypass 旁路联锁的原因
+func (c *ControlCarrier) Bypass() string {
+	return c.bypass
+}
+
+// FlushRole 设置已认证的角色，调用方必须从校验过的客户端证书中取得，不能使用请求中的内容
+func (c *ControlCarrier) FlushRole(role string) *ControlCarrier {
+	c.role = strings.TrimSpace(role)
+	return c
+}
+
+// Role 已认证的角色
+func (c *ControlCarrier) Role() string {
+	return c.role
+}
+
+// SendTime 发送时间，毫秒
+func (c *ControlCarrier) SendTime() int64 {
+	return c.sendTime
+}
+
+// Expired 是否已经超过有效期，有效期为0时不过期
+func (c *ControlCarrier) Expired(now time.Time) bool {
+	return c.ValidityPeriod > 0 && now.UnixMilli() > c.ValidityPeriod
+}
+
 // FlushModbusCmdCopyRead 创建modbus的抄读命令
 func (c *ControlCarrier) FlushModbusCmdCopyRead(funcCode byte, startAddress uint16, length uint16) *ControlCarrier {
 	c.Cmd.CmdType = global.CopyRead
@@ -89,15 +168,15 @@ func (c *ControlCarrier) FlushModbusCmdCopyRead(funcCode byte, startAddress uint
 
 // FlushModbusCmdSet 创建modbus的设置命令
 func (c *ControlCarrier) FlushModbusCmdSet(funcCode byte, startAddress uint16, value ...uint16) *ControlCarrier {
-	c.Cmd.CmdType = global.SetCmd
-	c.Cmd.FuncCode = fmt.Sprintf("%d", funcCode)
-	c.Cmd.Value[startAddrFlag] = fmt.Sprintf("%d", startAddress)
-	c.Cmd.Value[lengthFlag] = fmt.Sprintf("%d", len(value))
-	strSlice := make([]string, len(value))
-	for i, v := range value {
-		strSlice[i] = strconv.Itoa(int(v))
-	}
-	c.Cmd.Value[valueFlag] = strings.Join(strSlice, ",")
+	c.Cmd.flushModbusSet(funcCode, startAddress, value...)
+	return c
+}
+
+// FlushWritePointCmd 创建按点位标签写入工程值的命令，由调度器换算为原始值并选择功能码
+func (c *ControlCarrier) FlushWritePointCmd(tag string, value float64) *ControlCarrier {
+	c.Cmd.CmdType = global.WritePoint
+	c.Cmd.Value[tagFlag] = tag
+	c.Cmd.Value[valueFlag] = strconv.FormatFloat(value, 'f', -1, 64)
 	return c
 }
 
@@ -107,3 +186,40 @@ func (c *ControlCarrier) FlushModbusCmdPassthrough(cmd []byte) *ControlCarrier {
 	c.Cmd.Value[valueFlag] = hex.EncodeToString(cmd)
 	return c
 }
+
+// FlushCanCmdSdoRead 创建CANopen的SDO上传命令
+func (c *ControlCarrier) FlushCanCmdSdoRead(index uint16, subIndex byte) *ControlCarrier {
+	c.Cmd.CmdType = global.CopyRead
+	c.Cmd.FuncCode = CanFuncSdo
+	c.Cmd.Value[indexFlag] = fmt.Sprintf("0x%04x", index)
+	c.Cmd.Value[subIndexFlag] = fmt.Sprintf("%d", subIndex)
+	return c
+}
+
+// FlushCanCmdSdoWrite 创建CANopen的SDO下载命令，size为1~4字节
+func (c *ControlCarrier) FlushCanCmdSdoWrite(index uint16, subIndex byte, size int, value uint32) *ControlCarrier {
+	c.Cmd.CmdType = global.SetCmd
+	c.Cmd.FuncCode = CanFuncSdo
+	c.Cmd.Value[indexFlag] = fmt.Sprintf("0x%04x", index)
+	c.Cmd.Value[subIndexFlag] = fmt.Sprintf("%d", subIndex)
+	c.Cmd.Value[sizeFlag] = fmt.Sprintf("%d", size)
+	c.Cmd.Value[valueFlag] = fmt.Sprintf("%d", value)
+	return c
+}
+
+// FlushCanCmdNmt 创建CANopen的NMT命令，state参照CanNmt*
+func (c *ControlCarrier) FlushCanCmdNmt(state string) *ControlCarrier {
+	c.Cmd.CmdType = global.SetCmd
+	c.Cmd.FuncCode = CanFuncNmt
+	c.Cmd.Value[valueFlag] = state
+	return c
+}
+
+// FlushCanCmdFrame 创建原始CAN帧命令
+func (c *ControlCarrier) FlushCanCmdFrame(cobId uint32, data []byte) *ControlCarrier {
+	c.Cmd.CmdType = global.Passthrough
+	c.Cmd.FuncCode = CanFuncFrame
+	c.Cmd.Value[cobIdFlag] = fmt.Sprintf("0x%x", cobId)
+	c.Cmd.Value[valueFlag] = hex.EncodeToString(data)
+	return c
+}
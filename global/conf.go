@@ -5,15 +5,69 @@ import (
 )
 
 var Config = &Conf{
-	Port:   defaultPort,
-	Static: defaultStaticPath,
-	DbPath: defaultDbPath,
+	Port:                defaultPort,
+	Static:              defaultStaticPath,
+	DbPath:              defaultDbPath,
+	ReconnectInitial:    defaultReconnectInitial,
+	ReconnectMax:        defaultReconnectMax,
+	ReconnectMultiplier: defaultReconnectMultiplier,
+	ReconnectJitter:     defaultReconnectJitter,
+	BreakerThreshold:    defaultBreakerThreshold,
+	BreakerProbe:        defaultBreakerProbe,
+	ReconnectStable:     defaultReconnectStable,
+	CollectInterval:     defaultCollectInterval,
+	CollectGap:          defaultCollectGap,
+	WeightHigh:          defaultWeightHigh,
+	WeightMiddle:        defaultWeightMiddle,
+	WeightLow:           defaultWeightLow,
+	ControlQueueDepth:   defaultControlQueueDepth,
+	DedupWindow:         defaultDedupWindow,
+	SboTimeout:          defaultSboTimeout,
+	ModbusMaxGap:        defaultModbusMaxGap,
+	LuaTimeout:          defaultLuaTimeout,
+	VirtualStale:        defaultVirtualStale,
 }
 
 type Conf struct {
 	Port   int    `ini:"port"`
 	Static string `ini:"static"`
 	DbPath string `ini:"dbPath"`
+	//接口使用https，apiClientCa不为空时校验客户端证书
+	ApiTlsCert  string `ini:"apiTlsCert"`
+	ApiTlsKey   string `ini:"apiTlsKey"`
+	ApiClientCa string `ini:"apiClientCa"`
+	//客户端证书角色对应的权限，角色以逗号分隔
+	ReadOnlyRoles  string `ini:"readOnlyRoles"`
+	ReadWriteRoles string `ini:"readWriteRoles"`
+	//重连策略
+	ReconnectInitial    int     `ini:"reconnectInitial"`    //首次重连间隔，毫秒
+	ReconnectMax        int     `ini:"reconnectMax"`        //最大重连间隔，毫秒
+	ReconnectMultiplier float64 `ini:"reconnectMultiplier"` //每次失败后间隔的倍数
+	ReconnectJitter     float64 `ini:"reconnectJitter"`     //随机抖动比例，0~1
+	BreakerThreshold    int     `ini:"breakerThreshold"`    //连续失败多少次后熔断，设备标记为故障
+	BreakerProbe        int     `ini:"breakerProbe"`        //熔断后的探测间隔，秒
+	ReconnectStable     int     `ini:"reconnectStable"`     //连接保持多少秒后清空失败次数，秒
+	//采集调度
+	CollectInterval int `ini:"collectInterval"` //点位与采集规则都没有配置间隔时的采集间隔，毫秒
+	CollectGap      int `ini:"collectGap"`      //两次采集请求之间的最小间隔，毫秒
+	//高中低优先级的采集权重
+	WeightHigh   int `ini:"weightHigh"`
+	WeightMiddle int `ini:"weightMiddle"`
+	WeightLow    int `ini:"weightLow"`
+	//每个设备等待下发的控制数量上限
+	ControlQueueDepth int `ini:"controlQueueDepth"`
+	//相同唯一标识的命令只执行一次的时间窗口，秒
+	DedupWindow int `ini:"dedupWindow"`
+	//选择后等待执行的默认时间，秒
+	SboTimeout int `ini:"sboTimeout"`
+	//可以旁路联锁的客户端证书角色，以逗号分隔，需要配置apiClientCa
+	BypassRoles string `ini:"bypassRoles"`
+	//modbus合并读取时允许跨过的未配置地址数量
+	ModbusMaxGap int `ini:"modbusMaxGap"`
+	//点位lua表达式单次执行的最长时间，毫秒
+	LuaTimeout int `ini:"luaTimeout"`
+	//虚拟点位的输入超过多久没有更新时视为失效，毫秒，0为只看数据质量
+	VirtualStale int `ini:"virtualStale"`
 }
 
 func flushConf() {
@@ -7,6 +7,32 @@ const (
 	defaultStaticPath = "./static"
 	defaultDbPath     = "./bin/sentinels.db"
 	DefaultTimeout    = 5000 * time.Millisecond
+
+	DefaultFailover      = 3                //连续3次无回复切换通道
+	DefaultFailbackProbe = 30 * time.Second //探测主通道的间隔
+
+	ModbusSecurityPort = 802 //Modbus/TCP Security默认端口
+
+	defaultReconnectInitial    = 1000
+	defaultReconnectMax        = 60000
+	defaultReconnectMultiplier = 2
+	defaultReconnectJitter     = 0.2
+	defaultBreakerThreshold    = 10
+	defaultBreakerProbe        = 300
+	defaultReconnectStable     = 30
+	defaultCollectInterval     = 2000
+	defaultCollectGap          = 50
+	defaultWeightHigh          = 6
+	defaultWeightMiddle        = 3
+	defaultWeightLow           = 1
+	defaultControlQueueDepth   = 32
+	defaultDedupWindow         = 300
+	defaultSboTimeout          = 30
+	defaultModbusMaxGap        = 0
+	defaultLuaTimeout          = 1000
+	DefaultLuaTimeout          = defaultLuaTimeout * time.Millisecond //luaTimeout不大于0时使用
+	defaultVirtualStale        = 0
+	IdleWait                   = time.Second //没有可采集的点位时的等待时间
 )
 
 func init() {
@@ -27,6 +53,78 @@ const (
 	SPS            = "SPS" //串口服务器
 )
 
+// 串口流控
+const (
+	FlowNone    = "none"
+	FlowRtsCts  = "rtscts"  //硬件流控
+	FlowXonXoff = "xonxoff" //软件流控
+)
+
+// 485收发控制
+const (
+	Rs485Auto  = "auto"  //转换器自动切换收发
+	Rs485Ioctl = "ioctl" //由内核通过TIOCSRS485翻转RTS
+	Rs485Rts   = "rts"   //发送时手动翻转RTS
+)
+
+// 重连状态
+const (
+	ReconnectConnected = "connected"    //已连接
+	ReconnectWaiting   = "reconnecting" //等待重连
+	ReconnectFaulted   = "faulted"      //熔断，降低探测频率
+	ReconnectStopped   = "stopped"      //已停止
+)
+
+// 数据质量
+const (
+	QualityGood = "good" //正常采集
+	QualityBad  = "bad"  //采集失败或连接断开，值为最后一次采集的值
+)
+
+// 生命周期状态
+const (
+	StateCreated    = "created"    //已创建，未启动
+	StateConnecting = "connecting" //正在连接
+	StateOnline     = "online"     //在线，采集正常
+	StateDegraded   = "degraded"   //在线，采集无回复或使用备用通道
+	StateOffline    = "offline"    //断开，等待重连
+	StatePaused     = "paused"     //暂停采集
+	StateRemoved    = "removed"    //已移除
+)
+
+// 定时任务类型
+const (
+	JobOnce = "once" //单次
+	JobCron = "cron" //周期
+	JobTou  = "tou"  //分时
+)
+
+// 场景步骤类型
+const (
+	StepWrite     = "write"     //下发控制
+	StepWait      = "wait"      //等待
+	StepWaitUntil = "waitUntil" //等待点位达到指定值
+	StepBranch    = "branch"    //条件分支
+)
+
+// 场景执行状态
+const (
+	SceneRunning = "running" //执行中
+	SceneSuccess = "success" //全部步骤成功
+	SceneFailed  = "failed"  //步骤失败，已回滚
+	SceneAborted = "aborted" //人工中止，已回滚
+)
+
+// 控制结果
+const (
+	OutcomeSuccess   = "success"     //执行成功
+	OutcomeFailed    = "failed"      //执行失败
+	OutcomeExpired   = "expired"     //超过有效期，没有下发
+	OutcomeRejected  = "rejected"    //参数错误或设备不存在
+	OutcomeDuplicate = "duplicate"   //重复的命令，返回首次执行的结果
+	OutcomeInterlock = "interlocked" //不满足联锁条件，没有下发
+)
+
 // 规约类型
 const (
 	ModbusRTU = "modbusRTU"
@@ -37,6 +135,9 @@ const (
 	DLT645FE  = "DLT645FE" //报文前存在4个0xFE
 	GBT13761  = "1376.1"
 	GBT1867   = "1867"
+	CanRaw    = "canRaw"  //原始CAN帧
+	CANopen   = "CANopen" //CANopen，SDO/PDO/NMT
+	Virtual   = "virtual" //虚拟设备，点位由其他点位的实时值计算得到
 )
 
 // 优先级
@@ -46,9 +147,14 @@ const (
 	PriorityMiddle = 1 //中
 )
 
+// 字节序
 const (
 	BigEndian    = "BIG"
 	LittleEndian = "LITTLE"
+	OrderABCD    = "ABCD" //大端，与BIG相同
+	OrderCDAB    = "CDAB" //字交换，字内大端
+	OrderBADC    = "BADC" //字内字节交换
+	OrderDCBA    = "DCBA" //小端，与LITTLE相同
 )
 
 const (
@@ -69,6 +175,29 @@ const (
 	DTUint64  = "uint64"
 	DTFloat32 = "float32"
 	DTFloat64 = "float64"
+	//扩展类型，只用于modbus寄存器
+	DTString      = "string"      //字符串，占用length个寄存器
+	DTBcd16       = "bcd16"       //4位BCD
+	DTBcd32       = "bcd32"       //8位BCD
+	DTSm16        = "sm16"        //16位原码，最高位为符号
+	DTSm32        = "sm32"        //32位原码，最高位为符号
+	DTUint48      = "uint48"      //48位计数器
+	DTUnixTime32  = "unixtime32"  //unix时间戳，秒
+	DTUnixTime64  = "unixtime64"  //unix时间戳，毫秒
+	DTCP56Time2a  = "cp56time2a"  //IEC 60870-5 CP56Time2a，7个字节
+	DTDateAndTime = "dateAndTime" //西门子DATE_AND_TIME，8个字节BCD
+)
+
+// 值映射类型
+const (
+	MapEnum  = "enum"  //按值对应文字
+	MapFlags = "flags" //按bit对应文字，置位的bit组成列表
+)
+
+// 字符串编码
+const (
+	EncodingAscii = "ascii"
+	EncodingUtf16 = "utf16" //UTF-16大端
 )
 
 const (
@@ -81,4 +210,5 @@ const (
 	CopyRead    = "copyRead"    //抄读
 	SetCmd      = "setCmd"      //设置
 	Passthrough = "passthrough" //透传
+	WritePoint  = "writePoint"  //按点位标签写入工程值
 )
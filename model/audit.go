@@ -0,0 +1,42 @@
+package model
+
+// ControlAudit 控制审计记录
+type ControlAudit struct {
+	ID               uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	UniqueIdentifier string `json:"uniqueIdentifier" gorm:"index"`
+	Requester        string `json:"requester" gorm:"index"` //请求方
+	SignType         string `json:"signType"`               //设备标识类型，id或标志
+	Sign             string `json:"sign"`                   //设备标识
+	DeviceId         string `json:"deviceId" gorm:"index"`
+	CmdType          string `json:"cmdType"`
+	FuncCode         string `json:"funcCode"`
+	Value            string `json:"value"`    //命令参数，json
+	Frame            string `json:"frame"`    //最后一次下发的报文，hex
+	Response         string `json:"response"` //回复，hex
+	Retries          int    `json:"retries"`  //重试次数
+	Outcome          string `json:"outcome"`  //参照global.go中的【控制结果】
+	Error            string `json:"error"`
+	Bypass           string `json:"bypass"`     //旁路的联锁与原因
+	SendTime         int64  `json:"sendTime"`   //请求方的发送时间，毫秒
+	CreateTime       int64  `json:"createTime"` //收到命令的时间，毫秒
+	FinishTime       int64  `json:"finishTime"` //执行完成的时间，毫秒
+}
+
+// AuditQuery 审计查询条件
+type AuditQuery struct {
+	DeviceId         string `form:"deviceId"`
+	Requester        string `form:"requester"`
+	UniqueIdentifier string `form:"uniqueIdentifier"`
+	Outcome          string `form:"outcome"`
+	From             int64  `form:"from"` //毫秒
+	To               int64  `form:"to"`   //毫秒
+	Page             int    `form:"page"`
+	PageSize         int    `form:"pageSize"`
+}
+
+type AuditResponse struct {
+	TotalCount int             `json:"totalCount"`
+	Page       int             `json:"page"`
+	PageSize   int             `json:"pageSize"`
+	Audits     []*ControlAudit `json:"audits"`
+}
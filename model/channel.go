@@ -0,0 +1,44 @@
+package model
+
+// Channel 设备的备用通道，主通道为设备自身的连接参数，备用通道按Sort从小到大排列
+type Channel struct {
+	ID            string `json:"id" gorm:"primaryKey"`
+	DeviceId      string `json:"deviceId"`
+	Sort          int    `json:"sort"`          //顺序
+	InterfaceType string `json:"interfaceType"` //接口类型
+	Address       string `json:"address"`       //连接地址
+	BaudRate      int    `json:"baudRate"`      //波特率
+	StopBits      int    `json:"stopBits"`      //停止位
+	DataBits      int    `json:"dataBits"`      //数据位
+	Parity        string `json:"parity"`        //校验位
+	ProtocolType  string `json:"protocolType"`  //协议类型，为空时与设备一致
+	DeviceAddress string `json:"deviceAddress"` //设备地址，为空时与设备一致
+}
+
+// Overlay 用通道的连接参数覆盖设备，得到该通道使用的设备参数
+func (c *Channel) Overlay(d *Device) *Device {
+	dev := *d
+	dev.InterfaceType = c.InterfaceType
+	dev.Address = c.Address
+	dev.BaudRate = c.BaudRate
+	dev.StopBits = c.StopBits
+	dev.DataBits = c.DataBits
+	dev.Parity = c.Parity
+	if c.ProtocolType != "" {
+		dev.ProtocolType = c.ProtocolType
+	}
+	if c.DeviceAddress != "" {
+		dev.DeviceAddress = c.DeviceAddress
+	}
+	return &dev
+}
+
+// ChannelEvent 通道切换记录
+type ChannelEvent struct {
+	DeviceId string `json:"deviceId"`
+	From     int    `json:"from"`    //切换前的通道，0为主通道
+	To       int    `json:"to"`      //切换后的通道
+	Address  string `json:"address"` //切换后的连接地址
+	Reason   string `json:"reason"`
+	Time     int64  `json:"time"`
+}
@@ -7,4 +7,6 @@ type Collect struct {
 	StartPoint   string `json:"startPoint"`
 	EndPoint     string `json:"endPoint"`
 	DeviceId     string `json:"deviceId"`
+	Mapping      string `json:"mapping"`  //CAN帧映射，StartPoint为COB-ID时按顺序排列的index:subindex或点位标签
+	Interval     int    `json:"interval"` //采集间隔，毫秒，0时取点位的采集间隔
 }
@@ -3,21 +3,42 @@ package model
 import "fmt"
 
 type Device struct {
-	Id            string `json:"id" gorm:"primaryKey"`
-	Status        bool   `json:"status"` //切入切出状态
-	Name          string `json:"name"`
-	Code          string `json:"code"`
-	Table         string `json:"table"`         //标志
-	InterfaceType string `json:"interfaceType"` //接口类型
-	Address       string `json:"address"`       //连接地址
-	BaudRate      int    `json:"baudRate"`      //波特率
-	StopBits      int    `json:"stopBits"`      //停止位
-	DataBits      int    `json:"dataBits"`      //停止位
-	Parity        string `json:"parity"`        //校验位
-	ProtocolType  string `json:"protocolType"`  //协议类型
-	DeviceAddress string `json:"deviceAddress"` //设备地址
-	WriteTimeout  int    `json:"writeTimeout"`
-	ReadTimeout   int    `json:"readTimeout"`
+	Id             string `json:"id" gorm:"primaryKey"`
+	Status         bool   `json:"status"` //切入切出状态
+	Name           string `json:"name"`
+	Code           string `json:"code"`
+	Table          string `json:"table"`         //标志
+	InterfaceType  string `json:"interfaceType"` //接口类型
+	Address        string `json:"address"`       //连接地址
+	BaudRate       int    `json:"baudRate"`      //波特率
+	StopBits       int    `json:"stopBits"`      //停止位
+	DataBits       int    `json:"dataBits"`      //停止位
+	Parity         string `json:"parity"`        //校验位
+	ProtocolType   string `json:"protocolType"`  //协议类型
+	DeviceAddress  string `json:"deviceAddress"` //设备地址
+	WriteTimeout   int    `json:"writeTimeout"`
+	ReadTimeout    int    `json:"readTimeout"`
+	FlowControl    string `json:"flowControl"`    //流控，参照global.go中的【串口流控】
+	Rs485Mode      string `json:"rs485Mode"`      //485收发控制，参照global.go中的【485收发控制】
+	RtsDelayBefore int    `json:"rtsDelayBefore"` //发送前RTS保持时间，毫秒
+	RtsDelayAfter  int    `json:"rtsDelayAfter"`  //发送后RTS保持时间，毫秒
+	RtsInvert      bool   `json:"rtsInvert"`      //发送时RTS为低电平
+	CanFilter      string `json:"canFilter"`      //CAN接收过滤，id[/mask]以逗号分隔，为空时接收所有帧
+	Heartbeat      int    `json:"heartbeat"`      //CANopen心跳消费超时，毫秒，0为不监督
+	Failover       int    `json:"failover"`       //连续多少次采集无回复后切换到下一个通道，0为默认值
+	FailbackProbe  int    `json:"failbackProbe"`  //使用备用通道时探测主通道的间隔，秒，0为默认值
+	Tls            bool   `json:"tls"`            //使用TLS连接，modbusTCP为Modbus/TCP Security
+	TlsCa          string `json:"tlsCa"`          //CA证书路径，为空时使用系统证书
+	TlsCert        string `json:"tlsCert"`        //客户端证书路径，双向认证时填写
+	TlsKey         string `json:"tlsKey"`         //客户端私钥路径
+	TlsServerName  string `json:"tlsServerName"`  //校验的服务端名称，为空时取连接地址
+	TlsPin         string `json:"tlsPin"`         //服务端证书公钥的sha256指纹，以逗号分隔，为空时不固定
+
+	//modbus合并读取
+	MaxGap          int    `json:"maxGap"`          //modbus合并读取时允许跨过的未配置地址数量，0为配置文件的默认值，小于0为不跨过
+	MaxRegisters    int    `json:"maxRegisters"`    //modbus单次最多读取的寄存器数量，0为125
+	MaxCoils        int    `json:"maxCoils"`        //modbus单次最多读取的线圈数量，0为2000
+	ForbiddenRanges string `json:"forbiddenRanges"` //modbus禁止读取的地址范围，[功能码:]起始-结束以逗号分隔，例如3:100-120,0x200
 }
 
 func (d *Device) Identifier() string {
@@ -0,0 +1,12 @@
+package model
+
+// Interlock 联锁规则，下发控制前执行，表达式返回false时拒绝控制
+type Interlock struct {
+	ID         string `json:"id" gorm:"primaryKey"`
+	Name       string `json:"name"`
+	DeviceId   string `json:"deviceId" gorm:"index"` //受约束的设备
+	Tag        string `json:"tag"`                   //受约束的点位，为空时约束设备的所有设置命令
+	Expression string `json:"expression"`            //lua表达式，返回true时允许控制
+	Message    string `json:"message"`               //不满足时的提示
+	Enabled    bool   `json:"enabled"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import "encoding/json"
+
+// ControlJob 定时控制任务
+type ControlJob struct {
+	ID          string          `json:"id" gorm:"primaryKey"`
+	Name        string          `json:"name"`
+	Kind        string          `json:"kind"`                 //参照global.go中的【定时任务类型】
+	DeviceId    string          `json:"deviceId"`             //下发的设备
+	Cmd         json.RawMessage `json:"cmd" gorm:"type:text"` //下发的命令，与command.OperateCmd相同
+	At          int64           `json:"at"`                   //单次任务的执行时间，毫秒
+	Cron        string          `json:"cron"`                 //周期任务，分 时 日 月 周
+	Profile     string          `json:"profile"`              //分时任务，时间=值以逗号分隔，例如08:00=22,18:00=26，值替换命令中的value
+	Weekdays    string          `json:"weekdays"`             //分时任务生效的星期，与cron的周相同，例如1-5，为空时每天
+	ReplySize   int             `json:"replySize"`
+	Requester   string          `json:"requester"` //记录在审计中的请求方，为空时为job:任务id
+	Enabled     bool            `json:"enabled"`
+	LastRun     int64           `json:"lastRun"`     //最后一次执行时间，毫秒
+	LastOutcome string          `json:"lastOutcome"` //最后一次执行结果
+	NextRun     int64           `json:"nextRun"`     //下次执行时间，毫秒，0为不再执行
+}
+
+// JobRun 定时任务的执行记录
+type JobRun struct {
+	ID               uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	JobId            string `json:"jobId" gorm:"index"`
+	UniqueIdentifier string `json:"uniqueIdentifier"`
+	Due              int64  `json:"due"`   //计划执行时间，毫秒
+	Start            int64  `json:"start"` //实际执行时间，毫秒
+	Finish           int64  `json:"finish"`
+	Value            string `json:"value"`   //分时任务下发的值
+	Outcome          string `json:"outcome"` //参照global.go中的【控制结果】
+	Response         string `json:"response"`
+	Error            string `json:"error"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// LifecycleEvent 设备生命周期状态变化
+type LifecycleEvent struct {
+	DeviceId   string `json:"deviceId"`
+	Identifier string `json:"identifier"`
+	From       string `json:"from"` //参照global.go中的【生命周期状态】
+	To         string `json:"to"`
+	Reason     string `json:"reason"`
+	Time       int64  `json:"time"` //毫秒
+}
+
+// Lifecycle 设备当前的生命周期状态与最近的变化
+type Lifecycle struct {
+	State   string            `json:"state"`
+	Reason  string            `json:"reason"`
+	Since   int64             `json:"since"` //进入当前状态的时间，毫秒
+	History []*LifecycleEvent `json:"history"`
+}
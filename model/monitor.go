@@ -6,13 +6,41 @@ import (
 
 // 设备监控数据结构
 type DeviceMonitor struct {
-	ID                    int       `json:"id"`
-	Name                  string    `json:"name"`
-	Code                  string    `json:"code"`
-	TotalPoints           int       `json:"totalPoints"`
-	CurrentAlarmCount     int       `json:"currentAlarmCount"`
-	Status                string    `json:"status"`
-	LastCommunicationTime time.Time `json:"lastCommunicationTime"`
+	ID                    int             `json:"id"`
+	Name                  string          `json:"name"`
+	Code                  string          `json:"code"`
+	TotalPoints           int             `json:"totalPoints"`
+	CurrentAlarmCount     int             `json:"currentAlarmCount"`
+	Status                string          `json:"status"`
+	LastCommunicationTime time.Time       `json:"lastCommunicationTime"`
+	Channel               int             `json:"channel"`         //当前通道，0为主通道
+	ChannelAddress        string          `json:"channelAddress"`  //当前通道的连接地址
+	Reconnect             *ReconnectState `json:"reconnect"`       //重连状态
+	Pause                 *PauseState     `json:"pause"`           //暂停状态，没有暂停时为空
+	State                 string          `json:"state"`           //生命周期状态
+	PendingControls       int             `json:"pendingControls"` //等待下发的控制数量
+}
+
+// ReconnectState 设备的重连状态
+type ReconnectState struct {
+	State       string    `json:"state"`       //参照global.go中的【重连状态】
+	Attempts    int       `json:"attempts"`    //连续失败次数
+	LastError   string    `json:"lastError"`   //最后一次连接失败的原因
+	NextAttempt time.Time `json:"nextAttempt"` //下次重连时间
+	Since       time.Time `json:"since"`       //进入当前状态的时间
+}
+
+// GroupSchedule 采集组的调度情况
+type GroupSchedule struct {
+	Group    string    `json:"group"`    //功能码@起始地址
+	Points   int       `json:"points"`   //点位数量
+	Priority byte      `json:"priority"` //优先级
+	Interval int64     `json:"interval"` //采集间隔，毫秒
+	Polls    int64     `json:"polls"`    //采集次数
+	Overruns int64     `json:"overruns"` //错过整个采集周期的次数
+	LastLate int64     `json:"lastLate"` //最近一次采集相对计划的延迟，毫秒
+	LastPoll time.Time `json:"lastPoll"` //最近一次采集时间
+	NextDue  time.Time `json:"nextDue"`  //下次计划采集时间
 }
 
 // 告警详情数据结构
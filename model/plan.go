@@ -0,0 +1,24 @@
+package model
+
+// ReadPlan modbus设备的读取计划
+type ReadPlan struct {
+	DeviceId     string       `json:"deviceId"`
+	MaxGap       int          `json:"maxGap"` //允许跨过的未配置地址数量
+	MaxRegisters int          `json:"maxRegisters"`
+	MaxCoils     int          `json:"maxCoils"`
+	Points       int          `json:"points"`
+	Groups       []*ReadGroup `json:"groups"` //每组为一次读取请求
+}
+
+// ReadGroup 一次读取请求
+type ReadGroup struct {
+	FuncCode  byte     `json:"funcCode"`
+	Start     uint16   `json:"start"`
+	End       uint16   `json:"end"`
+	Quantity  uint16   `json:"quantity"`  //读取的数量
+	Addresses int      `json:"addresses"` //配置了点位的起始地址数量
+	Unused    int      `json:"unused"`    //合并时跨过的、没有点位占用的地址数量
+	Tags      []string `json:"tags"`
+	Interval  int      `json:"interval"` //采集规则的采集间隔，毫秒，0时按点位的采集间隔
+	Priority  byte     `json:"priority"`
+}
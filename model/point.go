@@ -15,18 +15,36 @@ type Point struct {
 	DataType       string  `json:"dataType"`     //数据类型
 	Tag            string  `json:"tag"`
 	LuaExpression  string  `json:"luaExpression"`  //lua表达式
+	InverseLua     string  `json:"inverseLua"`     //反向lua表达式，按点位写入时使用
 	Description    string  `json:"description"`    //描述
 	AlarmFlag      string  `json:"alarmFlag"`      //告警标志
 	AlarmLevel     string  `json:"alarmLevel"`     //告警等级
 	Multiplier     float64 `json:"multiplier"`     //倍率
 	Unit           string  `json:"unit"`           //单位
 	Priority       byte    `json:"priority"`       //优先级
-	Endianness     string  `json:"endianness"`     //大小端
+	Endianness     string  `json:"endianness"`     //字节序，参照global.go中的【字节序】
 	BitCalculation string  `json:"bitCalculation"` //bit位计算
 	StartBit       int     `json:"startBit"`       //起始bit
 	EndBit         int     `json:"endBit"`         //结束bit
 	StorageMethod  string  `json:"storageMethod"`  //存储方式，变存，直存
 	Offset         float64 `json:"offset"`         //偏移量
 	Store          int     `json:"store"`          //入库间隔秒
+	Interval       int     `json:"interval"`       //采集间隔，毫秒，0为默认值，同组点位取最小值
+	Sbo            bool    `json:"sbo"`            //写入前需要先选择
+	Length         int     `json:"length"`         //字符串占用的寄存器数量
+	Encoding       string  `json:"encoding"`       //字符串编码，参照global.go中的【字符串编码】，为空时为ascii
+	Trim           bool    `json:"trim"`           //去掉字符串两端的空格与结尾的\x00
+	ValueMap       string  `json:"valueMap"`       //值映射id，为空时不映射
 	DeviceID       string  `json:"deviceId"`       //设备id
 }
+
+// LuaError 点位lua表达式最近一次执行失败的信息，执行成功后清除
+type LuaError struct {
+	PointId    string `json:"pointId"`
+	DeviceId   string `json:"deviceId"`
+	Tag        string `json:"tag"`
+	Expression string `json:"expression"`
+	Error      string `json:"error"`
+	Count      int    `json:"count"` //连续失败次数
+	Time       int64  `json:"time"`  //最近一次失败的时间，毫秒
+}
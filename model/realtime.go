@@ -0,0 +1,18 @@
+package model
+
+// PointValue 点位的实时值
+type PointValue struct {
+	Tag     string      `json:"tag"`
+	Value   interface{} `json:"value"`           //工程值
+	Ts      int64       `json:"ts"`              //采集时间，毫秒
+	Quality string      `json:"quality"`         //参照global.go中的【数据质量】
+	Text    string      `json:"text,omitempty"`  //值映射后的文字，flags为置位的文字以逗号连接
+	Flags   []string    `json:"flags,omitempty"` //flags映射置位的文字
+}
+
+// StateValue 配置了值映射的点位在采集数据中的值
+type StateValue struct {
+	Value interface{} `json:"value"` //工程值
+	Text  string      `json:"text"`
+	Flags []string    `json:"flags,omitempty"`
+}
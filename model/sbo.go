@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Selection 选择后执行中的一次选择，执行或取消前其他请求方不能操作该点位
+type Selection struct {
+	Token     string    `json:"token"`
+	DeviceId  string    `json:"deviceId"`
+	Tag       string    `json:"tag"`
+	Value     float64   `json:"value"` //选择时的工程值，执行时下发
+	Requester string    `json:"requester"`
+	Selected  time.Time `json:"selected"`
+	Expires   time.Time `json:"expires"` //超过该时间没有执行时自动取消
+}
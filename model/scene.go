@@ -0,0 +1,68 @@
+package model
+
+import "encoding/json"
+
+// Scene 场景，按顺序执行的多设备控制步骤
+type Scene struct {
+	ID          string          `json:"id" gorm:"primaryKey"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Steps       json.RawMessage `json:"steps" gorm:"type:text"`    //[]SceneStep
+	Rollback    json.RawMessage `json:"rollback" gorm:"type:text"` //失败或中止时依次执行的回滚步骤，[]SceneStep
+}
+
+// SceneStep 场景的一个步骤
+type SceneStep struct {
+	Name      string          `json:"name"`      //步骤名称，分支跳转时使用
+	Kind      string          `json:"kind"`      //参照global.go中的【场景步骤类型】
+	DeviceId  string          `json:"deviceId"`  //write、waitUntil的设备
+	Cmd       json.RawMessage `json:"cmd"`       //write下发的命令，与command.OperateCmd相同
+	ReplySize int             `json:"replySize"` //write失败时的重试次数
+	Duration  int64           `json:"duration"`  //wait的等待时间，毫秒
+	Tag       string          `json:"tag"`       //waitUntil的点位
+	Value     float64         `json:"value"`     //waitUntil的目标值
+	Tolerance float64         `json:"tolerance"` //waitUntil允许的偏差
+	Timeout   int64           `json:"timeout"`   //waitUntil的超时时间，毫秒
+	Interval  int64           `json:"interval"`  //waitUntil的抄读间隔，毫秒，默认1000
+	Condition string          `json:"condition"` //branch的lua条件，与联锁表达式相同
+	Goto      string          `json:"goto"`      //branch条件成立时跳转的步骤，end为结束场景
+	Else      string          `json:"else"`      //branch条件不成立时跳转的步骤，为空时执行下一步
+}
+
+// SceneRun 场景的一次执行
+type SceneRun struct {
+	ID        uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	SceneId   string `json:"sceneId" gorm:"index"`
+	Requester string `json:"requester"`
+	Status    string `json:"status"` //参照global.go中的【场景执行状态】
+	Step      string `json:"step"`   //正在执行的步骤
+	Start     int64  `json:"start"`
+	Finish    int64  `json:"finish"`
+	Error     string `json:"error"`
+}
+
+// SceneStepResult 场景步骤的执行结果
+type SceneStepResult struct {
+	ID       uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	RunId    uint   `json:"runId" gorm:"index"`
+	Seq      int    `json:"seq"`   //执行顺序，分支跳转后同一步骤可能执行多次
+	Index    int    `json:"index"` //在步骤或回滚步骤中的序号
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Rollback bool   `json:"rollback"`
+	Start    int64  `json:"start"`
+	Finish   int64  `json:"finish"`
+	Outcome  string `json:"outcome"` //success或failed
+	Value    string `json:"value"`   //waitUntil最后读到的值，branch的条件结果
+	Response string `json:"response"`
+	Error    string `json:"error"`
+}
+
+// SceneEvent 场景执行的进度
+type SceneEvent struct {
+	RunId   uint             `json:"runId"`
+	SceneId string           `json:"sceneId"`
+	Status  string           `json:"status"`
+	Step    *SceneStepResult `json:"step,omitempty"` //刚完成的步骤，状态变化时为空
+	Time    int64            `json:"time"`
+}
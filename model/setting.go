@@ -0,0 +1,16 @@
+package model
+
+// Setting 系统运行参数，以键值形式保存
+type Setting struct {
+	Key   string `json:"key" gorm:"primaryKey"`
+	Value string `json:"value"`
+}
+
+// PauseState 暂停状态
+type PauseState struct {
+	Paused  bool   `json:"paused"`
+	Since   int64  `json:"since"`   //暂停时间，毫秒
+	Until   int64  `json:"until"`   //自动恢复时间，毫秒，0为不自动恢复
+	Reason  string `json:"reason"`  //暂停原因
+	Persist bool   `json:"persist"` //重启后保持暂停
+}
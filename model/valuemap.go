@@ -0,0 +1,10 @@
+package model
+
+// ValueMap 值映射，多个点位可以共用
+type ValueMap struct {
+	ID      string `json:"id" gorm:"primaryKey"`
+	Name    string `json:"name" gorm:"uniqueIndex"`
+	Kind    string `json:"kind"`    //参照global.go中的【值映射类型】
+	Entries string `json:"entries"` //enum为值=文字，flags为bit序号=文字，以逗号分隔，例如0=Stopped,1=Running,2=Fault
+	Default string `json:"default"` //enum没有对应的值时的文字，为空时为数值本身
+}
@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/snap"
+	"strings"
+)
+
+// 与linux的struct can_frame一致
+const (
+	canFrameSize = 16
+	canEffFlag   = 0x80000000 //扩展帧
+	canRtrFlag   = 0x40000000 //远程帧
+	canErrFlag   = 0x20000000 //错误帧
+	canSffMask   = 0x000007FF
+	canEffMask   = 0x1FFFFFFF
+)
+
+var CanErrorFrame = errors.New("can error frame")
+
+var _ ProtoConvener = (*CanRaw)(nil)
+
+func init() {
+	ProtoBuilder[global.CanRaw] = func(_ string) (ProtoConvener, error) {
+		return &CanRaw{}, nil
+	}
+}
+
+// 组装can_frame，id大于0x7FF时使用扩展帧
+func encodeCanFrame(cobId uint32, data []byte, rtr bool) []byte {
+	frame := make([]byte, canFrameSize)
+	id := cobId
+	if cobId > canSffMask {
+		id |= canEffFlag
+	}
+	if rtr {
+		id |= canRtrFlag
+	}
+	binary.NativeEndian.PutUint32(frame[0:4], id)
+	frame[4] = byte(len(data))
+	copy(frame[8:], data)
+	return frame
+}
+
+// 解析can_frame
+func decodeCanFrame(frame []byte) (cobId uint32, data []byte, err error) {
+	if len(frame) < canFrameSize {
+		return 0, nil, fmt.Errorf("invalid can frame size: %d", len(frame))
+	}
+	id := binary.NativeEndian.Uint32(frame[0:4])
+	if id&canErrFlag != 0 {
+		return 0, nil, CanErrorFrame
+	}
+	if id&canEffFlag != 0 {
+		cobId = id & canEffMask
+	} else {
+		cobId = id & canSffMask
+	}
+	dlc := int(frame[4])
+	if dlc > 8 {
+		dlc = 8
+	}
+	return cobId, frame[8 : 8+dlc], nil
+}
+
+func cobKey(cobId uint32) string {
+	return fmt.Sprintf("cob_%03x", cobId)
+}
+
+func canFrameString(cobId uint32, data []byte) string {
+	return fmt.Sprintf("%03X#%s", cobId, strings.ToUpper(hex.EncodeToString(data)))
+}
+
+// CanRaw 原始CAN帧
+type CanRaw struct {
+	cobId uint32
+	data  []byte
+	rtr   bool
+}
+
+func (c *CanRaw) Encode() ([]byte, error) {
+	if len(c.data) > 8 {
+		return nil, fmt.Errorf("can data too long: %d", len(c.data))
+	}
+	return encodeCanFrame(c.cobId, c.data, c.rtr), nil
+}
+
+func (c *CanRaw) Decode(reader *bufio.Reader) (string, []byte, error) {
+	frame := make([]byte, canFrameSize)
+	_, err := io.ReadFull(reader, frame)
+	if err != nil {
+		return "", nil, err
+	}
+	cobId, data, err := decodeCanFrame(frame)
+	if err != nil {
+		return "", nil, err
+	}
+	c.cobId = cobId
+	c.data = data
+	return canFrameString(cobId, data), data, nil
+}
+
+func (c *CanRaw) Opt(cmd *command.OperateCmd) (string, []byte, error) {
+	if cmd.FuncCode != command.CanFuncFrame {
+		return "", nil, fmt.Errorf("can raw func code error: %s", cmd.FuncCode)
+	}
+	cobId, err := cmd.CanCobId()
+	if err != nil {
+		return "", nil, err
+	}
+	c.cobId = cobId
+	c.data = nil
+	c.rtr = cmd.CmdType == global.CopyRead
+	if !c.rtr {
+		c.data, err = cmd.CanData()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	frame, err := c.Encode()
+	if err != nil || !c.rtr {
+		//数据帧没有应答
+		return "", frame, err
+	}
+	return c.Key(), frame, nil
+}
+
+func (c *CanRaw) BuildBySnap(s snap.PointSnap) (string, []byte, error) {
+	if s.FunctionCode()[0] != snap.CanFuncFrame {
+		return "", nil, fmt.Errorf("can raw unsupported snap func code: %d", s.FunctionCode()[0])
+	}
+	//被动接收，不需要发送
+	c.cobId = binary.BigEndian.Uint32(s.Address())
+	return c.Key(), nil, nil
+}
+
+func (c *CanRaw) CheckResp(_, _ []byte) error {
+	return nil
+}
+
+func (c *CanRaw) Key() string {
+	return cobKey(c.cobId)
+}
+
+func (c *CanRaw) Copy() ProtoConvener {
+	return &CanRaw{}
+}
@@ -0,0 +1,240 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/snap"
+	"strconv"
+)
+
+// CANopen预定义连接集
+const (
+	coNmt       uint32 = 0x000
+	coSdoTx     uint32 = 0x580 //节点->主站
+	coSdoRx     uint32 = 0x600 //主站->节点
+	coHeartbeat uint32 = 0x700
+)
+
+// SDO命令字
+const (
+	sdoUploadInit      byte = 0x40
+	sdoUploadSegment   byte = 0x60
+	sdoDownloadResp    byte = 0x60
+	sdoAbort           byte = 0x80
+	sdoToggle          byte = 0x10
+	sdoMaxSegmentBytes      = 4096 //分段上传的最大长度
+)
+
+// NMT节点状态
+const (
+	NmtBootUp         byte = 0x00
+	NmtStopped        byte = 0x04
+	NmtOperational    byte = 0x05
+	NmtPreOperational byte = 0x7F
+)
+
+var nmtCommands = map[string]byte{
+	command.CanNmtStart:     0x01,
+	command.CanNmtStop:      0x02,
+	command.CanNmtPreOp:     0x80,
+	command.CanNmtReset:     0x81,
+	command.CanNmtResetComm: 0x82,
+}
+
+var _ ProtoConvener = (*CANopen)(nil)
+var _ Segmented = (*CANopen)(nil)
+var _ NodeGuard = (*CANopen)(nil)
+
+func init() {
+	ProtoBuilder[global.CANopen] = func(id string) (ProtoConvener, error) {
+		nodeId, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		if nodeId < 1 || nodeId > 127 {
+			return nil, errors.New("invalid node id " + id)
+		}
+		return &CANopen{nodeId: byte(nodeId)}, nil
+	}
+}
+
+// CANopen 基于CAN的CANopen主站，SDO读写、PDO接收与NMT管理
+type CANopen struct {
+	nodeId byte
+	cobId  uint32
+	data   []byte
+	rtr    bool
+}
+
+func (c *CANopen) Encode() ([]byte, error) {
+	if len(c.data) > 8 {
+		return nil, fmt.Errorf("can data too long: %d", len(c.data))
+	}
+	return encodeCanFrame(c.cobId, c.data, c.rtr), nil
+}
+
+func (c *CANopen) Decode(reader *bufio.Reader) (string, []byte, error) {
+	frame := make([]byte, canFrameSize)
+	_, err := io.ReadFull(reader, frame)
+	if err != nil {
+		return "", nil, err
+	}
+	cobId, data, err := decodeCanFrame(frame)
+	if err != nil {
+		return "", nil, err
+	}
+	c.cobId = cobId
+	c.data = data
+	return canFrameString(cobId, data), data, nil
+}
+
+func (c *CANopen) Opt(cmd *command.OperateCmd) (string, []byte, error) {
+	c.rtr = false
+	switch cmd.FuncCode {
+	case command.CanFuncSdo:
+		index, sub, err := cmd.CanObject()
+		if err != nil {
+			return "", nil, err
+		}
+		c.cobId = coSdoRx + uint32(c.nodeId)
+		if cmd.CmdType == global.CopyRead {
+			c.data = []byte{sdoUploadInit, byte(index), byte(index >> 8), sub, 0, 0, 0, 0}
+		} else {
+			size, value, ve := cmd.CanSdoValue()
+			if ve != nil {
+				return "", nil, ve
+			}
+			//快速下载，e=1 s=1 n=4-size
+			cs := 0x23 | byte(4-size)<<2
+			c.data = []byte{cs, byte(index), byte(index >> 8), sub, 0, 0, 0, 0}
+			binary.LittleEndian.PutUint32(c.data[4:], value)
+		}
+		frame, err := c.Encode()
+		return c.sdoKey(), frame, err
+	case command.CanFuncNmt:
+		cs, ok := nmtCommands[cmd.Value["value"]]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid nmt command: %s", cmd.Value["value"])
+		}
+		c.cobId = coNmt
+		c.data = []byte{cs, c.nodeId}
+		frame, err := c.Encode()
+		//NMT没有应答
+		return "", frame, err
+	case command.CanFuncFrame:
+		raw := &CanRaw{}
+		return raw.Opt(cmd)
+	default:
+		return "", nil, fmt.Errorf("canopen func code error: %s", cmd.FuncCode)
+	}
+}
+
+func (c *CANopen) BuildBySnap(s snap.PointSnap) (string, []byte, error) {
+	c.rtr = false
+	switch s.FunctionCode()[0] {
+	case snap.CanFuncSdo:
+		addr := s.Address()
+		c.cobId = coSdoRx + uint32(c.nodeId)
+		c.data = []byte{sdoUploadInit, addr[1], addr[0], addr[2], 0, 0, 0, 0}
+		frame, err := c.Encode()
+		return c.sdoKey(), frame, err
+	case snap.CanFuncFrame:
+		//PDO被动接收，不需要发送
+		return cobKey(binary.BigEndian.Uint32(s.Address())), nil, nil
+	default:
+		return "", nil, fmt.Errorf("canopen unsupported snap func code: %d", s.FunctionCode()[0])
+	}
+}
+
+// Segment SDO的快速传输与分段上传
+func (c *CANopen) Segment(req, resp []byte) ([]byte, []byte, error) {
+	_, reqData, err := decodeCanFrame(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(reqData) < 1 || len(resp) < 8 {
+		return nil, nil, fmt.Errorf("invalid sdo frame size: %d", len(resp))
+	}
+	if resp[0] == sdoAbort {
+		return nil, nil, fmt.Errorf("sdo abort, index:0x%02x%02x sub:%d code:0x%08x", resp[2], resp[1], resp[3], binary.LittleEndian.Uint32(resp[4:8]))
+	}
+	switch reqData[0] & 0xE0 {
+	case sdoUploadInit:
+		if resp[0]&0xE0 != sdoUploadInit {
+			return nil, nil, fmt.Errorf("unexpected sdo response: 0x%02x", resp[0])
+		}
+		if resp[0]&0x02 != 0 {
+			//快速传输
+			n := 4
+			if resp[0]&0x01 != 0 {
+				n = 4 - int(resp[0]>>2&0x03)
+			}
+			return nil, resp[4 : 4+n], nil
+		}
+		if resp[0]&0x01 != 0 && binary.LittleEndian.Uint32(resp[4:8]) > sdoMaxSegmentBytes {
+			return nil, nil, fmt.Errorf("sdo object too large: %d", binary.LittleEndian.Uint32(resp[4:8]))
+		}
+		//分段上传，从toggle=0开始
+		return c.segmentFrame(sdoUploadSegment), nil, nil
+	case sdoUploadSegment:
+		if resp[0]&0xE0 != 0x00 {
+			return nil, nil, fmt.Errorf("unexpected sdo segment response: 0x%02x", resp[0])
+		}
+		if resp[0]&sdoToggle != reqData[0]&sdoToggle {
+			return nil, nil, errors.New("sdo toggle bit error")
+		}
+		n := 7 - int(resp[0]>>1&0x07)
+		data := resp[1 : 1+n]
+		if resp[0]&0x01 != 0 {
+			return nil, data, nil
+		}
+		return c.segmentFrame(sdoUploadSegment | (reqData[0]&sdoToggle ^ sdoToggle)), data, nil
+	case 0x20:
+		if resp[0] != sdoDownloadResp {
+			return nil, nil, fmt.Errorf("unexpected sdo download response: 0x%02x", resp[0])
+		}
+		return nil, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported sdo request: 0x%02x", reqData[0])
+	}
+}
+
+func (c *CANopen) segmentFrame(cs byte) []byte {
+	return encodeCanFrame(coSdoRx+uint32(c.nodeId), []byte{cs, 0, 0, 0, 0, 0, 0, 0}, false)
+}
+
+func (c *CANopen) StartFrame() []byte {
+	return encodeCanFrame(coNmt, []byte{nmtCommands[command.CanNmtStart], c.nodeId}, false)
+}
+
+func (c *CANopen) Heartbeat(key string, data []byte) (byte, bool) {
+	if key != cobKey(coHeartbeat+uint32(c.nodeId)) || len(data) < 1 {
+		return 0, false
+	}
+	return data[0] & 0x7F, true
+}
+
+func (c *CANopen) CheckResp(_, _ []byte) error {
+	return nil
+}
+
+func (c *CANopen) Key() string {
+	if c.cobId == coSdoTx+uint32(c.nodeId) {
+		return c.sdoKey()
+	}
+	return cobKey(c.cobId)
+}
+
+// 同一节点同一时间只有一个SDO传输
+func (c *CANopen) sdoKey() string {
+	return fmt.Sprintf("sdo_%d", c.nodeId)
+}
+
+func (c *CANopen) Copy() ProtoConvener {
+	return &CANopen{nodeId: c.nodeId}
+}
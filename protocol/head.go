@@ -16,6 +16,18 @@ type ProtoConvener interface {
 	Copy() ProtoConvener
 }
 
+// Segmented 需要多帧交互才能完成一次读写的规约，例如CANopen的SDO分段传输
+type Segmented interface {
+	// Segment 根据上一帧请求与本次回复给出下一帧请求，next为空表示传输完成，data为本次回复中的有效数据
+	Segment(req, resp []byte) (next []byte, data []byte, err error)
+}
+
+// NodeGuard 需要节点管理与心跳监督的规约，例如CANopen的NMT
+type NodeGuard interface {
+	StartFrame() []byte                             //链路建立后启动节点的报文
+	Heartbeat(key string, data []byte) (byte, bool) //判断是否为该节点的心跳，返回节点状态
+}
+
 type ProtoCreateFunc func(id string) (ProtoConvener, error)
 
 var ProtoBuilder = make(map[string]ProtoCreateFunc)
@@ -45,14 +45,15 @@ type ModbusRTU struct {
 	funcCode     byte
 	startAddress []byte
 	wData        []uint16
-	length       byte
+	length       byte   //回复的字节数，写多个寄存器时为数量
+	quantity     uint16 //读取的数量
 }
 
 func (m *ModbusRTU) Encode() ([]byte, error) {
 	frame := []byte{m.slaveId, m.funcCode}
 	frame = append(frame, m.startAddress...)
 	if m.funcCode == mrReadCoils || m.funcCode == mrReadDiscreteInputs || m.funcCode == mrReadHoldingRegisters || m.funcCode == mrReadInputRegisters {
-		frame = append(frame, 0, m.length)
+		frame = append(frame, byte(m.quantity>>8), byte(m.quantity))
 	} else if m.funcCode == mrWriteSingleCoil || m.funcCode == mrWriteSingleRegister {
 		frame = append(frame, byte(m.wData[0]>>8), byte(m.wData[0]))
 	} else if m.funcCode == mrWriteMultipleRegisters {
@@ -72,7 +73,7 @@ func (m *ModbusRTU) Encode() ([]byte, error) {
 				result[byteIndex] |= 1 << bitIndex
 			}
 		}
-		frame = append(frame, byte(len(result)))
+		frame = append(frame, byte(len(m.wData)>>8), byte(len(m.wData)), byte(len(result)))
 		frame = append(frame, result...)
 	}
 	frame = append(frame, m.cs(frame)...)
@@ -129,19 +130,16 @@ func (m *ModbusRTU) Decode(reader *bufio.Reader) (string, []byte, error) {
 			return "", nil, err
 		}
 		result = append(result, data...)
-	} else if m.funcCode == mrWriteSingleCoil {
-		m.startAddress = make([]byte, 2)
-		err = binary.Read(reader, binary.BigEndian, &m.startAddress)
-		if err != nil {
-			return "", nil, err
-		}
-		result = append(result, m.startAddress...)
-		data = make([]byte, 2)
+	} else if m.funcCode == mrWriteSingleCoil || m.funcCode == mrWriteSingleRegister || m.funcCode == mrWriteMultipleCoils || m.funcCode == mrWriteMultipleRegisters {
+		//写命令的回复：起始地址与写入值（单个）或数量（多个）
+		data = make([]byte, 4)
 		err = binary.Read(reader, binary.BigEndian, &data)
 		if err != nil {
 			return "", nil, err
 		}
-		m.wData = []uint16{binary.BigEndian.Uint16(data[:])}
+		result = append(result, data...)
+		m.startAddress = data[:2]
+		m.wData = []uint16{binary.BigEndian.Uint16(data[2:])}
 	} else {
 		return "", nil, fmt.Errorf("invalid modbus function code:%d", m.funcCode)
 	}
@@ -177,38 +175,70 @@ func (m *ModbusRTU) Opt(cmd *command.OperateCmd) (string, []byte, error) {
 			return "", nil, cre
 		}
 		m.startAddress = []byte{byte(startAddr >> 8), byte(startAddr)}
-		m.length = byte(addrLength)
+		m.quantity = addrLength
 		frame, encodeErr := m.Encode()
 		return m.Key(), frame, encodeErr
-	} else if fcByte == mrWriteSingleCoil {
-		address, mse := cmd.ModbusStartAddress()
-		if mse != nil {
-			return "", nil, mse
-		}
-		m.startAddress = []byte{byte(address >> 8), byte(address)}
+	}
+	address, mse := cmd.ModbusStartAddress()
+	if mse != nil {
+		return "", nil, mse
+	}
+	m.startAddress = []byte{byte(address >> 8), byte(address)}
+	switch fcByte {
+	case mrWriteSingleCoil, mrWriteSingleRegister:
 		value, msv := cmd.ModbusSingleValue()
 		if msv != nil {
 			return "", nil, msv
 		}
 		m.wData = []uint16{value}
-		frame, encodeErr := m.Encode()
-		return m.Key(), frame, encodeErr
-	} else {
+	case mrWriteMultipleCoils:
+		bits, mbe := cmd.ModbusBits()
+		if mbe != nil {
+			return "", nil, mbe
+		}
+		if len(bits) > 1968 {
+			return "", nil, fmt.Errorf("modbus rtu too many coils: %d", len(bits))
+		}
+		m.wData = bits
+	case mrWriteMultipleRegisters:
+		values, mve := cmd.ModbusMultipleValue()
+		if mve != nil {
+			return "", nil, mve
+		}
+		if len(values)/2 > 123 {
+			return "", nil, fmt.Errorf("modbus rtu too many registers: %d", len(values)/2)
+		}
+		m.wData = make([]uint16, len(values)/2)
+		for i := range m.wData {
+			m.wData[i] = binary.BigEndian.Uint16(values[i*2:])
+		}
+		m.length = byte(len(m.wData))
+	default:
 		return "", nil, errors.New("modbus rtu func code error")
 	}
+	frame, encodeErr := m.Encode()
+	return m.Key(), frame, encodeErr
 }
 
 func (m *ModbusRTU) BuildBySnap(snap snap.PointSnap) (string, []byte, error) {
 	m.funcCode = snap.FunctionCode()[0]
 	m.startAddress = snap.Address()
-	m.length = snap.Length()
+	m.quantity = snap.Length()
 	frame, err := m.Encode()
 	return m.Key(), frame, err
 }
 
 func (m *ModbusRTU) CheckResp(frame, resp []byte) error {
-	//TODO implement me
-	panic("implement me")
+	switch m.funcCode {
+	case mrWriteSingleCoil, mrWriteSingleRegister, mrWriteMultipleCoils, mrWriteMultipleRegisters:
+		//回复的起始地址与值（数量）需要与请求一致
+		if len(frame) >= 6 && len(resp) == 4 && string(frame[2:6]) == string(resp) {
+			return nil
+		}
+		return errors.New("modbus rtu resp error")
+	default:
+		return nil
+	}
 }
 
 func (m *ModbusRTU) Key() string {
@@ -176,7 +176,7 @@ func (m *ModbusTCP) nextTi() []byte {
 }
 
 func (m *ModbusTCP) BuildBySnap(snap snap.PointSnap) (string, []byte, error) {
-	return m.buildFrame(uint16(snap.Length()), snap.Address(), snap.FunctionCode()[0], m.nextTi(), nil)
+	return m.buildFrame(snap.Length(), snap.Address(), snap.FunctionCode()[0], m.nextTi(), nil)
 }
 
 func (m *ModbusTCP) buildFrame(length uint16, address []byte, funcCode byte, ti []byte, data []byte) (string, []byte, error) {
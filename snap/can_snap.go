@@ -0,0 +1,179 @@
+package snap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sentinels/global"
+	"sentinels/model"
+	"strconv"
+	"strings"
+)
+
+const (
+	CanFuncFrame byte = 0x01 //被动接收的帧，PDO或原始帧
+	CanFuncSdo   byte = 0x40 //SDO上传
+)
+
+var _ PointSnap = (*CanPointSnap)(nil)
+
+// ParseCanAddress 解析CAN点位地址，COB-ID形如0x181，对象字典形如0x6041:0x00
+func ParseCanAddress(address string) (cobId uint32, index uint16, subIndex byte, isObject bool, err error) {
+	address = strings.TrimSpace(address)
+	if idx, sub, found := strings.Cut(address, ":"); found {
+		i, ie := strconv.ParseUint(strings.TrimSpace(idx), 0, 16)
+		if ie != nil {
+			return 0, 0, 0, false, fmt.Errorf("invalid canopen index %s: %w", idx, ie)
+		}
+		s, se := strconv.ParseUint(strings.TrimSpace(sub), 0, 8)
+		if se != nil {
+			return 0, 0, 0, false, fmt.Errorf("invalid canopen subindex %s: %w", sub, se)
+		}
+		return 0, uint16(i), byte(s), true, nil
+	}
+	c, ce := strconv.ParseUint(address, 0, 32)
+	if ce != nil {
+		return 0, 0, 0, false, fmt.Errorf("invalid cob-id %s: %w", address, ce)
+	}
+	if c > 0x1FFFFFFF {
+		return 0, 0, 0, false, fmt.Errorf("cob-id too large: %s", address)
+	}
+	return uint32(c), 0, 0, false, nil
+}
+
+// CanDataSize 数据类型在CAN报文中占用的字节数
+func CanDataSize(dataType string) (int, error) {
+	switch dataType {
+	case global.DTBit, global.DTInt8, global.DTByte:
+		return 1, nil
+	case global.DTInt16, global.DTUint16:
+		return 2, nil
+	case global.DTInt32, global.DTUint32, global.DTFloat32:
+		return 4, nil
+	case global.DTInt64, global.DTUint64, global.DTFloat64:
+		return 8, nil
+	default:
+		return 0, fmt.Errorf("invalid point data type: %s", dataType)
+	}
+}
+
+// CanField 报文中的一个字段
+type CanField struct {
+	Offset int            //字节偏移
+	Points []*model.Point //同一位置上的点位
+}
+
+// CanPointSnap CAN点位快照
+// FuncCode为CanFuncFrame时按COB-ID被动接收，为CanFuncSdo时按index:subindex主动上传
+type CanPointSnap struct {
+	FuncCode byte
+	CobId    uint32
+	Index    uint16
+	SubIndex byte
+	Fields   []*CanField
+}
+
+func (c *CanPointSnap) Address() []byte {
+	if c.FuncCode == CanFuncSdo {
+		return []byte{byte(c.Index >> 8), byte(c.Index), c.SubIndex}
+	}
+	return []byte{byte(c.CobId >> 24), byte(c.CobId >> 16), byte(c.CobId >> 8), byte(c.CobId)}
+}
+
+func (c *CanPointSnap) Length() uint16 {
+	if c.FuncCode == CanFuncSdo {
+		return 0
+	}
+	return 8
+}
+
+func (c *CanPointSnap) FunctionCode() []byte {
+	return []byte{c.FuncCode}
+}
+
+func (c *CanPointSnap) String() string {
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+func (c *CanPointSnap) Point(key interface{}) ([]*model.Point, error) {
+	if offset, ok := key.(int); ok {
+		for _, field := range c.Fields {
+			if field.Offset == offset {
+				return field.Points, nil
+			}
+		}
+		return nil, nil
+	}
+	return nil, errors.New("invalid point key")
+}
+
+func (c *CanPointSnap) Parse(resp []byte) (map[string]interface{}, error) {
+	if len(resp) < 1 {
+		return nil, errors.New("invalid resp, it is empty")
+	}
+	result := make(map[string]interface{})
+	for _, field := range c.Fields {
+		for _, p := range field.Points {
+			value, err := c.flush(resp, field.Offset, p)
+			var luaErr *LuaPointError
+			if errors.As(err, &luaErr) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Tag, err)
+			}
+			result[p.Tag] = value
+		}
+	}
+	return result, nil
+}
+
+func (c *CanPointSnap) flush(resp []byte, offset int, p *model.Point) (interface{}, error) {
+	size, err := CanDataSize(p.DataType)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset+size > len(resp) {
+		return nil, fmt.Errorf("field out of range, offset:%d size:%d resp:%d", offset, size, len(resp))
+	}
+	//CAN报文默认为小端，统一转为大端处理
+	values := make([]byte, size)
+	copy(values, resp[offset:offset+size])
+	if p.Endianness != global.BigEndian {
+		for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+	var result float64
+	switch p.DataType {
+	case global.DTBit:
+		if p.StartBit < 0 || p.StartBit > 7 {
+			return nil, fmt.Errorf("start bit is too large (%d)", p.StartBit)
+		}
+		return int8((values[0] >> p.StartBit) & 1), nil
+	case global.DTInt8:
+		result = float64(int8(values[0]))
+	case global.DTByte:
+		result = float64(values[0])
+	case global.DTInt16:
+		result = float64(int16(binary.BigEndian.Uint16(values)))
+	case global.DTUint16:
+		result = float64(binary.BigEndian.Uint16(values))
+	case global.DTInt32:
+		result = float64(int32(binary.BigEndian.Uint32(values)))
+	case global.DTUint32:
+		result = float64(binary.BigEndian.Uint32(values))
+	case global.DTFloat32:
+		result = float64(math.Float32frombits(binary.BigEndian.Uint32(values)))
+	case global.DTInt64:
+		result = float64(int64(binary.BigEndian.Uint64(values)))
+	case global.DTUint64:
+		result = float64(binary.BigEndian.Uint64(values))
+	case global.DTFloat64:
+		result = math.Float64frombits(binary.BigEndian.Uint64(values))
+	}
+	return execNumber(p, result)
+}
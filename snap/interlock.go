@@ -0,0 +1,64 @@
+package snap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/gopher-lua"
+)
+
+// InterlockEnv 联锁表达式中可以使用的数据
+type InterlockEnv struct {
+	DeviceId string                                                                  //控制的设备
+	Tag      string                                                                  //控制的点位，不是按点位写入时为空
+	Write    *float64                                                                //写入的工程值，不是按点位写入时为空
+	Lookup   func(deviceId, tag string) (value interface{}, quality string, ok bool) //点位的实时值与质量
+}
+
+// EvalInterlock 执行联锁表达式，返回true时允许控制，与点位表达式使用相同的沙箱、状态池与编译缓存
+// 表达式中可以使用value(设备id, tag)、quality(设备id, tag)函数与device、tag、write变量，没有实时值时为nil
+func EvalInterlock(expr string, env *InterlockEnv) (bool, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return true, nil
+	}
+	result, err := sl.run("interlock:"+expr, expr, func(ls *lua.LState, t *lua.LTable) {
+		t.RawSetString("device", lua.LString(env.DeviceId))
+		t.RawSetString("tag", lua.LString(env.Tag))
+		if env.Write != nil {
+			t.RawSetString("write", lua.LNumber(*env.Write))
+		}
+		bindLookup(ls, t, env.Lookup)
+	})
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := result.(lua.LBool)
+	if !isBool {
+		return false, fmt.Errorf("expected boolean return value, got %s", result.Type())
+	}
+	return bool(ok), nil
+}
+
+func toLValue(value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case float64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int8:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case nil:
+		return lua.LNil
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
@@ -8,21 +8,41 @@ import (
 	"math"
 	"sentinels/global"
 	"sentinels/model"
+	"strings"
 )
 
 type ModbusPointSnap struct {
 	FuncCode     byte
-	Points       map[uint16][]*model.Point //多个点位时，这里面是连续的地址，单个点位时，这里面只有一个地址
+	Points       map[uint16][]*model.Point //按起始地址分组的点位，多寄存器的点位占用后面的地址
 	StartAddress uint16
-	EndAddress   uint16
-	Size         byte //多少个点位
+	EndAddress   uint16 //最后一个点位占用的最后一个地址
+	Size         uint16 //读取的数量，包含合并时跨过的地址
+}
+
+// RegisterWidth 点位占用的地址数量，线圈与离散输入每个地址一位，寄存器按数据类型占1~4个，字符串占length个（超过65535时按65535）
+func RegisterWidth(funcCode byte, p *model.Point) uint16 {
+	if funcCode == 0x01 || funcCode == 0x02 {
+		return 1
+	}
+	switch p.DataType {
+	case global.DTInt32, global.DTUint32, global.DTFloat32, global.DTBcd32, global.DTSm32, global.DTUnixTime32:
+		return 2
+	case global.DTUint48:
+		return 3
+	case global.DTInt64, global.DTUint64, global.DTFloat64, global.DTUnixTime64, global.DTCP56Time2a, global.DTDateAndTime:
+		return 4
+	case global.DTString:
+		return uint16(min(max(p.Length, 1), math.MaxUint16))
+	default:
+		return 1
+	}
 }
 
 func (m *ModbusPointSnap) Address() []byte {
 	return []byte{byte(m.StartAddress >> 8), byte(m.StartAddress)}
 }
 
-func (m *ModbusPointSnap) Length() byte {
+func (m *ModbusPointSnap) Length() uint16 {
 	return m.Size
 }
 
@@ -47,7 +67,9 @@ func (m *ModbusPointSnap) Parse(resp []byte) (map[string]interface{}, error) {
 		return nil, errors.New("invalid resp, it is empty")
 	}
 	result := make(map[string]interface{})
-	for index := m.StartAddress; index <= m.EndAddress; index++ {
+	//使用int避免结束地址为0xFFFF时循环溢出
+	for i := int(m.StartAddress); i <= int(m.EndAddress); i++ {
+		index := uint16(i)
 		points := m.Points[index]
 		var value interface{}
 		var err error
@@ -76,9 +98,23 @@ func (m *ModbusPointSnap) Parse(resp []byte) (map[string]interface{}, error) {
 				value, err = m.multipleFlushFloat32(resp, index, m.StartAddress, p)
 			case global.DTFloat64:
 				value, err = m.multipleFlushFloat64(resp, index, m.StartAddress, p)
+			case global.DTString:
+				value, err = m.flushString(resp, index, m.StartAddress, p)
+			case global.DTBcd16, global.DTBcd32:
+				value, err = m.flushBcd(resp, index, m.StartAddress, p)
+			case global.DTSm16, global.DTSm32:
+				value, err = m.flushSignMagnitude(resp, index, m.StartAddress, p)
+			case global.DTUint48:
+				value, err = m.flushUint48(resp, index, m.StartAddress, p)
+			case global.DTUnixTime32, global.DTUnixTime64, global.DTCP56Time2a, global.DTDateAndTime:
+				value, err = m.flushTime(resp, index, m.StartAddress, p)
 			default:
 				return nil, errors.New("invalid point data type")
 			}
+			var luaErr *LuaPointError
+			if errors.As(err, &luaErr) {
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -88,29 +124,21 @@ func (m *ModbusPointSnap) Parse(resp []byte) (map[string]interface{}, error) {
 	return result, nil
 }
 
+// 线圈与离散输入的回复已经由规约展开为每个地址一个字节
 func (m *ModbusPointSnap) bitFlush(resp []byte, index uint16, address uint16) (int8, error) {
-	var binaryStr string
-	for i := len(resp) - 1; i >= 0; i-- {
-		binaryStr += fmt.Sprintf("%08b", resp[i])
-	}
-	if binaryStr == "" {
+	i := int(index - address)
+	if i >= len(resp) {
 		return 0, errors.New("invalid point size")
 	}
-	//翻转数组
-	runes := []rune(binaryStr)
-	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		runes[i], runes[j] = runes[j], runes[i]
-	}
-	binaryStr = string(runes)
-	i := index - address
-	return int8(binaryStr[i]), nil
+	return int8(resp[i]), nil
 }
 
 func (m *ModbusPointSnap) multipleFlush(resp []byte, index, address uint16, endianness, bc string, size, startBit, endBit int) ([]byte, error) {
 	if startBit < 0 || endBit < 0 {
 		return nil, errors.New("invalid start bit or end bit")
 	}
-	in := int(index - address)
+	//每个寄存器两个字节
+	in := int(index-address) * 2
 	if in < 0 || in >= len(resp) {
 		return nil, errors.New("start index invalid point size")
 	}
@@ -118,14 +146,8 @@ func (m *ModbusPointSnap) multipleFlush(resp []byte, index, address uint16, endi
 	if en > len(resp) {
 		return nil, errors.New("end index invalid point size")
 	}
-	values := resp[in:en]
-	//大端小端
-	if endianness == global.LittleEndian {
-		//小端
-		for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
-			values[i], values[j] = values[j], values[i]
-		}
-	}
+	//转为大端，多个点位共用resp，不能原地修改
+	values := orderBytes(resp[in:en], endianness)
 	if bc == global.SingleBit {
 		//单bit
 		if startBit >= size*8 {
@@ -169,27 +191,58 @@ func (m *ModbusPointSnap) multipleFlush(resp []byte, index, address uint16, endi
 	}
 }
 
-func (m *ModbusPointSnap) execNumber(luaTemp string, value, multiplier, offset float64) (float64, error) {
+// 按字节序把寄存器中的字节转为大端顺序，返回新的切片，64位类型的CDAB为按字倒序
+// 这几种顺序转换两次都会还原，写入时使用同一个方法
+func orderBytes(values []byte, order string) []byte {
+	result := make([]byte, len(values))
+	switch strings.ToUpper(order) {
+	case global.LittleEndian, global.OrderDCBA:
+		for i := range values {
+			result[i] = values[len(values)-1-i]
+		}
+	case global.OrderCDAB:
+		words := len(values) / 2
+		for i := 0; i < words; i++ {
+			copy(result[i*2:i*2+2], values[(words-1-i)*2:])
+		}
+	case global.OrderBADC:
+		copy(result, values)
+		for i := 0; i+1 < len(values); i += 2 {
+			result[i], result[i+1] = values[i+1], values[i]
+		}
+	default:
+		copy(result, values)
+	}
+	return result
+}
+
+func (m *ModbusPointSnap) execNumber(p *model.Point, value float64) (float64, error) {
+	return execNumber(p, value)
+}
+
+// 依次执行lua表达式、倍率与偏移量
+func execNumber(p *model.Point, value float64) (float64, error) {
 	//lua
-	result, err := sl.execNumber(luaTemp, value)
+	result, err := sl.execNumber(p, p.LuaExpression, false, value)
 	if err != nil {
 		return 0, err
 	}
 	//倍率
-	if multiplier != 0 {
-		result = result * multiplier
+	if p.Multiplier != 0 {
+		result = result * p.Multiplier
 	}
 	//偏移量
-	return result - offset, nil
+	return result - p.Offset, nil
 }
 
+// int8与byte占一个寄存器，取低字节
 func (m *ModbusPointSnap) multipleFlushInt8(resp []byte, index uint16, address uint16, p *model.Point) (float64, error) {
-	values, err := m.multipleFlush(resp, index, address, p.Endianness, p.BitCalculation, 1, p.StartBit, p.EndBit)
+	values, err := m.multipleFlush(resp, index, address, p.Endianness, p.BitCalculation, 2, p.StartBit, p.EndBit)
 	if err != nil {
 		return 0, err
 	}
-	result := float64(int8(values[0]))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	result := float64(int8(values[1]))
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushInt16(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -198,7 +251,7 @@ func (m *ModbusPointSnap) multipleFlushInt16(resp []byte, index uint16, address
 		return 0, err
 	}
 	result := float64(int16(binary.BigEndian.Uint16(values)))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushInt32(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -207,7 +260,7 @@ func (m *ModbusPointSnap) multipleFlushInt32(resp []byte, index uint16, address
 		return 0, err
 	}
 	result := float64(int32(binary.BigEndian.Uint32(values)))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushInt64(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -216,16 +269,16 @@ func (m *ModbusPointSnap) multipleFlushInt64(resp []byte, index uint16, address
 		return 0, err
 	}
 	result := float64(int64(binary.BigEndian.Uint64(values)))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushByte(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
-	values, err := m.multipleFlush(resp, index, address, p.Endianness, p.BitCalculation, 1, p.StartBit, p.EndBit)
+	values, err := m.multipleFlush(resp, index, address, p.Endianness, p.BitCalculation, 2, p.StartBit, p.EndBit)
 	if err != nil {
 		return 0, err
 	}
-	result := float64(values[0])
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	result := float64(values[1])
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushUint16(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -234,7 +287,7 @@ func (m *ModbusPointSnap) multipleFlushUint16(resp []byte, index uint16, address
 		return 0, err
 	}
 	result := float64(binary.BigEndian.Uint16(values))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushUint32(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -243,7 +296,7 @@ func (m *ModbusPointSnap) multipleFlushUint32(resp []byte, index uint16, address
 		return 0, err
 	}
 	result := float64(binary.BigEndian.Uint32(values))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushUint64(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -252,7 +305,7 @@ func (m *ModbusPointSnap) multipleFlushUint64(resp []byte, index uint16, address
 		return 0, err
 	}
 	result := float64(binary.BigEndian.Uint64(values))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushFloat32(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -261,7 +314,7 @@ func (m *ModbusPointSnap) multipleFlushFloat32(resp []byte, index uint16, addres
 		return 0, err
 	}
 	result := float64(math.Float32frombits(binary.BigEndian.Uint32(values)))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
 
 func (m *ModbusPointSnap) multipleFlushFloat64(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
@@ -270,5 +323,5 @@ func (m *ModbusPointSnap) multipleFlushFloat64(resp []byte, index uint16, addres
 		return 0, err
 	}
 	result := math.Float64frombits(binary.BigEndian.Uint64(values))
-	return m.execNumber(p.LuaExpression, result, p.Multiplier, p.Offset)
+	return m.execNumber(p, result)
 }
@@ -0,0 +1,131 @@
+package snap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sentinels/global"
+	"sentinels/model"
+	"testing"
+	"time"
+)
+
+func TestOrderBytes(t *testing.T) {
+	in := []byte{0xA, 0xB, 0xC, 0xD}
+	cases := map[string][]byte{
+		global.BigEndian:    {0xA, 0xB, 0xC, 0xD},
+		global.OrderABCD:    {0xA, 0xB, 0xC, 0xD},
+		"":                  {0xA, 0xB, 0xC, 0xD},
+		global.LittleEndian: {0xD, 0xC, 0xB, 0xA},
+		global.OrderDCBA:    {0xD, 0xC, 0xB, 0xA},
+		global.OrderCDAB:    {0xC, 0xD, 0xA, 0xB},
+		global.OrderBADC:    {0xB, 0xA, 0xD, 0xC},
+		"cdab":              {0xC, 0xD, 0xA, 0xB},
+	}
+	for order, want := range cases {
+		got := orderBytes(in, order)
+		if !bytes.Equal(got, want) {
+			t.Errorf("%q: got % x, want % x", order, got, want)
+		}
+		//转换两次还原，写入与解析使用同一个方法
+		if back := orderBytes(got, order); !bytes.Equal(back, in) {
+			t.Errorf("%q: not an involution, got % x", order, back)
+		}
+	}
+	//64位的CDAB按字倒序
+	got := orderBytes([]byte{1, 2, 3, 4, 5, 6, 7, 8}, global.OrderCDAB)
+	if want := []byte{7, 8, 5, 6, 3, 4, 1, 2}; !bytes.Equal(got, want) {
+		t.Errorf("64-bit CDAB: got % x, want % x", got, want)
+	}
+	if in[0] != 0xA || in[3] != 0xD {
+		t.Error("input modified in place")
+	}
+}
+
+func TestEncodeRegistersRange(t *testing.T) {
+	for dataType, value := range map[string]float64{
+		global.DTUint16: -1,
+		global.DTInt16:  32768,
+		global.DTInt8:   -129,
+		global.DTByte:   256,
+	} {
+		p := &model.Point{Tag: "R", DataType: dataType}
+		if _, err := encodeRegisters(p, value); err == nil {
+			t.Errorf("%s %v: expected range error", dataType, value)
+		}
+	}
+	if _, err := encodeRegisters(&model.Point{Tag: "S", DataType: global.DTString}, 1); err == nil {
+		t.Error("string should not be writable")
+	}
+}
+
+// 编码后的寄存器按相同的点位配置解析，返回解析得到的值
+func roundTrip(t *testing.T, dataType, order string, value float64) interface{} {
+	t.Helper()
+	p := &model.Point{Tag: "V", DataType: dataType, Endianness: order}
+	registers, err := encodeRegisters(p, value)
+	if err != nil {
+		t.Fatalf("%s %s %v: %v", dataType, order, value, err)
+	}
+	resp := make([]byte, 0, len(registers)*2)
+	for _, r := range registers {
+		resp = binary.BigEndian.AppendUint16(resp, r)
+	}
+	ms := &ModbusPointSnap{
+		FuncCode:   0x03,
+		Points:     map[uint16][]*model.Point{0: {p}},
+		EndAddress: RegisterWidth(0x03, p) - 1,
+	}
+	result, err := ms.Parse(resp)
+	if err != nil {
+		t.Fatalf("%s %s %v: %v", dataType, order, value, err)
+	}
+	return result["V"]
+}
+
+var testOrders = []string{global.BigEndian, global.LittleEndian, global.OrderCDAB, global.OrderBADC}
+
+func TestEncodeRegistersRoundTrip(t *testing.T) {
+	values := map[string][]float64{
+		global.DTInt16:   {-32768, -1, 0, 32767},
+		global.DTUint16:  {0, 65535},
+		global.DTInt32:   {-2147483648, -7, 2147483647},
+		global.DTUint32:  {0, 4294967295},
+		global.DTFloat32: {-1.5, 0, 3.25},
+		global.DTFloat64: {-1e100, 0.1, 12345.6789},
+		global.DTInt64:   {-1 << 53, 1 << 53},
+	}
+	for dataType, list := range values {
+		for _, order := range testOrders {
+			for _, value := range list {
+				if got := roundTrip(t, dataType, order, value); got != value {
+					t.Errorf("%s %s: wrote %v, read %v", dataType, order, value, got)
+				}
+			}
+		}
+	}
+}
+
+// 结束地址为0xFFFF时解析正常结束，不会循环溢出
+func TestParseLastAddress(t *testing.T) {
+	p := &model.Point{Tag: "LAST", DataType: global.DTUint16}
+	ms := &ModbusPointSnap{
+		FuncCode:     0x03,
+		Points:       map[uint16][]*model.Point{0xFFFF: {p}},
+		StartAddress: 0xFFFE,
+		EndAddress:   0xFFFF,
+		Size:         2,
+	}
+	done := make(chan map[string]interface{}, 1)
+	go func() {
+		result, _ := ms.Parse([]byte{0x00, 0x01, 0x00, 0x2A})
+		done <- result
+	}()
+	select {
+	case result := <-done:
+		if result["LAST"] != 42.0 {
+			t.Errorf("got %v", result["LAST"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("parse did not finish")
+	}
+}
@@ -0,0 +1,169 @@
+package snap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sentinels/global"
+	"sentinels/model"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// 字符串，字节序只影响字内顺序（BADC为字内交换）
+func (m *ModbusPointSnap) flushString(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
+	if p.Length <= 0 {
+		return nil, fmt.Errorf("point %s: string needs length", p.Tag)
+	}
+	values, err := m.multipleFlush(resp, index, address, p.Endianness, "", p.Length*2, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var result string
+	switch p.Encoding {
+	case "", global.EncodingAscii:
+		result = string(values)
+	case global.EncodingUtf16:
+		units := make([]uint16, len(values)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(values[i*2:])
+		}
+		result = string(utf16.Decode(units))
+	default:
+		return nil, fmt.Errorf("point %s: unsupported encoding %s", p.Tag, p.Encoding)
+	}
+	if p.Trim {
+		result = strings.TrimSpace(strings.TrimRight(result, "\x00"))
+	}
+	return result, nil
+}
+
+// BCD，每4位表示一位十进制数
+func (m *ModbusPointSnap) flushBcd(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
+	size := 2
+	if p.DataType == global.DTBcd32 {
+		size = 4
+	}
+	values, err := m.multipleFlush(resp, index, address, p.Endianness, p.BitCalculation, size, p.StartBit, p.EndBit)
+	if err != nil {
+		return nil, err
+	}
+	result, err := bcd(values)
+	if err != nil {
+		return nil, fmt.Errorf("point %s: %w", p.Tag, err)
+	}
+	return m.execNumber(p, float64(result))
+}
+
+func bcd(values []byte) (uint64, error) {
+	var result uint64
+	for _, b := range values {
+		hi, lo := b>>4, b&0x0F
+		if hi > 9 || lo > 9 {
+			return 0, fmt.Errorf("invalid bcd byte 0x%02x", b)
+		}
+		result = result*100 + uint64(hi)*10 + uint64(lo)
+	}
+	return result, nil
+}
+
+// 原码，最高位为符号，其余为绝对值
+func (m *ModbusPointSnap) flushSignMagnitude(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
+	size := 2
+	if p.DataType == global.DTSm32 {
+		size = 4
+	}
+	values, err := m.multipleFlush(resp, index, address, p.Endianness, p.BitCalculation, size, p.StartBit, p.EndBit)
+	if err != nil {
+		return nil, err
+	}
+	var result float64
+	if size == 2 {
+		v := binary.BigEndian.Uint16(values)
+		result = float64(v & 0x7FFF)
+		if v&0x8000 != 0 {
+			result = -result
+		}
+	} else {
+		v := binary.BigEndian.Uint32(values)
+		result = float64(v & 0x7FFFFFFF)
+		if v&0x80000000 != 0 {
+			result = -result
+		}
+	}
+	return m.execNumber(p, result)
+}
+
+// 48位计数器，占3个寄存器
+func (m *ModbusPointSnap) flushUint48(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
+	values, err := m.multipleFlush(resp, index, address, p.Endianness, p.BitCalculation, 6, p.StartBit, p.EndBit)
+	if err != nil {
+		return nil, err
+	}
+	result := binary.BigEndian.Uint64(append([]byte{0, 0}, values...))
+	return m.execNumber(p, float64(result))
+}
+
+// 时间类型统一返回毫秒时间戳，不执行lua、倍率与偏移量
+func (m *ModbusPointSnap) flushTime(resp []byte, index uint16, address uint16, p *model.Point) (interface{}, error) {
+	size := 8
+	if p.DataType == global.DTUnixTime32 {
+		size = 4
+	}
+	values, err := m.multipleFlush(resp, index, address, p.Endianness, "", size, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var t time.Time
+	switch p.DataType {
+	case global.DTUnixTime32:
+		return int64(binary.BigEndian.Uint32(values)) * 1000, nil
+	case global.DTUnixTime64:
+		return int64(binary.BigEndian.Uint64(values)), nil
+	case global.DTCP56Time2a:
+		t, err = cp56Time2a(values)
+	default:
+		t, err = dateAndTime(values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("point %s: %w", p.Tag, err)
+	}
+	return t.UnixMilli(), nil
+}
+
+// CP56Time2a：毫秒（2字节，低字节在前）、分、时、日与星期、月、年（2000年起），按本地时间
+func cp56Time2a(b []byte) (time.Time, error) {
+	ms := int(b[0]) | int(b[1])<<8
+	minute, hour := int(b[2]&0x3F), int(b[3]&0x1F)
+	day, month, year := int(b[4]&0x1F), int(b[5]&0x0F), int(b[6]&0x7F)+2000
+	if ms > 59999 || minute > 59 || hour > 23 || day < 1 || month < 1 || month > 12 {
+		return time.Time{}, errors.New("invalid cp56time2a")
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, ms/1000, ms%1000*int(time.Millisecond), time.Local), nil
+}
+
+// DATE_AND_TIME：年（90~99为19xx）、月、日、时、分、秒、毫秒的高两位，最后一个字节高4位为毫秒的个位、低4位为星期
+func dateAndTime(b []byte) (time.Time, error) {
+	fields := make([]int, 7)
+	for i := range fields {
+		v, err := bcd(b[i : i+1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		fields[i] = int(v)
+	}
+	if b[7]>>4 > 9 {
+		return time.Time{}, fmt.Errorf("invalid bcd byte 0x%02x", b[7])
+	}
+	year := fields[0] + 2000
+	if fields[0] >= 90 {
+		year = fields[0] + 1900
+	}
+	ms := fields[6]*10 + int(b[7]>>4)
+	month, day, hour, minute, second := fields[1], fields[2], fields[3], fields[4], fields[5]
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, errors.New("invalid date and time")
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, ms*int(time.Millisecond), time.Local), nil
+}
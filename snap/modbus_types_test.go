@@ -0,0 +1,73 @@
+package snap
+
+import (
+	"bytes"
+	"sentinels/global"
+	"sentinels/model"
+	"testing"
+)
+
+func TestEncodePacked(t *testing.T) {
+	cases := []struct {
+		dataType string
+		n        int64
+		want     []byte
+	}{
+		{global.DTBcd16, 1234, []byte{0x12, 0x34}},
+		{global.DTBcd16, 7, []byte{0x00, 0x07}},
+		{global.DTBcd32, 12345678, []byte{0x12, 0x34, 0x56, 0x78}},
+		{global.DTSm16, 5, []byte{0x00, 0x05}},
+		{global.DTSm16, -5, []byte{0x80, 0x05}},
+		{global.DTSm32, -0x1234, []byte{0x80, 0x00, 0x12, 0x34}},
+		{global.DTUint48, 0x0102030405, []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05}},
+		{global.DTUint48, 1<<48 - 1, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	}
+	for _, c := range cases {
+		if got := encodePacked(c.dataType, c.n); !bytes.Equal(got, c.want) {
+			t.Errorf("%s %d: got % x, want % x", c.dataType, c.n, got, c.want)
+		}
+	}
+}
+
+func TestPackedRange(t *testing.T) {
+	for dataType, value := range map[string]float64{
+		global.DTBcd16:  10000,
+		global.DTBcd32:  -1,
+		global.DTSm16:   -32768,
+		global.DTSm32:   1 << 31,
+		global.DTUint48: 1 << 48,
+	} {
+		p := &model.Point{Tag: "R", DataType: dataType}
+		if _, err := encodeRegisters(p, value); err == nil {
+			t.Errorf("%s %v: expected range error", dataType, value)
+		}
+	}
+}
+
+func TestPackedRoundTrip(t *testing.T) {
+	values := map[string][]float64{
+		global.DTBcd16:  {0, 1234, 9999},
+		global.DTBcd32:  {0, 12345678, 99999999},
+		global.DTSm16:   {-32767, -1, 0, 32767},
+		global.DTSm32:   {-2147483647, -100000, 2147483647},
+		global.DTUint48: {0, 0x0102030405, 1<<48 - 1},
+	}
+	for dataType, list := range values {
+		for _, order := range testOrders {
+			for _, value := range list {
+				if got := roundTrip(t, dataType, order, value); got != value {
+					t.Errorf("%s %s: wrote %v, read %v", dataType, order, value, got)
+				}
+			}
+		}
+	}
+}
+
+func TestBcdInvalid(t *testing.T) {
+	if _, err := bcd([]byte{0x12, 0x3A}); err == nil {
+		t.Error("expected invalid bcd error")
+	}
+	if v, err := bcd([]byte{0x09, 0x87}); err != nil || v != 987 {
+		t.Errorf("got %v %v", v, err)
+	}
+}
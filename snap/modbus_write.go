@@ -0,0 +1,187 @@
+package snap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sentinels/global"
+	"sentinels/model"
+	"strconv"
+	"strings"
+)
+
+var ReadOnlyPointError = errors.New("point is read only")
+
+// EncodeModbusWrite 把点位的工程值换算为原始值，返回写入的功能码、起始地址与寄存器值
+func EncodeModbusWrite(p *model.Point, value float64) (byte, uint16, []uint16, error) {
+	fc, err := strconv.ParseUint(strings.TrimSpace(p.FunctionCode), 0, 8)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("point %s func code error: %w", p.Tag, err)
+	}
+	address, err := strconv.ParseUint(strings.TrimSpace(p.Address), 0, 16)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("point %s address error: %w", p.Tag, err)
+	}
+	if p.BitCalculation == global.SingleBit || p.BitCalculation == global.MultipleBit {
+		return 0, 0, nil, fmt.Errorf("point %s: writing bits of a register is not supported", p.Tag)
+	}
+	raw, err := reverseNumber(p, value)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	switch byte(fc) {
+	case 0x02, 0x04:
+		//离散输入与输入寄存器
+		return 0, 0, nil, fmt.Errorf("%w: %s func code 0x%02x", ReadOnlyPointError, p.Tag, fc)
+	case 0x01:
+		if raw != 0 && raw != 1 {
+			return 0, 0, nil, fmt.Errorf("point %s: coil value must be 0 or 1, got %v", p.Tag, raw)
+		}
+		var coil uint16
+		if raw == 1 {
+			coil = 0xFF00
+		}
+		return 0x05, uint16(address), []uint16{coil}, nil
+	case 0x03:
+		registers, ee := encodeRegisters(p, raw)
+		if ee != nil {
+			return 0, 0, nil, ee
+		}
+		if len(registers) == 1 {
+			return 0x06, uint16(address), registers, nil
+		}
+		return 0x10, uint16(address), registers, nil
+	default:
+		return 0, 0, nil, fmt.Errorf("point %s: unsupported func code 0x%02x", p.Tag, fc)
+	}
+}
+
+// 依次反算偏移量、倍率与lua表达式，与execNumber相反
+func reverseNumber(p *model.Point, value float64) (float64, error) {
+	result := value + p.Offset
+	if p.Multiplier != 0 {
+		result = result / p.Multiplier
+	}
+	if strings.TrimSpace(p.LuaExpression) == "" {
+		return result, nil
+	}
+	if strings.TrimSpace(p.InverseLua) == "" {
+		return 0, fmt.Errorf("point %s has lua expression but no inverse lua", p.Tag)
+	}
+	return sl.execNumber(p, p.InverseLua, true, result)
+}
+
+// 整数类型的取值范围
+var integerRanges = map[string][2]float64{
+	global.DTInt8:   {math.MinInt8, math.MaxInt8},
+	global.DTByte:   {0, math.MaxUint8},
+	global.DTInt16:  {math.MinInt16, math.MaxInt16},
+	global.DTUint16: {0, math.MaxUint16},
+	global.DTInt32:  {math.MinInt32, math.MaxInt32},
+	global.DTUint32: {0, math.MaxUint32},
+	global.DTInt64:  {math.MinInt64, math.MaxInt64},
+	global.DTUint64: {0, math.MaxUint64},
+	global.DTBcd16:  {0, 9999},
+	global.DTBcd32:  {0, 99999999},
+	global.DTSm16:   {-math.MaxInt16, math.MaxInt16},
+	global.DTSm32:   {-math.MaxInt32, math.MaxInt32},
+	global.DTUint48: {0, 1<<48 - 1},
+}
+
+// 按数据类型与大小端编码为寄存器，int8、byte占一个寄存器
+func encodeRegisters(p *model.Point, raw float64) ([]uint16, error) {
+	var values []byte
+	switch p.DataType {
+	case global.DTFloat32:
+		values = binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(raw)))
+	case global.DTFloat64:
+		values = binary.BigEndian.AppendUint64(nil, math.Float64bits(raw))
+	case global.DTInt8, global.DTByte, global.DTInt16, global.DTUint16:
+		n, err := integer(p, raw)
+		if err != nil {
+			return nil, err
+		}
+		values = binary.BigEndian.AppendUint16(nil, uint16(int64(n)))
+	case global.DTInt32, global.DTUint32:
+		n, err := integer(p, raw)
+		if err != nil {
+			return nil, err
+		}
+		values = binary.BigEndian.AppendUint32(nil, uint32(int64(n)))
+	case global.DTInt64:
+		n, err := integer(p, raw)
+		if err != nil {
+			return nil, err
+		}
+		values = binary.BigEndian.AppendUint64(nil, uint64(int64(n)))
+	case global.DTUint64:
+		n, err := integer(p, raw)
+		if err != nil {
+			return nil, err
+		}
+		values = binary.BigEndian.AppendUint64(nil, uint64(n))
+	case global.DTBcd16, global.DTBcd32, global.DTSm16, global.DTSm32, global.DTUint48:
+		n, err := integer(p, raw)
+		if err != nil {
+			return nil, err
+		}
+		values = encodePacked(p.DataType, int64(n))
+	default:
+		return nil, fmt.Errorf("point %s: data type %s can not be written", p.Tag, p.DataType)
+	}
+	//与解析时使用相同的字节序转换
+	values = orderBytes(values, p.Endianness)
+	registers := make([]uint16, len(values)/2)
+	for i := range registers {
+		registers[i] = binary.BigEndian.Uint16(values[i*2:])
+	}
+	return registers, nil
+}
+
+// 四舍五入并检查范围，64位整数以float64表示时精度有限
+func integer(p *model.Point, raw float64) (float64, error) {
+	n := math.Round(raw)
+	limit := integerRanges[p.DataType]
+	if n < limit[0] || n >= limit[1]+1 {
+		return 0, fmt.Errorf("point %s: value %v out of %s range", p.Tag, raw, p.DataType)
+	}
+	return n, nil
+}
+
+// BCD、原码与48位计数器的大端编码，n已经检查过范围
+func encodePacked(dataType string, n int64) []byte {
+	switch dataType {
+	case global.DTBcd16, global.DTBcd32:
+		values := make([]byte, 2)
+		if dataType == global.DTBcd32 {
+			values = make([]byte, 4)
+		}
+		for i := len(values) - 1; i >= 0; i-- {
+			values[i] = byte(n%10) | byte(n/10%10)<<4
+			n /= 100
+		}
+		return values
+	case global.DTSm16:
+		v := uint16(abs(n))
+		if n < 0 {
+			v |= 0x8000
+		}
+		return binary.BigEndian.AppendUint16(nil, v)
+	case global.DTSm32:
+		v := uint32(abs(n))
+		if n < 0 {
+			v |= 0x80000000
+		}
+		return binary.BigEndian.AppendUint32(nil, v)
+	default:
+		return binary.BigEndian.AppendUint64(nil, uint64(n))[2:]
+	}
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
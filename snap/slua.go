@@ -1,61 +1,346 @@
 package snap
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sentinels/global"
+	"sentinels/model"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
 )
 
-var sl *sLua
+const (
+	luaPoolSize      = 16       //池中保留的空闲lua状态数量，超过时关闭
+	luaCallStack     = 64       //调用栈深度上限
+	luaRegistryLimit = 64 << 10 //寄存器栈上限
+)
 
-func init() {
-	sl = &sLua{needLock: false, lst: lua.NewState()}
-}
+// 沙箱中可以使用的基础函数，不包括_G、rawset、setmetatable、getmetatable等可以修改共享表的函数
+var luaSafe = []string{"assert", "error", "ipairs", "next", "pairs", "pcall", "rawequal", "rawget", "select",
+	"tonumber", "tostring", "type", "unpack", "xpcall", "_VERSION"}
+
+// 沙箱中以只读方式提供的库
+var luaLibs = []string{lua.MathLibName, lua.StringLibName, lua.TabLibName}
 
+var sl = &sLua{states: make(chan *luaState, luaPoolSize), protos: make(map[string]*luaProto), errs: make(map[string]*model.LuaError)}
+
+// sLua lua表达式引擎，多个设备并发执行时每次从池中取出一个状态
 type sLua struct {
-	needLock bool
-	lst      *lua.LState
-	lock     sync.Mutex
+	states chan *luaState
+	lock   sync.RWMutex
+	protos map[string]*luaProto //编译结果，key为点位id，反向表达式加上#inverse
+	errLk  sync.Mutex
+	errs   map[string]*model.LuaError
+}
+
+type luaState struct {
+	ls   *lua.LState
+	meta *lua.LTable //每次执行的环境表的元表，读取时回退到只读的沙箱表
+}
+
+// luaProto 编译后的表达式，source变化时重新编译
+type luaProto struct {
+	source string
+	proto  *lua.FunctionProto
+	err    error
+}
+
+// 打开基础库与允许使用的库
+func openLibs(ls *lua.LState) {
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{{lua.BaseLibName, lua.OpenBase}, {lua.MathLibName, lua.OpenMath}, {lua.StringLibName, lua.OpenString}, {lua.TabLibName, lua.OpenTable}} {
+		ls.Push(ls.NewFunction(lib.open))
+		ls.Push(lua.LString(lib.name))
+		ls.Call(1, 0)
+	}
+}
+
+// 只读的代理表，读取时回退到target，写入时报错，getmetatable取不到元表
+func readOnly(ls *lua.LState, target *lua.LTable) *lua.LTable {
+	proxy := ls.NewTable()
+	meta := ls.NewTable()
+	meta.RawSetString("__index", target)
+	meta.RawSetString("__newindex", ls.NewFunction(func(l *lua.LState) int {
+		l.RaiseError("attempt to modify a read-only table")
+		return 0
+	}))
+	meta.RawSetString("__metatable", lua.LFalse)
+	ls.SetMetatable(proxy, meta)
+	return proxy
+}
+
+// 创建沙箱状态，脚本只能通过环境表的元表读取只读的沙箱表，不能访问全局表与库的原表
+func newLuaState() *luaState {
+	ls := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: luaCallStack, RegistryMaxSize: luaRegistryLimit})
+	openLibs(ls)
+	sandbox := ls.NewTable()
+	for _, name := range luaSafe {
+		sandbox.RawSetString(name, ls.GetGlobal(name))
+	}
+	for _, name := range luaLibs {
+		if lib, ok := ls.GetGlobal(name).(*lua.LTable); ok {
+			sandbox.RawSetString(name, readOnly(ls, lib))
+		}
+	}
+	meta := ls.NewTable()
+	meta.RawSetString("__index", readOnly(ls, sandbox))
+	meta.RawSetString("__metatable", lua.LFalse)
+	return &luaState{ls: ls, meta: meta}
+}
+
+func (s *sLua) get() *luaState {
+	select {
+	case st := <-s.states:
+		return st
+	default:
+		return newLuaState()
+	}
+}
+
+func (s *sLua) put(st *luaState) {
+	st.ls.SetTop(0)
+	select {
+	case s.states <- st:
+	default:
+		st.ls.Close()
+	}
+}
+
+// CompileLua 编译lua表达式，只检查语法，保存点位时使用
+func CompileLua(source string) error {
+	_, err := compileLua(source)
+	return err
+}
+
+// 先按表达式编译，不是表达式时按语句块编译，语句块需要自己return
+func compileLua(source string) (*lua.FunctionProto, error) {
+	source = strings.TrimSpace(source)
+	chunk, err := parse.Parse(strings.NewReader("return "+source), "<expression>")
+	if err != nil {
+		var serr error
+		if chunk, serr = parse.Parse(strings.NewReader(source), "<expression>"); serr != nil {
+			return nil, fmt.Errorf("lua syntax error: %s", strings.TrimSpace(err.Error()))
+		}
+	}
+	return lua.Compile(chunk, "<expression>")
 }
 
-func (s *sLua) close() {
-	s.lst.Close()
+// 按点位缓存编译结果，表达式修改后重新编译
+func (s *sLua) compile(key, source string) (*lua.FunctionProto, error) {
+	s.lock.RLock()
+	p, ok := s.protos[key]
+	s.lock.RUnlock()
+	if ok && p.source == source {
+		return p.proto, p.err
+	}
+	p = &luaProto{source: source}
+	p.proto, p.err = compileLua(source)
+	s.lock.Lock()
+	s.protos[key] = p
+	s.lock.Unlock()
+	return p.proto, p.err
 }
 
-func (s *sLua) execNumber(luaTemp string, value float64) (float64, error) {
-	luaTemp = strings.TrimSpace(luaTemp)
-	if luaTemp == "" {
+// 执行点位的lua表达式，value为表达式中的value变量，每次执行使用独立的环境，全局变量不会带到下一次
+func (s *sLua) execNumber(p *model.Point, source string, inverse bool, value float64) (float64, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
 		return value, nil
 	}
-	if s.needLock {
-		s.lock.Lock()
-		defer s.lock.Unlock()
+	key := p.ID
+	if key == "" {
+		key = p.DeviceID + "/" + p.Tag
 	}
-	// 设置全局变量
-	s.lst.SetGlobal("value", lua.LNumber(value))
-	// 确保有return语句
-	if !strings.HasPrefix(luaTemp, "return ") {
-		luaTemp = "return " + luaTemp
+	if inverse {
+		key += "#inverse"
 	}
-	// 执行Lua代码
-	err := s.lst.DoString(luaTemp)
+	result, err := s.call(key, source, func(ls *lua.LState, env *lua.LTable) {
+		env.RawSetString("value", lua.LNumber(value))
+	})
+	s.report(p, key, source, err)
 	if err != nil {
-		return 0, fmt.Errorf("lua execution error: %w", err)
+		return 0, &LuaPointError{Tag: p.Tag, Err: err}
 	}
-	// 检查栈顶是否有返回值
-	top := s.lst.GetTop()
-	if top == 0 {
-		return 0, errors.New("no return value from lua expression")
+	return result, nil
+}
+
+// 执行编译后的表达式并返回数值
+func (s *sLua) call(key, source string, bind func(ls *lua.LState, env *lua.LTable)) (float64, error) {
+	luaValue, err := s.run(key, source, bind)
+	if err != nil {
+		return 0, err
 	}
-	// 获取返回值
-	luaValue := s.lst.Get(-1) // 获取栈顶元素
-	s.lst.Pop(1)              // 清理栈
 	// 类型检查并转换
 	if num, ok := luaValue.(lua.LNumber); ok {
 		return float64(num), nil
 	}
-	return 0, fmt.Errorf("expected number return value, got %T", luaValue)
+	if luaValue == lua.LNil {
+		return 0, errors.New("no return value from lua expression")
+	}
+	return 0, fmt.Errorf("expected number return value, got %s", luaValue.Type())
+}
+
+// 执行编译后的表达式，bind设置本次执行的变量与函数，返回第一个返回值
+func (s *sLua) run(key, source string, bind func(ls *lua.LState, env *lua.LTable)) (lua.LValue, error) {
+	proto, err := s.compile(key, source)
+	if err != nil {
+		return nil, err
+	}
+	st := s.get()
+	env := st.ls.NewTable()
+	st.ls.SetMetatable(env, st.meta)
+	bind(st.ls, env)
+	fn := st.ls.NewFunctionFromProto(proto)
+	fn.Env = env
+	timeout := luaTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	st.ls.SetContext(ctx)
+	st.ls.Push(fn)
+	err = st.ls.PCall(0, 1, nil)
+	st.ls.RemoveContext()
+	if err != nil && ctx.Err() != nil {
+		// 超时中断的状态不再放回池中
+		st.ls.Close()
+		return nil, fmt.Errorf("lua execution timeout after %s", timeout)
+	}
+	defer s.put(st)
+	if err != nil {
+		// 只保留错误信息，不带调用栈
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) && apiErr.Object != nil {
+			return nil, fmt.Errorf("lua execution error: %s", apiErr.Object.String())
+		}
+		return nil, fmt.Errorf("lua execution error: %w", err)
+	}
+	return st.ls.Get(-1), nil
+}
+
+// 单次执行的最长时间，配置不大于0时使用默认值
+func luaTimeout() time.Duration {
+	return luaTimeoutOf(global.Config.LuaTimeout)
+}
+
+func luaTimeoutOf(ms int) time.Duration {
+	if ms <= 0 {
+		return global.DefaultLuaTimeout
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// 记录点位最近一次的lua错误，执行成功时清除
+func (s *sLua) report(p *model.Point, key, source string, err error) {
+	s.errLk.Lock()
+	defer s.errLk.Unlock()
+	last, ok := s.errs[key]
+	if err == nil {
+		if ok {
+			delete(s.errs, key)
+		}
+		return
+	}
+	if ok && last.Error == err.Error() {
+		last.Count++
+		last.Time = time.Now().UnixMilli()
+		return
+	}
+	global.SystemLog.Warnf("device %s point %s lua error: %s", p.DeviceID, p.Tag, err.Error())
+	s.errs[key] = &model.LuaError{PointId: p.ID, DeviceId: p.DeviceID, Tag: p.Tag, Expression: source,
+		Error: err.Error(), Count: 1, Time: time.Now().UnixMilli()}
+}
+
+// EvalVirtual 计算虚拟点位，表达式中使用value(设备id, tag)、quality(设备id, tag)读取其他点位的实时值，没有实时值时为nil
+// 计算结果同样执行倍率与偏移量，错误按点位记录
+func EvalVirtual(p *model.Point, lookup func(deviceId, tag string) (value interface{}, quality string, ok bool)) (float64, error) {
+	source := strings.TrimSpace(p.LuaExpression)
+	if source == "" {
+		return 0, &LuaPointError{Tag: p.Tag, Err: errors.New("lua expression is empty")}
+	}
+	result, err := sl.call(p.ID, source, func(ls *lua.LState, env *lua.LTable) {
+		bindLookup(ls, env, lookup)
+	})
+	sl.report(p, p.ID, source, err)
+	if err != nil {
+		return 0, &LuaPointError{Tag: p.Tag, Err: err}
+	}
+	if p.Multiplier != 0 {
+		result = result * p.Multiplier
+	}
+	return result - p.Offset, nil
+}
+
+// 设置value(设备id, tag)、quality(设备id, tag)函数，没有实时值时返回nil
+func bindLookup(ls *lua.LState, env *lua.LTable, lookup func(deviceId, tag string) (interface{}, string, bool)) {
+	env.RawSetString("value", ls.NewFunction(func(l *lua.LState) int {
+		value, _, ok := lookup(l.CheckString(1), l.CheckString(2))
+		if !ok {
+			l.Push(lua.LNil)
+			return 1
+		}
+		l.Push(toLValue(value))
+		return 1
+	}))
+	env.RawSetString("quality", ls.NewFunction(func(l *lua.LState) int {
+		_, quality, ok := lookup(l.CheckString(1), l.CheckString(2))
+		if !ok {
+			l.Push(lua.LNil)
+			return 1
+		}
+		l.Push(lua.LString(quality))
+		return 1
+	}))
+}
+
+// LuaErrors 当前执行失败的lua表达式，deviceId为空时返回所有设备
+func LuaErrors(deviceId string) []*model.LuaError {
+	sl.errLk.Lock()
+	defer sl.errLk.Unlock()
+	result := make([]*model.LuaError, 0, len(sl.errs))
+	for _, e := range sl.errs {
+		if deviceId == "" || e.DeviceId == deviceId {
+			c := *e
+			result = append(result, &c)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DeviceId != result[j].DeviceId {
+			return result[i].DeviceId < result[j].DeviceId
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result
+}
+
+// ForgetLua 删除点位时清除编译缓存与错误记录
+func ForgetLua(pointId string) {
+	for _, key := range []string{pointId, pointId + "#inverse"} {
+		sl.lock.Lock()
+		delete(sl.protos, key)
+		sl.lock.Unlock()
+		sl.errLk.Lock()
+		delete(sl.errs, key)
+		sl.errLk.Unlock()
+	}
+}
+
+// LuaPointError 点位的lua表达式执行失败，解析时跳过该点位，不影响同一次读取的其他点位
+type LuaPointError struct {
+	Tag string
+	Err error
+}
+
+func (e *LuaPointError) Error() string {
+	return fmt.Sprintf("point %s: %s", e.Tag, e.Err.Error())
+}
+
+func (e *LuaPointError) Unwrap() error {
+	return e.Err
 }
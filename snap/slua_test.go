@@ -0,0 +1,61 @@
+package snap
+
+import (
+	"sentinels/global"
+	"sentinels/model"
+	"testing"
+	"time"
+)
+
+func TestLuaSandboxIsolation(t *testing.T) {
+	p := &model.Point{ID: "sandbox", Tag: "S"}
+	for _, src := range []string{
+		"string.format = nil; return 1",
+		"math.floor = nil; return 1",
+		"_G.math = nil; return 1",
+		"rawset(string, 'format', nil); return 1",
+		"setmetatable({}, {}); return 1",
+		"getmetatable('').__index.format = nil; return 1",
+	} {
+		if _, err := sl.execNumber(p, src, false, 0); err == nil {
+			t.Errorf("%q: expected error", src)
+		}
+	}
+	//全局变量只在本次执行中有效，库不受上面的脚本影响
+	if _, err := sl.execNumber(p, "math = nil; string = nil; return 1", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < luaPoolSize*2; i++ {
+		v, err := sl.execNumber(p, "return tonumber(string.format('%d', math.floor(value)))", false, 7.9)
+		if err != nil || v != 7 {
+			t.Fatalf("shared libs corrupted: %v %v", v, err)
+		}
+	}
+}
+
+func TestLuaTimeoutFallback(t *testing.T) {
+	for ms, want := range map[int]time.Duration{
+		0:   global.DefaultLuaTimeout,
+		-5:  global.DefaultLuaTimeout,
+		20:  20 * time.Millisecond,
+		500: 500 * time.Millisecond,
+	} {
+		if got := luaTimeoutOf(ms); got != want {
+			t.Errorf("%d: got %v, want %v", ms, got, want)
+		}
+	}
+}
+
+func TestLuaTimeoutInterrupt(t *testing.T) {
+	if luaTimeout() > 2*time.Second {
+		t.Skip("configured lua timeout too long for this test")
+	}
+	p := &model.Point{ID: "timeout", Tag: "T"}
+	if _, err := sl.execNumber(p, "while true do end", false, 0); err == nil {
+		t.Fatal("expected timeout")
+	}
+	//超时的状态不放回池中，之后的执行不受影响
+	if v, err := sl.execNumber(p, "value * 2", false, 3); err != nil || v != 6 {
+		t.Fatalf("after timeout: %v %v", v, err)
+	}
+}
@@ -6,7 +6,7 @@ var _ PointSnap = (*ModbusPointSnap)(nil)
 
 type PointSnap interface {
 	Address() []byte //地址
-	Length() byte    //数量
+	Length() uint16  //数量
 	FunctionCode() []byte
 	String() string
 	Point(key interface{}) ([]*model.Point, error)
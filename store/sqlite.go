@@ -46,6 +46,41 @@ func init() {
 		global.SystemLog.Errorf("sqlite Collect migrate err:%s", err.Error())
 		os.Exit(1)
 	}
+	err = db.AutoMigrate(&model.Channel{})
+	if err != nil {
+		global.SystemLog.Errorf("sqlite Channel migrate err:%s", err.Error())
+		os.Exit(1)
+	}
+	err = db.AutoMigrate(&model.ControlAudit{})
+	if err != nil {
+		global.SystemLog.Errorf("sqlite ControlAudit migrate err:%s", err.Error())
+		os.Exit(1)
+	}
+	err = db.AutoMigrate(&model.Setting{})
+	if err != nil {
+		global.SystemLog.Errorf("sqlite Setting migrate err:%s", err.Error())
+		os.Exit(1)
+	}
+	err = db.AutoMigrate(&model.Interlock{})
+	if err != nil {
+		global.SystemLog.Errorf("sqlite Interlock migrate err:%s", err.Error())
+		os.Exit(1)
+	}
+	err = db.AutoMigrate(&model.ControlJob{}, &model.JobRun{})
+	if err != nil {
+		global.SystemLog.Errorf("sqlite ControlJob migrate err:%s", err.Error())
+		os.Exit(1)
+	}
+	err = db.AutoMigrate(&model.Scene{}, &model.SceneRun{}, &model.SceneStepResult{})
+	if err != nil {
+		global.SystemLog.Errorf("sqlite Scene migrate err:%s", err.Error())
+		os.Exit(1)
+	}
+	err = db.AutoMigrate(&model.ValueMap{})
+	if err != nil {
+		global.SystemLog.Errorf("sqlite ValueMap migrate err:%s", err.Error())
+		os.Exit(1)
+	}
 }
 
 func (s *SqliteClient) SelectAllDevice() []*model.Device {
@@ -101,6 +136,9 @@ func (s *SqliteClient) DeleteDevice(id string) error {
 	if err == nil {
 		err = s.db.Delete(&model.Point{}, "device_id = ?", id).Error
 	}
+	if err == nil {
+		err = s.db.Delete(&model.Channel{}, "device_id = ?", id).Error
+	}
 	return err
 }
 
@@ -193,3 +231,333 @@ func (s *SqliteClient) SelectPointsByDeviceId(id string) []*model.Point {
 	_ = s.db.Find(&points, "device_id = ?", id)
 	return points
 }
+
+func (s *SqliteClient) SelectPointByTag(deviceId string, tag string) (*model.Point, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var point *model.Point
+	err := s.db.First(&point, "device_id = ? AND tag = ?", deviceId, tag).Error
+	return point, err
+}
+
+func (s *SqliteClient) SelectChannelsByDeviceId(deviceId string) ([]*model.Channel, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	channels := make([]*model.Channel, 0)
+	err := s.db.Order("sort").Find(&channels, "device_id = ?", deviceId).Error
+	return channels, err
+}
+
+func (s *SqliteClient) SaveChannel(m *model.Channel) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if strings.TrimSpace(m.ID) == "" {
+		m.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return s.db.Save(m).Error
+}
+
+func (s *SqliteClient) DeleteChannel(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Where("id = ?", id).Delete(&model.Channel{}).Error
+}
+
+// SelectSetting 查询运行参数，不存在时返回空字符串
+func (s *SqliteClient) SelectSetting(key string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var setting model.Setting
+	err := s.db.Limit(1).Find(&setting, "key = ?", key).Error
+	if err != nil {
+		return ""
+	}
+	return setting.Value
+}
+
+func (s *SqliteClient) SaveSetting(key string, value string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Save(&model.Setting{Key: key, Value: value}).Error
+}
+
+func (s *SqliteClient) DeleteSetting(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Where("key = ?", key).Delete(&model.Setting{}).Error
+}
+
+func (s *SqliteClient) SaveControlAudit(m *model.ControlAudit) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Create(m).Error
+}
+
+// SelectAuditByUid 查询指定时间之后首次执行成功的审计记录
+func (s *SqliteClient) SelectAuditByUid(uid string, since int64) (*model.ControlAudit, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var audits []*model.ControlAudit
+	err := s.db.Where("unique_identifier = ? AND create_time >= ? AND outcome = ?", uid, since, global.OutcomeSuccess).
+		Order("id").Limit(1).Find(&audits).Error
+	if err != nil || len(audits) == 0 {
+		return nil, err
+	}
+	return audits[0], nil
+}
+
+func (s *SqliteClient) SelectControlAudits(q *model.AuditQuery) (int, []*model.ControlAudit, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	query := s.db.Model(&model.ControlAudit{})
+	if q.DeviceId != "" {
+		query = query.Where("device_id = ?", q.DeviceId)
+	}
+	if q.Requester != "" {
+		query = query.Where("requester = ?", q.Requester)
+	}
+	if q.UniqueIdentifier != "" {
+		query = query.Where("unique_identifier = ?", q.UniqueIdentifier)
+	}
+	if q.Outcome != "" {
+		query = query.Where("outcome = ?", q.Outcome)
+	}
+	if q.From > 0 {
+		query = query.Where("create_time >= ?", q.From)
+	}
+	if q.To > 0 {
+		query = query.Where("create_time <= ?", q.To)
+	}
+	var totalCount int64
+	err := query.Count(&totalCount).Error
+	if err != nil {
+		return 0, nil, err
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = 20
+	}
+	audits := make([]*model.ControlAudit, 0)
+	err = query.Order("id DESC").Limit(q.PageSize).Offset((q.Page - 1) * q.PageSize).Find(&audits).Error
+	return int(totalCount), audits, err
+}
+
+// SelectInterlocks 查询联锁规则，deviceId为空时查询所有
+func (s *SqliteClient) SelectInterlocks(deviceId string) ([]*model.Interlock, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	interlocks := make([]*model.Interlock, 0)
+	query := s.db.Order("id")
+	if deviceId != "" {
+		query = query.Where("device_id = ?", deviceId)
+	}
+	err := query.Find(&interlocks).Error
+	return interlocks, err
+}
+
+func (s *SqliteClient) SaveInterlock(m *model.Interlock) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if strings.TrimSpace(m.ID) == "" {
+		m.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return s.db.Save(m).Error
+}
+
+func (s *SqliteClient) DeleteInterlock(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Where("id = ?", id).Delete(&model.Interlock{}).Error
+}
+
+func (s *SqliteClient) SelectJobs() ([]*model.ControlJob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	jobs := make([]*model.ControlJob, 0)
+	err := s.db.Order("id").Find(&jobs).Error
+	return jobs, err
+}
+
+func (s *SqliteClient) SelectJobById(id string) (*model.ControlJob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var job *model.ControlJob
+	err := s.db.First(&job, "id = ?", id).Error
+	return job, err
+}
+
+func (s *SqliteClient) SaveJob(m *model.ControlJob) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if strings.TrimSpace(m.ID) == "" {
+		m.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return s.db.Save(m).Error
+}
+
+// UpdateJobRun 只更新执行状态，不覆盖同时修改的任务配置与启用状态
+func (s *SqliteClient) UpdateJobRun(m *model.ControlJob) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Model(&model.ControlJob{}).Where("id = ?", m.ID).Updates(map[string]interface{}{
+		"last_run":     m.LastRun,
+		"last_outcome": m.LastOutcome,
+		"next_run":     m.NextRun,
+	}).Error
+}
+
+func (s *SqliteClient) DeleteJob(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.db.Where("id = ?", id).Delete(&model.ControlJob{}).Error
+	if err != nil {
+		return err
+	}
+	return s.db.Where("job_id = ?", id).Delete(&model.JobRun{}).Error
+}
+
+func (s *SqliteClient) SaveJobRun(m *model.JobRun) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Create(m).Error
+}
+
+// SelectJobRuns 任务最近的执行记录
+func (s *SqliteClient) SelectJobRuns(jobId string, limit int) ([]*model.JobRun, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	runs := make([]*model.JobRun, 0)
+	err := s.db.Where("job_id = ?", jobId).Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+func (s *SqliteClient) SelectScenes() ([]*model.Scene, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	scenes := make([]*model.Scene, 0)
+	err := s.db.Order("id").Find(&scenes).Error
+	return scenes, err
+}
+
+func (s *SqliteClient) SelectSceneById(id string) (*model.Scene, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var scene *model.Scene
+	err := s.db.First(&scene, "id = ?", id).Error
+	return scene, err
+}
+
+func (s *SqliteClient) SaveScene(m *model.Scene) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if strings.TrimSpace(m.ID) == "" {
+		m.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return s.db.Save(m).Error
+}
+
+// DeleteScene 删除场景与执行记录
+func (s *SqliteClient) DeleteScene(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).Delete(&model.Scene{}).Error; err != nil {
+			return err
+		}
+		runs := tx.Model(&model.SceneRun{}).Select("id").Where("scene_id = ?", id)
+		if err := tx.Where("run_id IN (?)", runs).Delete(&model.SceneStepResult{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("scene_id = ?", id).Delete(&model.SceneRun{}).Error
+	})
+}
+
+func (s *SqliteClient) SaveSceneRun(m *model.SceneRun) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Save(m).Error
+}
+
+func (s *SqliteClient) SaveSceneStep(m *model.SceneStepResult) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Create(m).Error
+}
+
+// SelectSceneRuns 场景最近的执行记录
+func (s *SqliteClient) SelectSceneRuns(sceneId string, limit int) ([]*model.SceneRun, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	runs := make([]*model.SceneRun, 0)
+	err := s.db.Where("scene_id = ?", sceneId).Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+func (s *SqliteClient) SelectSceneRunById(id uint) (*model.SceneRun, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var run *model.SceneRun
+	err := s.db.First(&run, "id = ?", id).Error
+	return run, err
+}
+
+// SelectSceneSteps 一次执行的步骤结果，按执行顺序
+func (s *SqliteClient) SelectSceneSteps(runId uint) ([]*model.SceneStepResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	steps := make([]*model.SceneStepResult, 0)
+	err := s.db.Where("run_id = ?", runId).Order("seq").Find(&steps).Error
+	return steps, err
+}
+
+// InterruptSceneRuns 重启前没有执行完的场景标记为失败
+func (s *SqliteClient) InterruptSceneRuns() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Model(&model.SceneRun{}).Where("status = ?", global.SceneRunning).Updates(map[string]interface{}{
+		"status": global.SceneFailed,
+		"finish": time.Now().UnixMilli(),
+		"error":  "interrupted by restart",
+	}).Error
+}
+
+func (s *SqliteClient) SelectValueMaps() ([]*model.ValueMap, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	maps := make([]*model.ValueMap, 0)
+	err := s.db.Order("name").Find(&maps).Error
+	return maps, err
+}
+
+func (s *SqliteClient) SelectValueMapByName(name string) (*model.ValueMap, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var m *model.ValueMap
+	err := s.db.First(&m, "name = ?", name).Error
+	return m, err
+}
+
+func (s *SqliteClient) SaveValueMap(m *model.ValueMap) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if strings.TrimSpace(m.ID) == "" {
+		m.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return s.db.Save(m).Error
+}
+
+// DeleteValueMap 删除值映射，仍有点位使用时拒绝删除
+func (s *SqliteClient) DeleteValueMap(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var count int64
+	if err := s.db.Model(&model.Point{}).Where("value_map = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("value map %s is used by %d points", id, count)
+	}
+	return s.db.Where("id = ?", id).Delete(&model.ValueMap{}).Error
+}
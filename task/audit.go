@@ -0,0 +1,133 @@
+package task
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"sync"
+	"time"
+)
+
+// 根据载体创建审计记录
+func newAudit(opt *command.ControlCarrier) *model.ControlAudit {
+	signType, sign := opt.ObtainSign()
+	audit := &model.ControlAudit{
+		UniqueIdentifier: opt.UniqueIdentifier(),
+		Requester:        opt.Requester(),
+		SignType:         signType,
+		Sign:             sign,
+		SendTime:         opt.SendTime(),
+		CreateTime:       time.Now().UnixMilli(),
+	}
+	if opt.Cmd != nil {
+		audit.CmdType = opt.Cmd.CmdType
+		audit.FuncCode = opt.Cmd.FuncCode
+		value, _ := json.Marshal(opt.Cmd.Value)
+		audit.Value = string(value)
+	}
+	if signType == global.LogoTypeId {
+		audit.DeviceId = sign
+	}
+	return audit
+}
+
+// 记录执行结果并保存，保存失败不影响控制结果
+func finishAudit(audit *model.ControlAudit, opt *command.ControlCarrier, resp []byte, err error) {
+	audit.FinishTime = time.Now().UnixMilli()
+	audit.Response = hex.EncodeToString(resp)
+	if opt.Cmd != nil && len(opt.Cmd.Frame()) > 0 {
+		audit.Frame = hex.EncodeToString(opt.Cmd.Frame())
+	}
+	if err != nil {
+		audit.Error = err.Error()
+	}
+	if audit.Outcome == "" {
+		audit.Outcome = global.OutcomeFailed
+	}
+	se := store.DbClient.SaveControlAudit(audit)
+	if se != nil {
+		global.SystemLog.Errorf("save control audit %s err:%s", audit.UniqueIdentifier, se.Error())
+	}
+}
+
+// dedupEntry 一个唯一标识的执行结果
+type dedupEntry struct {
+	done chan struct{}
+	resp []byte
+	err  error
+	time time.Time
+}
+
+func (e *dedupEntry) wait() ([]byte, error) {
+	<-e.done
+	return e.resp, e.err
+}
+
+// deduplicator 按唯一标识去重，相同标识的命令执行中或执行成功后在窗口内只执行一次，失败的命令可以重新下发
+type deduplicator struct {
+	lock    sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+func newDeduplicator() *deduplicator {
+	return &deduplicator{entries: make(map[string]*dedupEntry)}
+}
+
+func dedupWindow() time.Duration {
+	return time.Duration(global.Config.DedupWindow) * time.Second
+}
+
+// 开始执行，返回的first为false时说明是重复的命令
+func (d *deduplicator) begin(uid string) (*dedupEntry, bool) {
+	return d.beginAt(uid, time.Now(), dedupWindow())
+}
+
+// 按指定的时间与去重窗口开始执行
+func (d *deduplicator) beginAt(uid string, now time.Time, window time.Duration) (*dedupEntry, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	//清理过期的记录
+	for key, entry := range d.entries {
+		if now.Sub(entry.time) > window {
+			select {
+			case <-entry.done:
+				delete(d.entries, key)
+			default:
+			}
+		}
+	}
+	if entry, ok := d.entries[uid]; ok && window > 0 {
+		return entry, false
+	}
+	entry := &dedupEntry{done: make(chan struct{}), time: now}
+	if window <= 0 {
+		return entry, true
+	}
+	//重启前执行成功的命令
+	if audit, err := store.DbClient.SelectAuditByUid(uid, now.Add(-window).UnixMilli()); err == nil && audit != nil {
+		entry.time = time.UnixMilli(audit.CreateTime)
+		entry.resp, _ = hex.DecodeString(audit.Response)
+		close(entry.done)
+		d.entries[uid] = entry
+		return entry, false
+	}
+	d.entries[uid] = entry
+	return entry, true
+}
+
+// 执行结束，等待中的重复命令得到相同的结果，执行失败时移除记录
+func (d *deduplicator) finish(uid string, entry *dedupEntry, resp []byte, err error) {
+	entry.resp, entry.err = resp, err
+	close(entry.done)
+	if err == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.entries[uid] == entry {
+		delete(d.entries, uid)
+	}
+}
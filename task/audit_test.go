@@ -0,0 +1,82 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDedupConcurrent(t *testing.T) {
+	d := newDeduplicator()
+	uid := "test-" + newToken()
+	now := time.Now()
+	entry, first := d.beginAt(uid, now, time.Minute)
+	if !first {
+		t.Fatal("first command should be executed")
+	}
+	//执行中的重复命令等待第一次的结果
+	results := make(chan []byte, 3)
+	for i := 0; i < 3; i++ {
+		dup, first := d.beginAt(uid, now, time.Minute)
+		if first || dup != entry {
+			t.Fatal("duplicate should share the in-flight entry")
+		}
+		go func() {
+			resp, _ := dup.wait()
+			results <- resp
+		}()
+	}
+	select {
+	case <-results:
+		t.Fatal("duplicate returned before the first command finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	want := []byte{0x01, 0x06, 0x00, 0x01}
+	d.finish(uid, entry, want, nil)
+	for i := 0; i < 3; i++ {
+		if resp := <-results; !bytes.Equal(resp, want) {
+			t.Errorf("got %x, want %x", resp, want)
+		}
+	}
+	//执行成功后在窗口内仍然去重
+	if dup, first := d.beginAt(uid, now.Add(time.Second), time.Minute); first || dup != entry {
+		t.Error("succeeded command should be deduplicated within the window")
+	}
+}
+
+func TestDedupFailedRetry(t *testing.T) {
+	d := newDeduplicator()
+	uid := "test-" + newToken()
+	now := time.Now()
+	entry, _ := d.beginAt(uid, now, time.Minute)
+	d.finish(uid, entry, nil, errors.New("timeout"))
+	if _, err := entry.wait(); err == nil {
+		t.Error("waiters should get the error")
+	}
+	retry, first := d.beginAt(uid, now.Add(time.Second), time.Minute)
+	if !first || retry == entry {
+		t.Error("failed command should be sent again")
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	d := newDeduplicator()
+	uid := "test-" + newToken()
+	now := time.Now()
+	entry, _ := d.beginAt(uid, now, time.Minute)
+	d.finish(uid, entry, []byte{0x01}, nil)
+	if _, first := d.beginAt(uid, now.Add(time.Minute), time.Minute); first {
+		t.Error("command at the window edge should be deduplicated")
+	}
+	again, first := d.beginAt(uid, now.Add(time.Minute+time.Millisecond), time.Minute)
+	if !first || again == entry {
+		t.Error("command older than the window should not be deduplicated")
+	}
+	//窗口为0时不去重
+	other := "test-" + newToken()
+	d.beginAt(other, now, 0)
+	if _, first = d.beginAt(other, now, 0); !first {
+		t.Error("zero window should not deduplicate")
+	}
+}
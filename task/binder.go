@@ -7,22 +7,44 @@ import (
 	"sentinels/snap"
 	"sentinels/store"
 	"sync"
+	"time"
 )
 
 func buildBinder(device *model.Device) (*PointBinder, error) {
 	//查询所有点位
 	points := store.DbClient.SelectPointsByDeviceId(device.Id)
-	pb := &PointBinder{}
+	collects, _ := store.DbClient.SelectCollectByDeviceId(device.Id)
+	mappers, maps := loadValueMappers(device, points)
+	pb := &PointBinder{
+		weights: priorityWeights(global.Config.WeightLow, global.Config.WeightMiddle, global.Config.WeightHigh),
+		points:  len(points),
+		sign:    pointSign(device, points, collects, maps),
+		mappers: mappers,
+	}
 	if points == nil || len(points) == 0 {
 		return pb, nil
 	}
 	switch device.ProtocolType {
 	case global.ModbusTCP, global.ModbusRTU:
 		//modbus
-		collects, _ := store.DbClient.SelectCollectByDeviceId(device.Id)
-		mc := &ModbusConvert{fcGroup: make(map[byte]map[uint16][]*model.Point)}
+		mc, err := newModbusConvert(device)
+		if err == nil {
+			err = mc.limits.check(points)
+		}
+		if err != nil {
+			return nil, err
+		}
 		mc = mc.convert(points).collect(collects).scatter()
 		pb.loadModesPoints(mc)
+	case global.CanRaw, global.CANopen:
+		cc, err := newCanConvert(device.ProtocolType).convert(points)
+		if err == nil {
+			cc, err = cc.mapping(collects)
+		}
+		if err != nil {
+			return nil, err
+		}
+		pb.loadCanPoints(cc.scatter())
 	default:
 		return nil, fmt.Errorf("unsupported protocol type: %s", device.ProtocolType)
 	}
@@ -30,26 +52,84 @@ func buildBinder(device *model.Device) (*PointBinder, error) {
 	return pb, nil
 }
 
-// PointBinder 点位集束器
+// PointBinder 点位集束器，按各组的采集间隔调度，到期的组按优先级加权轮询
 type PointBinder struct {
-	pss   []snap.PointSnap
-	lock  sync.Mutex
-	index int
+	groups  []*scheduled
+	lanes   [priorityLanes][]*scheduled //已经到期的组，按优先级分道
+	weights [priorityLanes]int          //各分道的权重，创建时按配置确定
+	current [priorityLanes]int          //平滑加权轮询的当前权重
+	lock    sync.Mutex
+	points  int                     //点位数量
+	sign    string                  //点位与采集规则的签名
+	mappers map[string]*valueMapper //点位的值映射，map[tag]
 }
 
-func (b *PointBinder) Next() snap.PointSnap {
+// Next 返回下一个需要采集的组，没有到期的组时返回需要等待的时间
+func (b *PointBinder) Next(now time.Time) (snap.PointSnap, time.Duration) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
-	if b.pss == nil || len(b.pss) == 0 {
-		return nil
+	if len(b.groups) == 0 {
+		return nil, global.IdleWait
+	}
+	//把到期的组合并到本轮
+	for _, group := range b.groups {
+		if !group.queued && !group.next.After(now) {
+			group.queued = true
+			lane := priorityRank(group.priority)
+			b.lanes[lane] = append(b.lanes[lane], group)
+		}
 	}
-	defer func() {
-		b.index++
-		if b.index >= len(b.pss) {
-			b.index = 0
+	lane := b.pickLane()
+	if lane < 0 {
+		wait := global.IdleWait
+		for _, group := range b.groups {
+			if d := group.next.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		return nil, wait
+	}
+	group := b.lanes[lane][0]
+	b.lanes[lane] = b.lanes[lane][1:]
+	group.polled(now)
+	return group.ps, 0
+}
+
+// 平滑加权轮询，只在有到期组的分道之间分配，权重至少为1，低优先级不会饿死
+func (b *PointBinder) pickLane() int {
+	weights := b.weights
+	best, total := -1, 0
+	for lane := range b.lanes {
+		if len(b.lanes[lane]) == 0 {
+			continue
+		}
+		b.current[lane] += weights[lane]
+		total += weights[lane]
+		if best < 0 || b.current[lane] > b.current[best] {
+			best = lane
 		}
-	}()
-	return b.pss[b.index]
+	}
+	if best >= 0 {
+		b.current[best] -= total
+	}
+	return best
+}
+
+// Schedule 各采集组的调度情况
+func (b *PointBinder) Schedule() []*model.GroupSchedule {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	result := make([]*model.GroupSchedule, 0, len(b.groups))
+	for _, group := range b.groups {
+		result = append(result, group.snapshot())
+	}
+	return result
+}
+
+func (b *PointBinder) add(group *scheduled) {
+	//首次采集立即进行
+	group.next = time.Now()
+	b.groups = append(b.groups, group)
 }
 
 func (b *PointBinder) loadModesPoints(convert *ModbusConvert) {
@@ -57,13 +137,21 @@ func (b *PointBinder) loadModesPoints(convert *ModbusConvert) {
 		if group == nil {
 			continue
 		}
-		mps := &snap.ModbusPointSnap{
-			FuncCode:     group.funcCode,
-			Points:       group.points,
-			StartAddress: group.startAddress,
-			EndAddress:   group.endAddress,
-			Size:         group.size,
+		var points []*model.Point
+		for _, ps := range group.points {
+			points = append(points, ps...)
+		}
+		b.add(newScheduled(group.snap(), points, group.priority, group.interval))
+	}
+}
+
+// 被动接收的帧在前，只需登记一次即可持续接收
+func (b *PointBinder) loadCanPoints(convert *CanConvert) {
+	for _, ps := range append(convert.frames, convert.sdo...) {
+		var points []*model.Point
+		for _, field := range ps.Fields {
+			points = append(points, field.Points...)
 		}
-		b.pss = append(b.pss, mps)
+		b.add(newScheduled(ps, points, highestPriority(points), convert.intervals[ps]))
 	}
 }
@@ -0,0 +1,147 @@
+package task
+
+import (
+	"fmt"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sort"
+	"strings"
+)
+
+// canObject CANopen对象字典中的一个对象
+type canObject struct {
+	index    uint16
+	subIndex byte
+}
+
+// CanConvert 将CAN点位整理成PDO/原始帧与SDO快照
+type CanConvert struct {
+	protocolType string
+	byCob        map[uint32][]*model.Point    //地址为COB-ID的点位
+	byObject     map[canObject][]*model.Point //地址为index:subindex的点位
+	frames       []*snap.CanPointSnap
+	sdo          []*snap.CanPointSnap
+	intervals    map[*snap.CanPointSnap]int //采集规则的采集间隔，毫秒
+}
+
+func newCanConvert(protocolType string) *CanConvert {
+	return &CanConvert{
+		protocolType: protocolType,
+		byCob:        make(map[uint32][]*model.Point),
+		byObject:     make(map[canObject][]*model.Point),
+		intervals:    make(map[*snap.CanPointSnap]int),
+	}
+}
+
+func (c *CanConvert) convert(points []*model.Point) (*CanConvert, error) {
+	for _, point := range points {
+		cobId, index, sub, isObject, err := snap.ParseCanAddress(point.Address)
+		if err != nil {
+			return nil, fmt.Errorf("point %s: %w", point.Tag, err)
+		}
+		if isObject {
+			if c.protocolType != global.CANopen {
+				return nil, fmt.Errorf("point %s: index:subindex address needs protocol %s", point.Tag, global.CANopen)
+			}
+			key := canObject{index: index, subIndex: sub}
+			c.byObject[key] = append(c.byObject[key], point)
+			continue
+		}
+		c.byCob[cobId] = append(c.byCob[cobId], point)
+	}
+	return c, nil
+}
+
+// mapping 按采集规则中的映射拆分帧，StartPoint为COB-ID，Mapping为按顺序排列的index:subindex或点位标签
+func (c *CanConvert) mapping(collects []*model.Collect) (*CanConvert, error) {
+	for _, collect := range collects {
+		if strings.TrimSpace(collect.Mapping) == "" {
+			continue
+		}
+		cobId, _, _, isObject, err := snap.ParseCanAddress(collect.StartPoint)
+		if err != nil || isObject {
+			return nil, fmt.Errorf("collect %s: start point must be a cob-id", collect.ID)
+		}
+		ps := &snap.CanPointSnap{FuncCode: snap.CanFuncFrame, CobId: cobId}
+		offset := 0
+		for _, entry := range strings.Split(collect.Mapping, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			points := c.take(entry)
+			if len(points) == 0 {
+				return nil, fmt.Errorf("collect %s: mapping %s has no point", collect.ID, entry)
+			}
+			size, se := snap.CanDataSize(points[0].DataType)
+			if se != nil {
+				return nil, fmt.Errorf("collect %s: %w", collect.ID, se)
+			}
+			ps.Fields = append(ps.Fields, &snap.CanField{Offset: offset, Points: points})
+			offset += size
+		}
+		if offset > 8 {
+			return nil, fmt.Errorf("collect %s: mapping is %d bytes, more than 8", collect.ID, offset)
+		}
+		c.frames = append(c.frames, ps)
+		c.intervals[ps] = collect.Interval
+	}
+	return c, nil
+}
+
+// 取出映射条目对应的点位，条目可以是对象地址或点位标签
+func (c *CanConvert) take(entry string) []*model.Point {
+	if _, index, sub, isObject, err := snap.ParseCanAddress(entry); err == nil && isObject {
+		key := canObject{index: index, subIndex: sub}
+		points := c.byObject[key]
+		delete(c.byObject, key)
+		return points
+	}
+	for cobId, points := range c.byCob {
+		for i, point := range points {
+			if point.Tag == entry {
+				c.byCob[cobId] = append(points[:i:i], points[i+1:]...)
+				return []*model.Point{point}
+			}
+		}
+	}
+	return nil
+}
+
+// scatter 剩余的COB-ID点位从帧首开始解析，对象点位通过SDO上传
+func (c *CanConvert) scatter() *CanConvert {
+	cobIds := make([]uint32, 0, len(c.byCob))
+	for cobId, points := range c.byCob {
+		if len(points) > 0 {
+			cobIds = append(cobIds, cobId)
+		}
+	}
+	sort.Slice(cobIds, func(i, j int) bool { return cobIds[i] < cobIds[j] })
+	for _, cobId := range cobIds {
+		c.frames = append(c.frames, &snap.CanPointSnap{
+			FuncCode: snap.CanFuncFrame,
+			CobId:    cobId,
+			Fields:   []*snap.CanField{{Offset: 0, Points: c.byCob[cobId]}},
+		})
+	}
+	objects := make([]canObject, 0, len(c.byObject))
+	for key := range c.byObject {
+		objects = append(objects, key)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].index != objects[j].index {
+			return objects[i].index < objects[j].index
+		}
+		return objects[i].subIndex < objects[j].subIndex
+	})
+	for _, key := range objects {
+		c.sdo = append(c.sdo, &snap.CanPointSnap{
+			FuncCode: snap.CanFuncSdo,
+			Index:    key.index,
+			SubIndex: key.subIndex,
+			Fields:   []*snap.CanField{{Offset: 0, Points: c.byObject[key]}},
+		})
+	}
+	return c
+}
@@ -0,0 +1,230 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sentinels/catch"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/protocol"
+	"sentinels/snap"
+	"sentinels/store"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	channelEventSize = 20              //保留的切换记录数量
+	probeTimeout     = 2 * time.Second //探测主通道等待回复的时间
+)
+
+// taskChannel 设备的一个通道
+type taskChannel struct {
+	index      int //下标，0为主通道
+	device     *model.Device
+	Connector  catch.Connector
+	Codec      protocol.ProtoConvener
+	unanswered atomic.Int32 //连续没有回复的采集次数
+}
+
+func newTaskChannel(device *model.Device) (*taskChannel, error) {
+	//获取调度器创建连接器的方法
+	ctFunc, ok := catch.ConnectorBuilder[device.InterfaceType]
+	if !ok {
+		return nil, errors.New("connector not found for " + device.InterfaceType)
+	}
+	//获取编解码器
+	ptFunc, ok := protocol.ProtoBuilder[device.ProtocolType]
+	if !ok {
+		return nil, errors.New("protocol not found for " + device.ProtocolType)
+	}
+	codec, err := ptFunc(device.DeviceAddress)
+	if err != nil {
+		return nil, err
+	}
+	//创建连接器
+	connector := ctFunc(device)
+	connector.AddProtocolCodec(codec.Copy())
+	return &taskChannel{device: device, Connector: connector, Codec: codec}, nil
+}
+
+// 备用通道必须能使用主通道构建的点位快照
+func sameProtocolFamily(a, b string) bool {
+	if a == b {
+		return true
+	}
+	isModbus := func(p string) bool {
+		return p == global.ModbusTCP || p == global.ModbusRTU
+	}
+	return isModbus(a) && isModbus(b)
+}
+
+// 加载设备的所有通道，下标0为主通道
+func loadChannels(device *model.Device) ([]*taskChannel, error) {
+	primary, err := newTaskChannel(device)
+	if err != nil {
+		return nil, err
+	}
+	channels := []*taskChannel{primary}
+	backups, err := store.DbClient.SelectChannelsByDeviceId(device.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range backups {
+		dev := backup.Overlay(device)
+		if !sameProtocolFamily(device.ProtocolType, dev.ProtocolType) {
+			return nil, fmt.Errorf("channel %s: protocol %s is not compatible with %s", backup.ID, dev.ProtocolType, device.ProtocolType)
+		}
+		tc, te := newTaskChannel(dev)
+		if te != nil {
+			return nil, fmt.Errorf("channel %s: %w", backup.ID, te)
+		}
+		tc.index = len(channels)
+		channels = append(channels, tc)
+	}
+	return channels, nil
+}
+
+func (g *GaTaskProcessor) failover() int32 {
+	if g.device.Failover > 0 {
+		return int32(g.device.Failover)
+	}
+	return global.DefaultFailover
+}
+
+func (g *GaTaskProcessor) failbackProbe() time.Duration {
+	if g.device.FailbackProbe > 0 {
+		return time.Duration(g.device.FailbackProbe) * time.Second
+	}
+	return global.DefaultFailbackProbe
+}
+
+// 记录一次连接失败，超过阈值后切换到下一个通道
+func (g *GaTaskProcessor) channelFailed(reason error) {
+	fails := g.channel().unanswered.Add(1)
+	if fails >= g.failover() {
+		g.switchNext(fmt.Sprintf("%d consecutive failures: %v", fails, reason))
+	}
+}
+
+// 切换到下一个通道，返回是否发生了切换
+func (g *GaTaskProcessor) switchNext(reason string) bool {
+	if len(g.channels) < 2 {
+		return false
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.switchTo((g.channel().index+1)%len(g.channels), reason)
+	return true
+}
+
+// 切换通道，调用方持有g.lock，保证没有正在执行的控制
+func (g *GaTaskProcessor) switchTo(index int, reason string) {
+	old := g.channel()
+	from := old.index
+	if from == index {
+		return
+	}
+	if old.Connector.IsLinked() {
+		_ = old.Connector.Close()
+	}
+	g.useChannel(index)
+	event := &model.ChannelEvent{
+		DeviceId: g.device.Id,
+		From:     from,
+		To:       index,
+		Address:  g.channels[index].device.Address,
+		Reason:   reason,
+		Time:     time.Now().UnixMilli(),
+	}
+	g.eventLock.Lock()
+	g.events = append(g.events, event)
+	if len(g.events) > channelEventSize {
+		g.events = g.events[len(g.events)-channelEventSize:]
+	}
+	g.eventLock.Unlock()
+	g.logger.Warnf("switch channel %d(%s) -> %d(%s), reason:%s", from, old.device.Address, index, event.Address, reason)
+	global.SystemLog.Warnf("device %s switch channel %d -> %d, reason:%s", g.device.Identifier(), from, index, reason)
+}
+
+func (g *GaTaskProcessor) useChannel(index int) {
+	ch := g.channels[index]
+	ch.unanswered.Store(0)
+	g.current.Store(ch)
+}
+
+// 当前通道，切换时整体替换，读取不需要持有锁
+func (g *GaTaskProcessor) channel() *taskChannel {
+	return g.current.Load()
+}
+
+// 使用备用通道时定期在单独的协程中探测主通道，不阻塞采集与控制，探测成功后由采集协程在下一次采集前切回
+func (g *GaTaskProcessor) probePrimary(point snap.PointSnap) {
+	if g.channel().index == 0 {
+		g.primaryOk.Store(false)
+		return
+	}
+	if g.primaryOk.CompareAndSwap(true, false) {
+		g.lock.Lock()
+		g.switchTo(0, "primary channel recovered")
+		g.lock.Unlock()
+		return
+	}
+	if point == nil || time.Since(g.lastProbe) < g.failbackProbe() || !g.probing.CompareAndSwap(false, true) {
+		return
+	}
+	g.lastProbe = time.Now()
+	go func() {
+		defer g.probing.Store(false)
+		err := g.probe(g.channels[0], point)
+		if err == nil && g.ctx.Err() == nil {
+			g.primaryOk.Store(true)
+			return
+		}
+		if err != nil {
+			g.logger.Debugf("probe primary channel err:%s", err.Error())
+		}
+		//探测失败或调度器已停止时关闭主通道
+		g.lock.Lock()
+		if g.channel().index != 0 || g.ctx.Err() != nil {
+			_ = g.channels[0].Connector.Close()
+		}
+		g.lock.Unlock()
+	}()
+}
+
+// 打开主通道并发送一次采集，probeTimeout内收到回复时返回nil
+func (g *GaTaskProcessor) probe(primary *taskChannel, point snap.PointSnap) error {
+	err := primary.Connector.Open()
+	if err != nil {
+		return err
+	}
+	key, frame, err := primary.Codec.BuildBySnap(point)
+	if err != nil {
+		return err
+	}
+	if len(frame) == 0 {
+		return errors.New("passive point can not probe channel")
+	}
+	primary.unanswered.Store(1)
+	err = primary.Connector.Collect(key, frame, point)
+	if err != nil {
+		return err
+	}
+	//等待回复
+	deadline := time.Now().Add(probeTimeout)
+	for primary.unanswered.Load() != 0 {
+		if !time.Now().Before(deadline) {
+			return errors.New("primary channel not answered")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+// ChannelEvents 最近的通道切换记录
+func (g *GaTaskProcessor) ChannelEvents() []*model.ChannelEvent {
+	g.eventLock.Lock()
+	defer g.eventLock.Unlock()
+	return append([]*model.ChannelEvent(nil), g.events...)
+}
@@ -2,6 +2,7 @@ package task
 
 import (
 	"sentinels/model"
+	"sentinels/snap"
 	"sort"
 	"strconv"
 )
@@ -11,9 +12,9 @@ type groupFunc struct {
 	points       map[uint16][]*model.Point
 	startAddress uint16
 	endAddress   uint16
-	size         byte
 	isFirst      bool
 	priority     byte
+	interval     int //采集规则的采集间隔，毫秒
 }
 
 func (f *groupFunc) appendPoints(addr uint16, points []*model.Point) {
@@ -25,26 +26,48 @@ func (f *groupFunc) appendPoints(addr uint16, points []*model.Point) {
 			f.startAddress = addr
 		}
 	}
-	if f.endAddress < addr {
-		f.endAddress = addr
+	if last := addr + pointsWidth(f.funcCode, points) - 1; f.endAddress < last {
+		f.endAddress = last
 	}
-	f.size++
-	for _, point := range points {
-		if point.Priority > f.priority {
-			f.priority = point.Priority
-		}
+	if p := highestPriority(points); f.priority == 0 || priorityRank(p) > priorityRank(f.priority) {
+		f.priority = p
 	}
 	f.points[addr] = points
 }
 
+func (f *groupFunc) snap() *snap.ModbusPointSnap {
+	return &snap.ModbusPointSnap{
+		FuncCode:     f.funcCode,
+		Points:       f.points,
+		StartAddress: f.startAddress,
+		EndAddress:   f.endAddress,
+		Size:         f.quantity(),
+	}
+}
+
+// 同一地址上的点位占用的最大地址数量
+func pointsWidth(funcCode byte, points []*model.Point) uint16 {
+	var width uint16 = 1
+	for _, p := range points {
+		width = max(width, snap.RegisterWidth(funcCode, p))
+	}
+	return width
+}
+
+// 读取的数量，包含跨过的地址
+func (f *groupFunc) quantity() uint16 {
+	return f.endAddress - f.startAddress + 1
+}
+
 type ModbusConvert struct {
 	fcGroup map[byte]map[uint16][]*model.Point //map[funcCode]map[address][]point
 	gf      []*groupFunc
+	limits  *readLimits
 }
 
 func (m *ModbusConvert) groupByPriority() []*groupFunc {
 	sort.Slice(m.gf, func(i, j int) bool {
-		return m.gf[i].priority > m.gf[j].priority
+		return priorityRank(m.gf[i].priority) > priorityRank(m.gf[j].priority)
 	})
 	return m.gf
 }
@@ -76,16 +99,21 @@ func (m *ModbusConvert) collect(collects []*model.Collect) *ModbusConvert {
 		if start >= end {
 			continue
 		}
-		gf := &groupFunc{funcCode: funcCode, points: map[uint16][]*model.Point{}}
-		for index := start; index <= end; index++ {
-			for addr, point := range points {
-				if uint16(index) == addr {
-					gf.appendPoints(addr, point)
-					delete(points, addr)
-				}
+		ruled := make(map[uint16][]*model.Point)
+		for addr, point := range points {
+			if uint64(addr) >= start && uint64(addr) <= end {
+				ruled[addr] = point
+				delete(points, addr)
+			}
+		}
+		//采集规则内的地址不限制间隔，仍然遵守数量上限与禁止读取的范围
+		for _, pointGroup := range m.optimize(funcCode, ruled, -1) {
+			gf := &groupFunc{funcCode: funcCode, points: map[uint16][]*model.Point{}, interval: collect.Interval}
+			for addr, point := range pointGroup {
+				gf.appendPoints(addr, point)
 			}
+			m.gf = append(m.gf, gf)
 		}
-		m.gf = append(m.gf, gf)
 	}
 	return m
 }
@@ -96,7 +124,7 @@ func (m *ModbusConvert) scatter() *ModbusConvert {
 		if len(groupAddr) == 0 {
 			continue
 		}
-		points := m.modbusContinuous(groupAddr)
+		points := m.optimize(funcCode, groupAddr, m.limits.maxGap)
 		// pointGroup map[uint16][]*model.Point
 		for _, pointGroup := range points {
 			gf := &groupFunc{funcCode: funcCode, points: map[uint16][]*model.Point{}}
@@ -108,54 +136,3 @@ func (m *ModbusConvert) scatter() *ModbusConvert {
 	}
 	return m
 }
-
-func (m *ModbusConvert) modbusContinuous(addressMap map[uint16][]*model.Point) []map[uint16][]*model.Point {
-	numericAddresses := make([]uint16, 0, len(addressMap))
-	pointStore := make(map[uint16][]*model.Point)
-
-	for addr, point := range addressMap {
-		numericAddresses = append(numericAddresses, addr)
-		pointStore[addr] = point
-	}
-
-	// 2. 按地址排序
-	sort.Slice(numericAddresses, func(i, j int) bool {
-		return numericAddresses[i] < numericAddresses[j]
-	})
-
-	// 3. 分组
-	var groups []map[uint16][]*model.Point
-	var currentGroup map[uint16][]*model.Point
-	var prevAddr uint16
-
-	for i, currentAddr := range numericAddresses {
-		if i == 0 {
-			// 第一个地址，开始新组
-			currentGroup = make(map[uint16][]*model.Point)
-			currentGroup[currentAddr] = pointStore[currentAddr]
-			prevAddr = currentAddr
-			continue
-		}
-
-		// 检查是否连续且不超过最大大小
-		isContinuous := currentAddr == prevAddr+1
-		withinLimit := len(currentGroup) < 125
-
-		if isContinuous && withinLimit {
-			currentGroup[currentAddr] = pointStore[currentAddr]
-			prevAddr = currentAddr
-		} else {
-			// 当前组结束，开始新组
-			groups = append(groups, currentGroup)
-			currentGroup = make(map[uint16][]*model.Point)
-			currentGroup[currentAddr] = pointStore[currentAddr]
-			prevAddr = currentAddr
-		}
-	}
-
-	// 添加最后一个组
-	if len(currentGroup) > 0 {
-		groups = append(groups, currentGroup)
-	}
-	return groups
-}
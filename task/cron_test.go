@@ -0,0 +1,113 @@
+package task
+
+import (
+	"sentinels/global"
+	"sentinels/model"
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	loc := time.UTC
+	//2026-03-04是周三
+	from := time.Date(2026, 3, 4, 10, 7, 30, 0, loc)
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 3, 4, 10, 8, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 3, 4, 10, 15, 0, 0, loc)},
+		{"0 8 * * *", time.Date(2026, 3, 5, 8, 0, 0, 0, loc)},
+		{"30 9-17/4 * * *", time.Date(2026, 3, 4, 13, 30, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, loc)},
+		{"0 6 * * 1-5", time.Date(2026, 3, 5, 6, 0, 0, 0, loc)},
+		{"0 6 * * 0,6", time.Date(2026, 3, 7, 6, 0, 0, 0, loc)},
+		//7与0都表示周日
+		{"0 6 * * 7", time.Date(2026, 3, 8, 6, 0, 0, 0, loc)},
+		//日与周都有限制时满足其一即可
+		{"0 0 20 * 5", time.Date(2026, 3, 6, 0, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, loc)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		spec, err := parseCron(c.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", c.spec, err)
+		}
+		if got := spec.next(from); !got.Equal(c.want) {
+			t.Errorf("%q: got %v, want %v", c.spec, got, c.want)
+		}
+	}
+}
+
+func TestTouNext(t *testing.T) {
+	job := &model.ControlJob{
+		Kind:     global.JobTou,
+		DeviceId: "d1",
+		Cmd:      []byte(`{"cmdType":"setCmd","funcCode":"06","value":{"startAddr":"1","value":"0"}}`),
+		Profile:  "08:00=22, 18:30=26",
+		Weekdays: "1-5",
+	}
+	plan, err := compileJob(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := time.Local
+	cases := []struct {
+		from  time.Time
+		want  time.Time
+		value string
+	}{
+		//周三白天，下一个时段为当天18:30
+		{time.Date(2026, 3, 4, 12, 0, 0, 0, loc), time.Date(2026, 3, 4, 18, 30, 0, 0, loc), "26"},
+		//周三晚上，下一个时段为周四08:00
+		{time.Date(2026, 3, 4, 19, 0, 0, 0, loc), time.Date(2026, 3, 5, 8, 0, 0, 0, loc), "22"},
+		//正好在时段开始时取下一个时段
+		{time.Date(2026, 3, 4, 8, 0, 0, 0, loc), time.Date(2026, 3, 4, 18, 30, 0, 0, loc), "26"},
+		//周五晚上跳过周末
+		{time.Date(2026, 3, 6, 20, 0, 0, 0, loc), time.Date(2026, 3, 9, 8, 0, 0, 0, loc), "22"},
+	}
+	for _, c := range cases {
+		next, value := plan.next(c.from)
+		if !next.Equal(c.want) || value != c.value {
+			t.Errorf("from %v: got %v %q, want %v %q", c.from, next, value, c.want, c.value)
+		}
+	}
+	if cmd := plan.command("26"); cmd.Value["value"] != "26" || plan.cmd.Value["value"] != "0" {
+		t.Error("command should replace value without touching the template")
+	}
+}
+
+func TestTouProfileInvalid(t *testing.T) {
+	for _, profile := range []string{"", "8=22", "08:00", "08:00=", "25:00=1", "08:60=1"} {
+		job := &model.ControlJob{
+			Kind:     global.JobTou,
+			DeviceId: "d1",
+			Cmd:      []byte(`{"cmdType":"setCmd","funcCode":"06","value":{"startAddr":"1","value":"0"}}`),
+			Profile:  profile,
+		}
+		if _, err := compileJob(job); err == nil {
+			t.Errorf("%q: expected error", profile)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sentinels/store"
+	"slices"
+	"strings"
+)
+
+var InterlockError = errors.New("interlock violated")
+
+// 下发控制前检查联锁，表达式出错时同样视为不满足，抄读命令不检查
+// tags为命令写入的点位，resolved为false时无法确定写入的点位，设备有按点位的规则时直接视为不满足
+func checkInterlocks(deviceId string, tags []string, resolved bool, opt *command.ControlCarrier, audit *model.ControlAudit) error {
+	if opt.Cmd.CmdType == global.CopyRead {
+		return nil
+	}
+	rules, err := store.DbClient.SelectInterlocks(deviceId)
+	if err != nil {
+		return fmt.Errorf("load interlocks: %w", err)
+	}
+	var write *float64
+	if opt.Cmd.CmdType == global.WritePoint {
+		_, value, _ := opt.Cmd.WritePointItems()
+		write = &value
+	}
+	var violated, names []string
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.Tag != "" && !resolved {
+			names = append(names, rule.Name)
+			violated = append(violated, fmt.Sprintf("%s(%s)", rule.Name, UnresolvedWriteError.Error()))
+			continue
+		}
+		//设备级规则只写入一个点位时带上tag，按点位的规则只在写入该点位时执行
+		tag := ""
+		if rule.Tag != "" {
+			if !slices.Contains(tags, rule.Tag) {
+				continue
+			}
+			tag = rule.Tag
+		} else if len(tags) == 1 {
+			tag = tags[0]
+		}
+		env := &snap.InterlockEnv{DeviceId: deviceId, Tag: tag, Write: write, Lookup: realtime.lookup}
+		ok, ee := snap.EvalInterlock(rule.Expression, env)
+		if ok {
+			continue
+		}
+		reason := rule.Message
+		if ee != nil {
+			reason = ee.Error()
+		}
+		names = append(names, rule.Name)
+		violated = append(violated, fmt.Sprintf("%s(%s)", rule.Name, reason))
+	}
+	tag := strings.Join(tags, ",")
+	if opt.Bypass() != "" {
+		if !bypassAllowed(opt.Role()) {
+			return fmt.Errorf("role %q is not allowed to bypass interlocks", opt.Role())
+		}
+		audit.Bypass = fmt.Sprintf("%s(%s): %s", opt.Bypass(), opt.Role(), strings.Join(names, ","))
+		global.SystemLog.Warnf("interlock bypassed by %s, role:%s device:%s tag:%s uid:%s reason:%s violated:%s",
+			opt.Requester(), opt.Role(), deviceId, tag, opt.UniqueIdentifier(), opt.Bypass(), strings.Join(violated, "; "))
+		return nil
+	}
+	if len(violated) == 0 {
+		return nil
+	}
+	global.SystemLog.Warnf("control blocked by interlock, device:%s tag:%s uid:%s requester:%s violated:%s",
+		deviceId, tag, opt.UniqueIdentifier(), opt.Requester(), strings.Join(violated, "; "))
+	return fmt.Errorf("%w: %s", InterlockError, strings.Join(violated, "; "))
+}
+
+// 角色是否可以旁路联锁，角色来自校验过的客户端证书
+func bypassAllowed(role string) bool {
+	if role == "" {
+		return false
+	}
+	for _, allowed := range strings.Split(global.Config.BypassRoles, ",") {
+		if strings.TrimSpace(allowed) == role {
+			return true
+		}
+	}
+	return false
+}
+
+func pointTags(points []*model.Point) []string {
+	tags := make([]string, 0, len(points))
+	for _, p := range points {
+		tags = append(tags, p.Tag)
+	}
+	return tags
+}
@@ -15,10 +15,12 @@ func devConnected(dev *model.Device) {
 // 设备断开连接
 func devDisConnected(dev *model.Device, err error) {
 	fmt.Println("dev disconnected:", dev.Identifier())
+	realtime.invalidate(dev.Id)
 }
 
 // 读取到的数据
 func devSwap(dev *model.Device, data map[string]interface{}, ts int64) {
+	realtime.update(dev.Id, data, ts)
 	resp, _ := json.Marshal(data)
 	fmt.Println("读取到数据：" + string(resp))
 }
@@ -26,4 +28,5 @@ func devSwap(dev *model.Device, data map[string]interface{}, ts int64) {
 // 采集数据报错
 func collectPointsFail(dev *model.Device, point snap.PointSnap, err error) {
 	fmt.Println("collectPointsFail:", dev, point, err)
+	realtime.invalidate(dev.Id, snapTags(point)...)
 }
@@ -0,0 +1,303 @@
+package task
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分时任务的一个时段
+type touEntry struct {
+	spec  *cronSpec
+	value string
+}
+
+// jobPlan 解析后的定时任务
+type jobPlan struct {
+	job     *model.ControlJob
+	cmd     *command.OperateCmd //命令模板
+	cron    *cronSpec
+	entries []touEntry
+	running bool
+}
+
+// ValidateJob 校验定时任务的配置
+func ValidateJob(job *model.ControlJob) error {
+	_, err := compileJob(job)
+	return err
+}
+
+func compileJob(job *model.ControlJob) (*jobPlan, error) {
+	if strings.TrimSpace(job.DeviceId) == "" {
+		return nil, errors.New("job device id is empty")
+	}
+	plan := &jobPlan{job: job}
+	if err := json.Unmarshal(job.Cmd, &plan.cmd); err != nil || plan.cmd == nil {
+		return nil, fmt.Errorf("job cmd is invalid: %v", err)
+	}
+	switch job.Kind {
+	case global.JobOnce:
+		if job.At <= 0 {
+			return nil, errors.New("once job needs at")
+		}
+	case global.JobCron:
+		spec, err := parseCron(job.Cron)
+		if err != nil {
+			return nil, err
+		}
+		plan.cron = spec
+	case global.JobTou:
+		weekdays := strings.TrimSpace(job.Weekdays)
+		if weekdays == "" {
+			weekdays = "*"
+		}
+		for _, item := range strings.Split(job.Profile, ",") {
+			at, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			hour, minute, ok2 := strings.Cut(at, ":")
+			if !ok || !ok2 || strings.TrimSpace(value) == "" {
+				return nil, fmt.Errorf("tou profile %q must be HH:MM=value", item)
+			}
+			h, he := strconv.Atoi(hour)
+			m, me := strconv.Atoi(minute)
+			if he != nil || me != nil {
+				return nil, fmt.Errorf("tou profile %q must be HH:MM=value", item)
+			}
+			spec, err := parseCron(fmt.Sprintf("%d %d * * %s", m, h, weekdays))
+			if err != nil {
+				return nil, fmt.Errorf("tou profile %q: %w", item, err)
+			}
+			plan.entries = append(plan.entries, touEntry{spec: spec, value: strings.TrimSpace(value)})
+		}
+	default:
+		return nil, fmt.Errorf("job kind must be %s, %s or %s", global.JobOnce, global.JobCron, global.JobTou)
+	}
+	//命令模板需要能通过校验，分时任务以第一个时段的值校验
+	value := ""
+	if len(plan.entries) > 0 {
+		value = plan.entries[0].value
+	}
+	if err := plan.command(value).Check(); err != nil {
+		return nil, fmt.Errorf("job cmd is invalid: %w", err)
+	}
+	return plan, nil
+}
+
+// 按模板创建命令，value不为空时替换命令中的值
+func (p *jobPlan) command(value string) *command.OperateCmd {
+	cmd := &command.OperateCmd{
+		Timeout:  p.cmd.Timeout,
+		CmdType:  p.cmd.CmdType,
+		FuncCode: p.cmd.FuncCode,
+		Value:    maps.Clone(p.cmd.Value),
+	}
+	if cmd.Value == nil {
+		cmd.Value = make(map[string]string)
+	}
+	if value != "" {
+		cmd.Value["value"] = value
+	}
+	return cmd
+}
+
+// 晚于t的下一次执行时间与分时任务的值，不再执行时返回零值
+func (p *jobPlan) next(t time.Time) (time.Time, string) {
+	switch p.job.Kind {
+	case global.JobOnce:
+		if p.job.LastRun > 0 {
+			return time.Time{}, ""
+		}
+		return time.UnixMilli(p.job.At), ""
+	case global.JobCron:
+		return p.cron.next(t), ""
+	default:
+		var next time.Time
+		var value string
+		for _, entry := range p.entries {
+			if n := entry.spec.next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+				next, value = n, entry.value
+			}
+		}
+		return next, value
+	}
+}
+
+func nextMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// jobScheduler 定时控制，到期的任务通过Exec下发
+type jobScheduler struct {
+	lock  sync.Mutex
+	plans map[string]*jobPlan
+	wake  chan struct{}
+}
+
+func newJobScheduler() *jobScheduler {
+	return &jobScheduler{plans: make(map[string]*jobPlan), wake: make(chan struct{}, 1)}
+}
+
+// 从数据库加载启用的任务，停机期间错过的周期任务不补发，错过的单次任务立即执行
+func (s *jobScheduler) load() error {
+	jobs, err := store.DbClient.SelectJobs()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	plans := make(map[string]*jobPlan)
+	s.lock.Lock()
+	for _, job := range jobs {
+		if !job.Enabled {
+			continue
+		}
+		plan, ce := compileJob(job)
+		if ce != nil {
+			global.SystemLog.Errorf("job %s(%s) invalid: %s", job.ID, job.Name, ce.Error())
+			continue
+		}
+		if old, ok := s.plans[job.ID]; ok {
+			plan.running = old.running
+		}
+		next, _ := plan.next(now)
+		if job.Kind != global.JobOnce && job.NextRun > now.UnixMilli() {
+			//保持分时任务已经计算好的时段
+			next = time.UnixMilli(job.NextRun)
+		}
+		if nm := nextMilli(next); nm != job.NextRun {
+			job.NextRun = nm
+			_ = store.DbClient.UpdateJobRun(job)
+		}
+		plans[job.ID] = plan
+	}
+	s.plans = plans
+	s.lock.Unlock()
+	s.signal()
+	return nil
+}
+
+func (s *jobScheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *jobScheduler) run() {
+	for {
+		now := time.Now()
+		wait := time.Minute
+		s.lock.Lock()
+		for _, plan := range s.plans {
+			job := plan.job
+			if job.NextRun == 0 || plan.running {
+				continue
+			}
+			due := time.UnixMilli(job.NextRun)
+			if due.After(now) {
+				if d := due.Sub(now); d < wait {
+					wait = d
+				}
+				continue
+			}
+			//分时任务到期时段的值
+			_, value := plan.next(due.Add(-time.Minute))
+			plan.running = true
+			go s.fire(plan, due, value)
+		}
+		s.lock.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// 执行一次任务并记录结果，唯一标识由任务与计划时间组成，不会重复下发
+func (s *jobScheduler) fire(plan *jobPlan, due time.Time, value string) {
+	s.lock.Lock()
+	job := *plan.job
+	s.lock.Unlock()
+	opt := command.NewCarrierByDevId(job.DeviceId).
+		FlushUniqueIdentifier(fmt.Sprintf("job-%s-%d", job.ID, due.UnixMilli()))
+	requester := job.Requester
+	if requester == "" {
+		requester = "job:" + job.ID
+	}
+	opt.FlushRequester(requester)
+	opt.ReplySize = job.ReplySize
+	opt.ValidityPeriod = time.Now().Add(time.Minute).UnixMilli()
+	opt.Cmd = plan.command(value)
+	run := &model.JobRun{
+		JobId:            job.ID,
+		UniqueIdentifier: opt.UniqueIdentifier(),
+		Due:              due.UnixMilli(),
+		Start:            time.Now().UnixMilli(),
+		Value:            value,
+	}
+	resp, err := GTP.Exec(opt)
+	run.Finish = time.Now().UnixMilli()
+	run.Response = hex.EncodeToString(resp)
+	run.Outcome = outcomeOf(err)
+	if err != nil {
+		run.Error = err.Error()
+		global.SystemLog.Errorf("job %s(%s) due %s failed: %s", job.ID, job.Name, due.Format(time.DateTime), err.Error())
+	}
+	if se := store.DbClient.SaveJobRun(run); se != nil {
+		global.SystemLog.Errorf("save job run %s err:%s", job.ID, se.Error())
+	}
+	s.lock.Lock()
+	plan.running = false
+	//执行期间重新加载过时更新新的计划
+	if current, ok := s.plans[job.ID]; ok {
+		current.running = false
+		plan = current
+	}
+	plan.job.LastRun = run.Start
+	plan.job.LastOutcome = run.Outcome
+	next, _ := plan.next(due)
+	plan.job.NextRun = nextMilli(next)
+	job = *plan.job
+	s.lock.Unlock()
+	if ue := store.DbClient.UpdateJobRun(&job); ue != nil {
+		global.SystemLog.Errorf("update job %s err:%s", job.ID, ue.Error())
+	}
+	s.signal()
+}
+
+// 根据Exec返回的错误判断结果
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return global.OutcomeSuccess
+	case errors.Is(err, ControlExpiredError):
+		return global.OutcomeExpired
+	case errors.Is(err, InterlockError):
+		return global.OutcomeInterlock
+	default:
+		return global.OutcomeFailed
+	}
+}
+
+// ReloadJobs 定时任务修改后重新加载
+func (g *GaTaskPool) ReloadJobs() error {
+	return g.jobs.load()
+}
+
+// JobRuns 定时任务最近的执行记录
+func (g *GaTaskPool) JobRuns(id string, limit int) ([]*model.JobRun, error) {
+	return store.DbClient.SelectJobRuns(id, limit)
+}
@@ -0,0 +1,128 @@
+package task
+
+import (
+	"sentinels/global"
+	"sentinels/model"
+	"sync"
+	"time"
+)
+
+// 每个设备保留的状态变化记录数量
+const lifecycleHistorySize = 50
+
+// supervisor 汇总所有设备的生命周期事件并分发给订阅者
+type supervisor struct {
+	lock        sync.Mutex
+	subscribers map[int]chan *model.LifecycleEvent
+	nextId      int
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{subscribers: make(map[int]chan *model.LifecycleEvent)}
+}
+
+// 分发事件，订阅者处理不过来时丢弃，不阻塞采集
+func (s *supervisor) publish(event *model.LifecycleEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			global.SystemLog.Warnf("lifecycle subscriber is full, drop event of %s", event.Identifier)
+		}
+	}
+}
+
+func (s *supervisor) subscribe(buffer int) (<-chan *model.LifecycleEvent, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan *model.LifecycleEvent, buffer)
+	s.lock.Lock()
+	id := s.nextId
+	s.nextId++
+	s.subscribers[id] = ch
+	s.lock.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.lock.Lock()
+			delete(s.subscribers, id)
+			s.lock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Subscribe 订阅所有设备的生命周期事件，使用完毕后调用返回的函数取消订阅
+func (g *GaTaskPool) Subscribe(buffer int) (<-chan *model.LifecycleEvent, func()) {
+	return g.supervisor.subscribe(buffer)
+}
+
+// lifecycle 一个设备的生命周期状态
+type lifecycle struct {
+	lock    sync.Mutex
+	state   string
+	reason  string
+	since   time.Time
+	history []*model.LifecycleEvent
+}
+
+// 切换状态，状态不变时忽略
+func (g *GaTaskProcessor) transition(to string, reason string) {
+	l := &g.lifecycle
+	l.lock.Lock()
+	if l.state == to {
+		l.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	event := &model.LifecycleEvent{
+		DeviceId:   g.device.Id,
+		Identifier: g.device.Identifier(),
+		From:       l.state,
+		To:         to,
+		Reason:     reason,
+		Time:       now.UnixMilli(),
+	}
+	l.state, l.reason, l.since = to, reason, now
+	l.history = append(l.history, event)
+	if len(l.history) > lifecycleHistorySize {
+		l.history = l.history[len(l.history)-lifecycleHistorySize:]
+	}
+	l.lock.Unlock()
+	g.logger.Infof("lifecycle %s -> %s, reason:%s", event.From, to, reason)
+	if GTP != nil {
+		GTP.supervisor.publish(event)
+	}
+}
+
+// 采集正常时根据通道判断在线或降级
+func (g *GaTaskProcessor) healthy() {
+	if g.channel().index != 0 {
+		g.transition(global.StateDegraded, "running on backup channel")
+		return
+	}
+	g.transition(global.StateOnline, "data received")
+}
+
+// State 当前的生命周期状态
+func (g *GaTaskProcessor) State() string {
+	g.lifecycle.lock.Lock()
+	defer g.lifecycle.lock.Unlock()
+	return g.lifecycle.state
+}
+
+// Lifecycle 当前的生命周期状态与最近的变化
+func (g *GaTaskProcessor) Lifecycle() *model.Lifecycle {
+	l := &g.lifecycle
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return &model.Lifecycle{
+		State:   l.state,
+		Reason:  l.reason,
+		Since:   l.since.UnixMilli(),
+		History: append([]*model.LifecycleEvent(nil), l.history...),
+	}
+}
@@ -0,0 +1,240 @@
+package task
+
+import (
+	"fmt"
+	"math"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sentinels/store"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxReadRegisters = 125  //0x03、0x04单次最多读取的寄存器数量
+	maxReadCoils     = 2000 //0x01、0x02单次最多读取的线圈数量
+)
+
+// 禁止读取的地址范围，funcCode为0时对所有功能码生效
+type addrRange struct {
+	funcCode   byte
+	start, end uint16
+}
+
+// readLimits 合并读取的限制
+type readLimits struct {
+	maxGap       int //允许跨过的未配置地址数量，设备配置小于0时为0，只合并连续的地址
+	maxRegisters uint16
+	maxCoils     uint16
+	forbidden    []addrRange
+}
+
+func newReadLimits(device *model.Device) (*readLimits, error) {
+	l := &readLimits{
+		maxGap:       global.Config.ModbusMaxGap,
+		maxRegisters: maxReadRegisters,
+		maxCoils:     maxReadCoils,
+	}
+	if device.MaxGap != 0 {
+		l.maxGap = device.MaxGap
+	}
+	l.maxGap = max(l.maxGap, 0)
+	if device.MaxRegisters > 0 && device.MaxRegisters < maxReadRegisters {
+		l.maxRegisters = uint16(device.MaxRegisters)
+	}
+	if device.MaxCoils > 0 && device.MaxCoils < maxReadCoils {
+		l.maxCoils = uint16(device.MaxCoils)
+	}
+	forbidden, err := parseForbidden(device.ForbiddenRanges)
+	if err != nil {
+		return nil, fmt.Errorf("device %s forbidden ranges: %w", device.Id, err)
+	}
+	l.forbidden = forbidden
+	return l, nil
+}
+
+// 解析禁止读取的范围，以逗号分隔，例如0x100-0x1FF,3:500-510,1:20
+func parseForbidden(ranges string) ([]addrRange, error) {
+	var result []addrRange
+	for _, item := range strings.Split(ranges, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		r := addrRange{}
+		if fc, rest, ok := strings.Cut(item, ":"); ok {
+			n, err := strconv.ParseUint(strings.TrimSpace(fc), 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%q: invalid func code", item)
+			}
+			r.funcCode, item = byte(n), rest
+		}
+		start, end, isRange := strings.Cut(item, "-")
+		s, err := strconv.ParseUint(strings.TrimSpace(start), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid address", item)
+		}
+		e := s
+		if isRange {
+			if e, err = strconv.ParseUint(strings.TrimSpace(end), 0, 16); err != nil || e < s {
+				return nil, fmt.Errorf("%q: invalid address", item)
+			}
+		}
+		r.start, r.end = uint16(s), uint16(e)
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// 单次读取的数量上限
+func (l *readLimits) quantity(fc byte) uint16 {
+	if fc == 0x01 || fc == 0x02 {
+		return l.maxCoils
+	}
+	return l.maxRegisters
+}
+
+// 检查单个点位占用的地址数量不超过单次读取的上限且不超出地址范围，否则无法读取
+func (l *readLimits) check(points []*model.Point) error {
+	for _, p := range points {
+		fc, _ := strconv.ParseUint(p.FunctionCode, 0, 8)
+		if width, limit := snap.RegisterWidth(byte(fc), p), l.quantity(byte(fc)); width > limit {
+			return fmt.Errorf("point %s occupies %d addresses, more than %d per request", p.Tag, width, limit)
+		}
+		//最后一个地址不能超过0xFFFF
+		addr, _ := strconv.ParseUint(p.Address, 0, 16)
+		if end := int(addr) + int(snap.RegisterWidth(byte(fc), p)) - 1; end > math.MaxUint16 {
+			return fmt.Errorf("point %s ends at address %d, beyond 0xFFFF", p.Tag, end)
+		}
+	}
+	return nil
+}
+
+// CheckPointWidth 保存或导入点位时检查点位占用的地址数量不超过设备单次读取的上限，且最后一个地址不超过0xFFFF
+func CheckPointWidth(device *model.Device, p *model.Point) error {
+	if p.Length < 0 {
+		return fmt.Errorf("point %s length %d is negative", p.Tag, p.Length)
+	}
+	limits, err := newReadLimits(device)
+	if err != nil {
+		return err
+	}
+	return limits.check([]*model.Point{p})
+}
+
+// [start, end]中是否有禁止读取的地址
+func (l *readLimits) forbids(fc byte, start, end uint16) bool {
+	for _, r := range l.forbidden {
+		if (r.funcCode == 0 || r.funcCode == fc) && r.start <= end && start <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func newModbusConvert(device *model.Device) (*ModbusConvert, error) {
+	limits, err := newReadLimits(device)
+	if err != nil {
+		return nil, err
+	}
+	return &ModbusConvert{fcGroup: make(map[byte]map[uint16][]*model.Point), limits: limits}, nil
+}
+
+// 按地址排序后合并，间隔不超过maxGap（小于0为不限制，只用于采集规则内的地址）、数量不超过上限且跨过的地址不在禁止范围内时合并为一组
+// 多寄存器的点位按数据类型占用后面的地址，与前一个点位重叠时直接合并
+func (m *ModbusConvert) optimize(fc byte, addressMap map[uint16][]*model.Point, maxGap int) []map[uint16][]*model.Point {
+	addresses := make([]uint16, 0, len(addressMap))
+	for addr := range addressMap {
+		addresses = append(addresses, addr)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i] < addresses[j]
+	})
+	limit := m.limits.quantity(fc)
+	var groups []map[uint16][]*model.Point
+	var current map[uint16][]*model.Point
+	var start, end uint16
+	for _, addr := range addresses {
+		last := int(addr) + int(pointsWidth(fc, addressMap[addr])) - 1
+		if current != nil {
+			gap := int(addr) - int(end) - 1
+			merge := (maxGap < 0 || gap <= maxGap) && max(last, int(end))-int(start)+1 <= int(limit)
+			if merge && gap > 0 && m.limits.forbids(fc, end+1, addr-1) {
+				merge = false
+			}
+			if merge {
+				current[addr] = addressMap[addr]
+				end = uint16(max(last, int(end)))
+				continue
+			}
+			groups = append(groups, current)
+		}
+		current = map[uint16][]*model.Point{addr: addressMap[addr]}
+		start, end = addr, uint16(last)
+	}
+	if current != nil {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// ReadPlan 按设备当前的点位、采集规则与合并限制生成的读取计划，修改后需要重新加载才会生效
+func (g *GaTaskPool) ReadPlan(id string) (*model.ReadPlan, error) {
+	device, err := store.DbClient.SelectDeviceById(id)
+	if err != nil {
+		return nil, err
+	}
+	if device.ProtocolType != global.ModbusTCP && device.ProtocolType != global.ModbusRTU {
+		return nil, fmt.Errorf("read plan is not supported by protocol %s", device.ProtocolType)
+	}
+	mc, err := newModbusConvert(device)
+	if err != nil {
+		return nil, err
+	}
+	points := store.DbClient.SelectPointsByDeviceId(device.Id)
+	if err = mc.limits.check(points); err != nil {
+		return nil, err
+	}
+	collects, _ := store.DbClient.SelectCollectByDeviceId(device.Id)
+	mc = mc.convert(points).collect(collects).scatter()
+	plan := &model.ReadPlan{
+		DeviceId:     device.Id,
+		MaxGap:       mc.limits.maxGap,
+		MaxRegisters: int(mc.limits.maxRegisters),
+		MaxCoils:     int(mc.limits.maxCoils),
+		Points:       len(points),
+		Groups:       make([]*model.ReadGroup, 0, len(mc.gf)),
+	}
+	sort.Slice(mc.gf, func(i, j int) bool {
+		if mc.gf[i].funcCode != mc.gf[j].funcCode {
+			return mc.gf[i].funcCode < mc.gf[j].funcCode
+		}
+		return mc.gf[i].startAddress < mc.gf[j].startAddress
+	})
+	for _, gf := range mc.gf {
+		group := &model.ReadGroup{
+			FuncCode: gf.funcCode,
+			Start:    gf.startAddress,
+			End:      gf.endAddress,
+			Quantity: gf.quantity(),
+			Interval: gf.interval,
+			Priority: gf.priority,
+		}
+		covered := make(map[uint16]bool)
+		for addr, ps := range gf.points {
+			group.Addresses++
+			for _, p := range ps {
+				group.Tags = append(group.Tags, p.Tag)
+			}
+			for i := uint16(0); i < pointsWidth(gf.funcCode, ps); i++ {
+				covered[addr+i] = true
+			}
+		}
+		group.Unused = int(group.Quantity) - len(covered)
+		sort.Strings(group.Tags)
+		plan.Groups = append(plan.Groups, group)
+	}
+	return plan, nil
+}
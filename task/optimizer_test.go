@@ -0,0 +1,170 @@
+package task
+
+import (
+	"reflect"
+	"sentinels/global"
+	"sentinels/model"
+	"slices"
+	"testing"
+)
+
+func TestParseForbidden(t *testing.T) {
+	got, err := parseForbidden(" 0x100-0x1FF, 3:500-510,1:20 ,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []addrRange{
+		{funcCode: 0, start: 0x100, end: 0x1FF},
+		{funcCode: 3, start: 500, end: 510},
+		{funcCode: 1, start: 20, end: 20},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got, err = parseForbidden(""); err != nil || got != nil {
+		t.Errorf("empty: got %+v %v", got, err)
+	}
+	for _, ranges := range []string{"10-5", "x:1", "1:", "70000", "3:1-", "256:1"} {
+		if _, err = parseForbidden(ranges); err == nil {
+			t.Errorf("%q: expected error", ranges)
+		}
+	}
+}
+
+func TestReadLimitsMaxGap(t *testing.T) {
+	for _, c := range []struct{ device, want int }{{0, 0}, {5, 5}, {-1, 0}} {
+		l, err := newReadLimits(&model.Device{MaxGap: c.device})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.maxGap != c.want {
+			t.Errorf("device maxGap %d: got %d, want %d", c.device, l.maxGap, c.want)
+		}
+	}
+}
+
+func testConvert(t *testing.T, device *model.Device) *ModbusConvert {
+	t.Helper()
+	mc, err := newModbusConvert(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mc
+}
+
+// 每组点位的地址，各组按第一个地址排序
+func groupAddrs(groups []map[uint16][]*model.Point) [][]uint16 {
+	var result [][]uint16
+	for _, g := range groups {
+		var addrs []uint16
+		for addr := range g {
+			addrs = append(addrs, addr)
+		}
+		slices.Sort(addrs)
+		result = append(result, addrs)
+	}
+	slices.SortFunc(result, func(a, b []uint16) int { return int(a[0]) - int(b[0]) })
+	return result
+}
+
+func registers(dataType string, addrs ...uint16) map[uint16][]*model.Point {
+	m := make(map[uint16][]*model.Point)
+	for _, addr := range addrs {
+		m[addr] = []*model.Point{{FunctionCode: "3", DataType: dataType}}
+	}
+	return m
+}
+
+func TestOptimizeGap(t *testing.T) {
+	mc := testConvert(t, &model.Device{})
+	points := registers(global.DTUint16, 0, 1, 2, 5, 6, 20)
+	cases := []struct {
+		maxGap int
+		want   [][]uint16
+	}{
+		{0, [][]uint16{{0, 1, 2}, {5, 6}, {20}}},
+		{2, [][]uint16{{0, 1, 2, 5, 6}, {20}}},
+		{13, [][]uint16{{0, 1, 2, 5, 6, 20}}},
+		{-1, [][]uint16{{0, 1, 2, 5, 6, 20}}},
+	}
+	for _, c := range cases {
+		if got := groupAddrs(mc.optimize(0x03, points, c.maxGap)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("maxGap %d: got %v, want %v", c.maxGap, got, c.want)
+		}
+	}
+}
+
+func TestOptimizeWidth(t *testing.T) {
+	mc := testConvert(t, &model.Device{})
+	//uint32占用0、1，与2连续；float64占用10~13，与14连续
+	points := registers(global.DTUint32, 0)
+	points[2] = []*model.Point{{DataType: global.DTUint16}}
+	points[10] = []*model.Point{{DataType: global.DTFloat64}}
+	points[14] = []*model.Point{{DataType: global.DTUint16}}
+	//与uint32重叠的按bit计算的点位
+	points[1] = []*model.Point{{DataType: global.DTUint16}}
+	want := [][]uint16{{0, 1, 2}, {10, 14}}
+	if got := groupAddrs(mc.optimize(0x03, points, 0)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOptimizeLimits(t *testing.T) {
+	mc := testConvert(t, &model.Device{MaxRegisters: 4})
+	points := registers(global.DTUint16, 0, 1, 2, 3, 4, 5, 7)
+	want := [][]uint16{{0, 1, 2, 3}, {4, 5, 7}}
+	if got := groupAddrs(mc.optimize(0x03, points, 10)); !reflect.DeepEqual(got, want) {
+		t.Errorf("registers: got %v, want %v", got, want)
+	}
+	coils := testConvert(t, &model.Device{MaxCoils: 3})
+	bits := registers(global.DTBit, 0, 1, 2, 3)
+	if got := groupAddrs(coils.optimize(0x01, bits, 0)); !reflect.DeepEqual(got, [][]uint16{{0, 1, 2}, {3}}) {
+		t.Errorf("coils: got %v", got)
+	}
+}
+
+func TestOptimizeForbidden(t *testing.T) {
+	mc := testConvert(t, &model.Device{ForbiddenRanges: "3:8,0x20-0x21"})
+	points := registers(global.DTUint16, 7, 9, 0x1F, 0x22)
+	//功能码3不能跨过8，所有功能码都不能跨过0x20-0x21
+	want := [][]uint16{{7}, {9}, {0x1F}, {0x22}}
+	if got := groupAddrs(mc.optimize(0x03, points, 10)); !reflect.DeepEqual(got, want) {
+		t.Errorf("fc3: got %v, want %v", got, want)
+	}
+	want = [][]uint16{{7, 9}, {0x1F}, {0x22}}
+	if got := groupAddrs(mc.optimize(0x04, points, 10)); !reflect.DeepEqual(got, want) {
+		t.Errorf("fc4: got %v, want %v", got, want)
+	}
+}
+
+func TestReadLimitsCheck(t *testing.T) {
+	l, err := newReadLimits(&model.Device{MaxRegisters: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fits := []*model.Point{{Tag: "S", FunctionCode: "3", DataType: global.DTString, Length: 10}}
+	if err = l.check(fits); err != nil {
+		t.Error(err)
+	}
+	wide := []*model.Point{{Tag: "S", FunctionCode: "3", DataType: global.DTString, Length: 11}}
+	if err = l.check(wide); err == nil {
+		t.Error("expected error for a point wider than maxRegisters")
+	}
+	//线圈每个地址一位，与length无关
+	coil := []*model.Point{{Tag: "C", FunctionCode: "1", DataType: global.DTString, Length: 11}}
+	if err = l.check(coil); err != nil {
+		t.Error(err)
+	}
+	//最后一个地址不能超过0xFFFF
+	end := []*model.Point{{Tag: "E", Address: "0xFFFE", FunctionCode: "3", DataType: global.DTUint32}}
+	if err = l.check(end); err != nil {
+		t.Error(err)
+	}
+	end[0].Address = "0xFFFF"
+	if err = l.check(end); err == nil {
+		t.Error("expected error for a point beyond 0xFFFF")
+	}
+	if err = CheckPointWidth(&model.Device{}, &model.Point{Tag: "S", Address: "65530", FunctionCode: "3", DataType: global.DTString, Length: 7}); err == nil {
+		t.Error("expected error for a string beyond 0xFFFF")
+	}
+}
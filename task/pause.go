@@ -0,0 +1,122 @@
+package task
+
+import (
+	"encoding/json"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"sync"
+	"time"
+)
+
+// 暂停状态在运行参数中的键
+const (
+	pauseKey       = "pause"
+	pauseKeyPrefix = "pause:"
+)
+
+// pauser 暂停状态，到达恢复时间后自动恢复
+type pauser struct {
+	lock  sync.Mutex
+	key   string //持久化使用的键
+	state model.PauseState
+}
+
+func newPauser(key string) *pauser {
+	p := &pauser{key: key}
+	//恢复重启前保存的暂停状态
+	value := store.DbClient.SelectSetting(key)
+	if value == "" {
+		return p
+	}
+	var state model.PauseState
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		global.SystemLog.Errorf("invalid pause state %s: %s", key, err.Error())
+		return p
+	}
+	if state.Paused && (state.Until == 0 || state.Until > time.Now().UnixMilli()) {
+		p.state = state
+	}
+	return p
+}
+
+// 暂停，duration为0时不自动恢复
+func (p *pauser) pause(duration time.Duration, reason string, persist bool) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	p.state = model.PauseState{Paused: true, Since: now.UnixMilli(), Reason: reason, Persist: persist}
+	if duration > 0 {
+		p.state.Until = now.Add(duration).UnixMilli()
+	}
+	if !persist {
+		return store.DbClient.DeleteSetting(p.key)
+	}
+	data, _ := json.Marshal(p.state)
+	return store.DbClient.SaveSetting(p.key, string(data))
+}
+
+func (p *pauser) resume() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.state = model.PauseState{}
+	return store.DbClient.DeleteSetting(p.key)
+}
+
+// 当前的暂停状态，超过恢复时间时自动恢复
+func (p *pauser) current() model.PauseState {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.state.Paused && p.state.Until > 0 && time.Now().UnixMilli() >= p.state.Until {
+		global.SystemLog.Infof("%s resumed automatically", p.key)
+		p.state = model.PauseState{}
+		_ = store.DbClient.DeleteSetting(p.key)
+	}
+	return p.state
+}
+
+// 继承重建前的暂停状态
+func (p *pauser) inherit(old *pauser) {
+	state := old.current()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.state = state
+}
+
+func (p *pauser) paused() bool {
+	return p.current().Paused
+}
+
+// Pause 暂停全部设备的采集，连接保持，控制不受影响
+func (g *GaTaskPool) Pause(duration time.Duration, reason string, persist bool) error {
+	global.SystemLog.Infof("pause all devices, duration:%s reason:%s", duration, reason)
+	return g.pauser.pause(duration, reason, persist)
+}
+
+// Resume 恢复全部设备的采集，单独暂停的设备仍然暂停
+func (g *GaTaskPool) Resume() error {
+	global.SystemLog.Info("resume all devices")
+	return g.pauser.resume()
+}
+
+// PauseState 全局的暂停状态
+func (g *GaTaskPool) PauseState() model.PauseState {
+	return g.pauser.current()
+}
+
+// Pause 暂停设备的采集
+func (g *GaTaskProcessor) Pause(duration time.Duration, reason string, persist bool) error {
+	g.logger.Infof("pause collect, duration:%s reason:%s", duration, reason)
+	return g.pauser.pause(duration, reason, persist)
+}
+
+// Resume 恢复设备的采集
+func (g *GaTaskProcessor) Resume() error {
+	g.logger.Info("resume collect")
+	return g.pauser.resume()
+}
+
+// 设备或全局处于暂停状态时不采集
+func (g *GaTaskProcessor) paused() bool {
+	return g.pauser.paused() || (GTP != nil && GTP.pauser.paused())
+}
@@ -0,0 +1,135 @@
+package task
+
+import (
+	"errors"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/snap"
+	"sync"
+	"time"
+)
+
+var (
+	ControlQueueFullError = errors.New("control queue is full")
+	ControlExpiredError   = errors.New("control expired before sent")
+)
+
+type controlResult struct {
+	resp   []byte
+	values map[string]interface{} //按需抄读解析后的工程值
+	ts     int64
+	err    error
+}
+
+// controlRequest 等待下发的控制，read不为空时为按需抄读
+type controlRequest struct {
+	cmd      *command.OperateCmd
+	read     snap.PointSnap
+	deadline time.Time
+	result   chan controlResult
+}
+
+// controlQueue 控制队列，采集协程在每次采集前优先下发
+type controlQueue struct {
+	lock    sync.Mutex
+	items   []*controlRequest
+	signal  chan struct{} //有新的控制时唤醒采集协程
+	pending int           //放入队列还没有完成的控制，包括已经取出正在下发的
+	idle    chan struct{} //pending为0时关闭
+}
+
+func newControlQueue() *controlQueue {
+	idle := make(chan struct{})
+	close(idle)
+	return &controlQueue{signal: make(chan struct{}, 1), idle: idle}
+}
+
+func (q *controlQueue) push(req *controlRequest) error {
+	q.lock.Lock()
+	depth := global.Config.ControlQueueDepth
+	if depth > 0 && len(q.items) >= depth {
+		q.lock.Unlock()
+		return ControlQueueFullError
+	}
+	q.items = append(q.items, req)
+	if q.pending == 0 {
+		q.idle = make(chan struct{})
+	}
+	q.pending++
+	q.lock.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// 取出下一个没有过期的控制，过期的控制直接返回错误
+func (q *controlQueue) pop() *controlRequest {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	now := time.Now()
+	for len(q.items) > 0 {
+		req := q.items[0]
+		q.items = q.items[1:]
+		if now.Before(req.deadline) {
+			return req
+		}
+		req.result <- controlResult{err: ControlExpiredError}
+		q.release()
+	}
+	return nil
+}
+
+// 取出的控制下发完成
+func (q *controlQueue) done() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.release()
+}
+
+// 需要持有锁
+func (q *controlQueue) release() {
+	q.pending--
+	if q.pending == 0 {
+		close(q.idle)
+	}
+}
+
+// 队列中与正在下发的控制都完成时关闭
+func (q *controlQueue) drained() <-chan struct{} {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.idle
+}
+
+// 移除还没有下发的控制，已经取出时返回false
+func (q *controlQueue) remove(req *controlRequest) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, item := range q.items {
+		if item == req {
+			q.items = append(q.items[:i:i], q.items[i+1:]...)
+			q.release()
+			return true
+		}
+	}
+	return false
+}
+
+// 采集协程退出时清空队列
+func (q *controlQueue) failAll(err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, req := range q.items {
+		req.result <- controlResult{err: err}
+		q.release()
+	}
+	q.items = nil
+}
+
+func (q *controlQueue) size() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
@@ -0,0 +1,43 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestControlQueueDrained(t *testing.T) {
+	q := newControlQueue()
+	select {
+	case <-q.drained():
+	default:
+		t.Fatal("empty queue should be drained")
+	}
+	deadline := time.Now().Add(time.Minute)
+	first := &controlRequest{deadline: deadline, result: make(chan controlResult, 1)}
+	second := &controlRequest{deadline: deadline, result: make(chan controlResult, 1)}
+	if err := q.push(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.push(second); err != nil {
+		t.Fatal(err)
+	}
+	drained := q.drained()
+	if req := q.pop(); req != first {
+		t.Fatal("unexpected request")
+	}
+	if !q.remove(second) {
+		t.Fatal("second should still be queued")
+	}
+	//队列已空，但取出的控制还在下发
+	select {
+	case <-drained:
+		t.Fatal("drained while a control is in flight")
+	default:
+	}
+	q.done()
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("not drained after done")
+	}
+}
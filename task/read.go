@@ -0,0 +1,108 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sentinels/store"
+	"strings"
+	"time"
+)
+
+// ReadPoints 立即抄读设备的指定点位，不经过采集调度，返回工程值并更新实时值
+func (g *GaTaskPool) ReadPoints(id string, tags []string) ([]*model.PointValue, error) {
+	gtp, ok := g.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("not found GaTaskProcessor by: %s", id)
+	}
+	return gtp.readPoints(tags)
+}
+
+// 为指定点位构建最小的快照，作为控制优先下发，解析方式与采集相同
+func (g *GaTaskProcessor) readPoints(tags []string) ([]*model.PointValue, error) {
+	if len(tags) == 0 {
+		return nil, errors.New("tags is empty")
+	}
+	if g.retired.Load() {
+		return nil, errors.New("processor reloaded, device:" + g.device.Identifier())
+	}
+	if !g.channel().Connector.IsLinked() {
+		return nil, errors.New("connector not linked, device:" + g.device.Identifier())
+	}
+	wanted := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+	var points []*model.Point
+	for _, p := range store.DbClient.SelectPointsByDeviceId(g.device.Id) {
+		if wanted[p.Tag] {
+			points = append(points, p)
+			delete(wanted, p.Tag)
+		}
+	}
+	if len(wanted) > 0 {
+		var missing []string
+		for tag := range wanted {
+			missing = append(missing, tag)
+		}
+		return nil, fmt.Errorf("points not found in device %s: %s", g.device.Id, strings.Join(missing, ","))
+	}
+	var snaps []snap.PointSnap
+	switch g.device.ProtocolType {
+	case global.ModbusTCP, global.ModbusRTU:
+		mc, err := newModbusConvert(g.device)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range mc.convert(points).scatter().gf {
+			snaps = append(snaps, group.snap())
+		}
+	default:
+		return nil, fmt.Errorf("read points is not supported by protocol %s", g.device.ProtocolType)
+	}
+	deadline := time.Now().Add(global.DefaultTimeout)
+	values := make(map[string]*model.PointValue)
+	for _, ps := range snaps {
+		r := g.submit(&controlRequest{read: ps, deadline: deadline, result: make(chan controlResult, 1)})
+		if r.err != nil {
+			return nil, r.err
+		}
+		for tag, value := range r.values {
+			values[tag] = pointValue(tag, value, r.ts)
+		}
+	}
+	result := make([]*model.PointValue, 0, len(tags))
+	for _, tag := range tags {
+		if value, ok := values[tag]; ok {
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
+
+// 发送快照对应的抄读报文并解析，由采集协程在下发控制时调用
+func (g *GaTaskProcessor) readSnap(ps snap.PointSnap) controlResult {
+	ch := g.channel()
+	key, frame, err := ch.Codec.Copy().BuildBySnap(ps)
+	if err != nil {
+		return controlResult{err: err}
+	}
+	resp, err := ch.Connector.SendAndWaitForReply(key, frame)
+	if err == nil && len(resp) == 0 {
+		err = errors.New("empty response")
+	}
+	if err != nil {
+		realtime.invalidate(g.device.Id, snapTags(ps)...)
+		return controlResult{err: err}
+	}
+	values, err := ps.Parse(resp)
+	if err != nil {
+		return controlResult{err: err}
+	}
+	ts := time.Now().UnixMilli()
+	values = g.pb.Load().label(values)
+	g.received(g.channel(), values, ts)
+	return controlResult{values: values, ts: ts}
+}
@@ -0,0 +1,143 @@
+package task
+
+import (
+	"reflect"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sort"
+	"sync"
+)
+
+var realtime = newRealtimeCache()
+
+// realtimeCache 各设备点位的最新值，采集与按需抄读都会更新
+type realtimeCache struct {
+	lock    sync.RWMutex
+	devices map[string]map[string]*model.PointValue //map[设备id]map[tag]
+	notify  func(id string, tags []string)          //值或质量发生变化的点位，在锁外调用
+}
+
+func newRealtimeCache() *realtimeCache {
+	return &realtimeCache{devices: make(map[string]map[string]*model.PointValue)}
+}
+
+func (r *realtimeCache) update(id string, data map[string]interface{}, ts int64) {
+	r.lock.Lock()
+	values, ok := r.devices[id]
+	if !ok {
+		values = make(map[string]*model.PointValue)
+		r.devices[id] = values
+	}
+	var changed []string
+	stale := int64(global.Config.VirtualStale)
+	for tag, value := range data {
+		pv := pointValue(tag, value, ts)
+		//上一次的值已经超过virtualStale时，相同的值同样通知，使用它的虚拟点位恢复
+		if old, ok := values[tag]; !ok || old.Quality != pv.Quality || !reflect.DeepEqual(old.Value, pv.Value) ||
+			stale > 0 && ts-old.Ts >= stale {
+			changed = append(changed, tag)
+		}
+		values[tag] = pv
+	}
+	r.lock.Unlock()
+	r.changed(id, changed)
+}
+
+func (r *realtimeCache) changed(id string, tags []string) {
+	if len(tags) > 0 && r.notify != nil {
+		r.notify(id, tags)
+	}
+}
+
+// 标记为采集失败，保留最后一次的值，tags为空时标记设备的所有点位
+func (r *realtimeCache) invalidate(id string, tags ...string) {
+	r.lock.Lock()
+	values := r.devices[id]
+	if len(tags) == 0 {
+		for tag := range values {
+			tags = append(tags, tag)
+		}
+	}
+	var changed []string
+	for _, tag := range tags {
+		if value, ok := values[tag]; ok && value.Quality != global.QualityBad {
+			value.Quality = global.QualityBad
+			changed = append(changed, tag)
+		}
+	}
+	r.lock.Unlock()
+	r.changed(id, changed)
+}
+
+func (r *realtimeCache) remove(id string) {
+	r.lock.Lock()
+	tags := make([]string, 0, len(r.devices[id]))
+	for tag := range r.devices[id] {
+		tags = append(tags, tag)
+	}
+	delete(r.devices, id)
+	r.lock.Unlock()
+	r.changed(id, tags)
+}
+
+// 单个点位的实时值与质量，联锁表达式中使用
+func (r *realtimeCache) lookup(id string, tag string) (interface{}, string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	value, ok := r.devices[id][tag]
+	if !ok {
+		return nil, "", false
+	}
+	return value.Value, value.Quality, true
+}
+
+// 查询点位的实时值，tags为空时返回设备的所有点位，没有值的点位不返回
+func (r *realtimeCache) get(id string, tags ...string) []*model.PointValue {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	values := r.devices[id]
+	result := make([]*model.PointValue, 0, len(values))
+	if len(tags) == 0 {
+		for _, value := range values {
+			v := *value
+			result = append(result, &v)
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Tag < result[j].Tag
+		})
+		return result
+	}
+	for _, tag := range tags {
+		if value, ok := values[tag]; ok {
+			v := *value
+			result = append(result, &v)
+		}
+	}
+	return result
+}
+
+// Realtime 设备点位的实时值，tags为空时返回所有点位
+func (g *GaTaskPool) Realtime(id string, tags ...string) []*model.PointValue {
+	return realtime.get(id, tags...)
+}
+
+// 快照中所有点位的标签
+func snapTags(ps snap.PointSnap) []string {
+	var tags []string
+	switch s := ps.(type) {
+	case *snap.ModbusPointSnap:
+		for _, points := range s.Points {
+			for _, p := range points {
+				tags = append(tags, p.Tag)
+			}
+		}
+	case *snap.CanPointSnap:
+		for _, field := range s.Fields {
+			for _, p := range field.Points {
+				tags = append(tags, p.Tag)
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,137 @@
+package task
+
+import (
+	"math"
+	"math/rand/v2"
+	"sentinels/global"
+	"sentinels/model"
+	"sync"
+	"time"
+)
+
+// reconnector 连接器的重连状态，指数退避并在连续失败后熔断
+type reconnector struct {
+	lock        sync.Mutex
+	state       string
+	attempts    int //连续失败次数
+	lastError   string
+	nextAttempt time.Time
+	since       time.Time //进入当前状态的时间
+	up          time.Time //最近一次连接成功的时间
+}
+
+func newReconnector() *reconnector {
+	return &reconnector{state: global.ReconnectWaiting, since: time.Now()}
+}
+
+// 启动时在首次重连间隔内随机等待，避免大量设备同时连接
+func (r *reconnector) startDelay() time.Duration {
+	initial := time.Duration(global.Config.ReconnectInitial) * time.Millisecond
+	if initial <= 0 {
+		return 0
+	}
+	return rand.N(initial)
+}
+
+// 记录一次连接失败，返回下次重连前的等待时间与是否刚进入熔断
+func (r *reconnector) failed(err error) (time.Duration, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.attempts++
+	r.lastError = err.Error()
+	tripped := false
+	var delay time.Duration
+	if global.Config.BreakerThreshold > 0 && r.attempts >= global.Config.BreakerThreshold {
+		tripped = r.state != global.ReconnectFaulted
+		r.setState(global.ReconnectFaulted)
+		delay = time.Duration(global.Config.BreakerProbe) * time.Second
+	} else {
+		r.setState(global.ReconnectWaiting)
+		delay = backoff(r.attempts)
+	}
+	delay = jitter(delay)
+	r.nextAttempt = time.Now().Add(delay)
+	return delay, tripped
+}
+
+// 连接成功，失败次数保留到连接稳定后才清空
+func (r *reconnector) connected() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.up = time.Now()
+	r.nextAttempt = time.Time{}
+	r.setState(global.ReconnectConnected)
+}
+
+// 连接断开，返回重连前的等待时间，连接保持超过reconnectStable时从首次间隔开始退避
+func (r *reconnector) disconnected(err error) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if time.Since(r.up) >= time.Duration(global.Config.ReconnectStable)*time.Second {
+		r.attempts = 0
+	}
+	r.attempts++
+	r.lastError = err.Error()
+	r.setState(global.ReconnectWaiting)
+	delay := jitter(backoff(r.attempts))
+	r.nextAttempt = time.Now().Add(delay)
+	return delay
+}
+
+func (r *reconnector) stopped() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.nextAttempt = time.Time{}
+	r.setState(global.ReconnectStopped)
+}
+
+func (r *reconnector) setState(state string) {
+	if r.state != state {
+		r.state = state
+		r.since = time.Now()
+	}
+}
+
+func (r *reconnector) snapshot() *model.ReconnectState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return &model.ReconnectState{
+		State:       r.state,
+		Attempts:    r.attempts,
+		LastError:   r.lastError,
+		NextAttempt: r.nextAttempt,
+		Since:       r.since,
+	}
+}
+
+// 第n次失败后的退避时间
+func backoff(attempts int) time.Duration {
+	return expBackoff(attempts, global.Config.ReconnectInitial, global.Config.ReconnectMax, global.Config.ReconnectMultiplier)
+}
+
+// 从initial毫秒开始每次乘以multiplier（小于1时为1），不超过maxDelay毫秒（0为不限制）
+func expBackoff(attempts, initial, maxDelay int, multiplier float64) time.Duration {
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(initial) * math.Pow(multiplier, float64(attempts-1))
+	if maxDelay > 0 && delay > float64(maxDelay) {
+		delay = float64(maxDelay)
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// 在[d*(1-jitter), d*(1+jitter)]内随机
+func jitter(d time.Duration) time.Duration {
+	return jitterBy(d, global.Config.ReconnectJitter)
+}
+
+func jitterBy(d time.Duration, ratio float64) time.Duration {
+	if ratio <= 0 || d <= 0 {
+		return d
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	return time.Duration(float64(d) * (1 - ratio + 2*ratio*rand.Float64()))
+}
@@ -0,0 +1,62 @@
+package task
+
+import (
+	"errors"
+	"sentinels/global"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	want := []time.Duration{1, 2, 4, 8, 16, 32, 60, 60}
+	for i, w := range want {
+		if got := expBackoff(i+1, 1000, 60000, 2); got != w*time.Second {
+			t.Errorf("attempt %d: got %v, want %v", i+1, got, w*time.Second)
+		}
+	}
+	//倍数小于1时按1处理，最大间隔为0时不限制
+	if got := expBackoff(10, 500, 0, 0.5); got != 500*time.Millisecond {
+		t.Errorf("multiplier < 1: got %v", got)
+	}
+	if got := expBackoff(5, 1000, 0, 3); got != 81*time.Second {
+		t.Errorf("no max: got %v", got)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if got := jitterBy(10*time.Second, 0.2); got < 8*time.Second || got > 12*time.Second {
+			t.Fatalf("got %v, out of ±20%%", got)
+		}
+	}
+	if got := jitterBy(10*time.Second, 0); got != 10*time.Second {
+		t.Errorf("no jitter: got %v", got)
+	}
+	if got := jitterBy(10*time.Second, 5); got < 0 || got > 20*time.Second {
+		t.Errorf("ratio above 1: got %v", got)
+	}
+}
+
+// 连接后马上断开时继续退避，连接稳定后从首次间隔开始
+func TestDisconnectedBackoff(t *testing.T) {
+	if global.Config.BreakerThreshold > 0 && global.Config.BreakerThreshold <= 4 {
+		t.Skip("breaker threshold too low for this test")
+	}
+	within := func(got, base time.Duration) bool {
+		spread := time.Duration(float64(base) * min(max(global.Config.ReconnectJitter, 0), 1))
+		return got >= base-spread && got <= base+spread
+	}
+	r := newReconnector()
+	for i := 0; i < 3; i++ {
+		r.failed(errors.New("refused"))
+	}
+	r.connected()
+	if got := r.disconnected(errors.New("reset")); !within(got, backoff(4)) || r.attempts != 4 {
+		t.Errorf("flapping: got %v attempts %d, want about %v", got, r.attempts, backoff(4))
+	}
+	r.connected()
+	r.up = time.Now().Add(-time.Duration(global.Config.ReconnectStable)*time.Second - time.Second)
+	if got := r.disconnected(errors.New("reset")); !within(got, backoff(1)) || r.attempts != 1 {
+		t.Errorf("stable: got %v attempts %d, want about %v", got, r.attempts, backoff(1))
+	}
+}
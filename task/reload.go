@@ -0,0 +1,194 @@
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 计算签名，内容相同时签名相同
+func sign(v ...interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 设备与备用通道的签名，不包括切入切出状态与合并读取的限制
+func connectionSign(device *model.Device) (string, error) {
+	channels, err := store.DbClient.SelectChannelsByDeviceId(device.Id)
+	if err != nil {
+		return "", err
+	}
+	dev := *device
+	dev.Status = false
+	dev.MaxGap, dev.MaxRegisters, dev.MaxCoils, dev.ForbiddenRanges = 0, 0, 0, ""
+	return sign(&dev, channels), nil
+}
+
+// 点位、采集规则、合并读取限制与值映射的签名，变化时只重建点位集束器
+func pointSign(device *model.Device, points []*model.Point, collects []*model.Collect, maps []*model.ValueMap) string {
+	return sign(points, collects, device.MaxGap, device.MaxRegisters, device.MaxCoils, device.ForbiddenRanges, maps)
+}
+
+// Reload 按数据库重新加载所有设备，只处理发生变化的设备
+func (g *GaTaskPool) Reload() error {
+	g.reloadLock.Lock()
+	defer g.reloadLock.Unlock()
+	devices := store.DbClient.SelectCutInDevice()
+	wanted := make(map[string]bool, len(devices))
+	for _, device := range devices {
+		wanted[device.Id] = true
+	}
+	//停止切出或删除的设备
+	g.lock.RLock()
+	var removed []string
+	for id := range g.GTPSnapshotById {
+		if !wanted[id] {
+			removed = append(removed, id)
+		}
+	}
+	g.lock.RUnlock()
+	for _, id := range g.virtuals.ids() {
+		if !wanted[id] {
+			removed = append(removed, id)
+		}
+	}
+	for _, id := range removed {
+		g.stop(id)
+	}
+	var errs []error
+	for _, device := range devices {
+		err := g.reload(device)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("device %s: %w", device.Identifier(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReloadDevice 重新加载一个设备，切出或删除的设备会被停止
+func (g *GaTaskPool) ReloadDevice(id string) error {
+	g.reloadLock.Lock()
+	defer g.reloadLock.Unlock()
+	device, err := store.DbClient.SelectDeviceById(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		g.stop(id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !device.Status {
+		g.stop(id)
+		return nil
+	}
+	return g.reload(device)
+}
+
+func (g *GaTaskPool) reload(device *model.Device) error {
+	old, ok := g.Get(device.Id)
+	//改为虚拟设备时停止原来的调度器，反之亦然
+	if ok && device.ProtocolType == global.Virtual {
+		g.stop(device.Id)
+		ok = false
+	}
+	if device.ProtocolType != global.Virtual {
+		g.stopVirtual(device.Id)
+	}
+	if !ok {
+		return g.start(device)
+	}
+	cs, err := connectionSign(device)
+	if err != nil {
+		return err
+	}
+	if cs != old.sign {
+		return g.replace(old, device)
+	}
+	//连接参数没有变化，只重建点位集束器
+	pb, err := buildBinder(device)
+	if err != nil {
+		return err
+	}
+	if pb.sign != old.pb.Load().sign {
+		old.pb.Store(pb)
+		global.SystemLog.Infof("device %s points reloaded, points:%d", device.Identifier(), pb.points)
+	}
+	return nil
+}
+
+func (g *GaTaskPool) start(device *model.Device) error {
+	if device.ProtocolType == global.Virtual {
+		err := g.virtuals.load(device)
+		if err != nil {
+			g.createFailed(device, err)
+		}
+		return err
+	}
+	gtp, err := NewGaTaskProcessor(device)
+	if err != nil {
+		g.createFailed(device, err)
+		return err
+	}
+	g.Append(device.Id, device.Table, gtp)
+	global.SystemLog.Infof("device %s started", device.Identifier())
+	return gtp.Start()
+}
+
+// 替换调度器，等待正在执行的控制完成后再停止旧的调度器
+func (g *GaTaskPool) replace(old *GaTaskProcessor, device *model.Device) error {
+	gtp, err := NewGaTaskProcessor(device)
+	if err != nil {
+		g.createFailed(device, err)
+		return err
+	}
+	//暂停状态保持不变
+	gtp.pauser.inherit(old.pauser)
+	g.Remove(device.Id)
+	g.Append(device.Id, device.Table, gtp)
+	old.retire()
+	global.SystemLog.Infof("device %s connection changed, processor replaced", device.Identifier())
+	return gtp.Start()
+}
+
+func (g *GaTaskPool) stop(id string) {
+	if g.stopVirtual(id) {
+		return
+	}
+	gtp, ok := g.Get(id)
+	if !ok {
+		return
+	}
+	g.Remove(id)
+	gtp.retire()
+	realtime.remove(id)
+	global.SystemLog.Infof("device %s stopped", gtp.device.Identifier())
+}
+
+// 停止虚拟设备，返回是否存在
+func (g *GaTaskPool) stopVirtual(id string) bool {
+	if !g.virtuals.stop(id) {
+		return false
+	}
+	realtime.remove(id)
+	return true
+}
+
+// 调度器创建失败时同样通知订阅者
+func (g *GaTaskPool) createFailed(device *model.Device, err error) {
+	g.supervisor.publish(&model.LifecycleEvent{
+		DeviceId:   device.Id,
+		Identifier: device.Identifier(),
+		To:         global.StateOffline,
+		Reason:     "create processor failed: " + err.Error(),
+		Time:       time.Now().UnixMilli(),
+	})
+}
@@ -0,0 +1,213 @@
+package task
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	SelectConflictError = errors.New("point is selected by another requester")
+	SelectRequiredError = errors.New("point requires select before operate")
+	SelectNotFoundError = errors.New("selection not found or expired")
+)
+
+// selector 选择后执行，每个点位同一时间只有一个选择
+type selector struct {
+	lock    sync.Mutex
+	byPoint map[string]*model.Selection //map[设备id/tag]
+}
+
+func newSelector() *selector {
+	return &selector{byPoint: make(map[string]*model.Selection)}
+}
+
+func selectKey(id, tag string) string {
+	return id + "/" + tag
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 清理超时的选择
+func (s *selector) clean(now time.Time) {
+	for key, sel := range s.byPoint {
+		if now.After(sel.Expires) {
+			delete(s.byPoint, key)
+		}
+	}
+}
+
+// 占用点位，其他请求方已经选择时拒绝，同一请求方重新选择时替换原来的选择
+func (s *selector) reserve(sel *model.Selection) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clean(time.Now())
+	key := selectKey(sel.DeviceId, sel.Tag)
+	if old, ok := s.byPoint[key]; ok && old.Requester != sel.Requester {
+		return fmt.Errorf("%w: %s", SelectConflictError, sel.Tag)
+	}
+	s.byPoint[key] = sel
+	return nil
+}
+
+// 按令牌查找没有超时的选择
+func (s *selector) find(token string) *model.Selection {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clean(time.Now())
+	for _, sel := range s.byPoint {
+		if sel.Token == token {
+			return sel
+		}
+	}
+	return nil
+}
+
+// 释放选择，返回被释放的选择
+func (s *selector) release(token string) *model.Selection {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key, sel := range s.byPoint {
+		if sel.Token == token {
+			delete(s.byPoint, key)
+			return sel
+		}
+	}
+	return nil
+}
+
+// 写入点位前校验，已被选择的点位需要同一请求方携带匹配的令牌与相同的值，校验通过后选择失效
+func (s *selector) authorize(id string, point *model.Point, opt *command.ControlCarrier) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clean(time.Now())
+	key := selectKey(id, point.Tag)
+	token := opt.SboToken()
+	sel, ok := s.byPoint[key]
+	if !ok {
+		if token != "" {
+			return SelectNotFoundError
+		}
+		if point.Sbo {
+			return fmt.Errorf("%w: %s", SelectRequiredError, point.Tag)
+		}
+		return nil
+	}
+	if token != sel.Token || opt.Requester() != sel.Requester {
+		return fmt.Errorf("%w: %s", SelectConflictError, point.Tag)
+	}
+	if _, value, _ := opt.Cmd.WritePointItems(); value != sel.Value {
+		return fmt.Errorf("point %s: value %v differs from selected %v", point.Tag, value, sel.Value)
+	}
+	delete(s.byPoint, key)
+	return nil
+}
+
+func (s *selector) list() []*model.Selection {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clean(time.Now())
+	result := make([]*model.Selection, 0, len(s.byPoint))
+	for _, sel := range s.byPoint {
+		v := *sel
+		result = append(result, &v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Selected.Before(result[j].Selected)
+	})
+	return result
+}
+
+// 原始设置命令不能携带令牌，写入需要选择或已被选择的点位时拒绝，resolved为false时按设备的所有点位判断
+func (s *selector) guardRaw(id string, targets []*model.Point, resolved bool) error {
+	if !resolved {
+		targets = store.DbClient.SelectPointsByDeviceId(id)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clean(time.Now())
+	for _, p := range targets {
+		if _, ok := s.byPoint[selectKey(id, p.Tag)]; ok || p.Sbo {
+			return fmt.Errorf("%w: %s, use writePoint with select and execute", SelectRequiredError, p.Tag)
+		}
+	}
+	return nil
+}
+
+// Select 选择点位并占用，返回的令牌在timeout内执行有效，timeout为0时使用配置的默认值，选择由网关模拟
+func (g *GaTaskPool) Select(id string, tag string, value float64, requester string, timeout time.Duration) (*model.Selection, error) {
+	gtp, ok := g.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("not found GaTaskProcessor by: %s", id)
+	}
+	//提前校验点位能否写入
+	_, _, err := gtp.writeCmd(tag, value)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = time.Duration(global.Config.SboTimeout) * time.Second
+	}
+	now := time.Now()
+	sel := &model.Selection{
+		Token:     newToken(),
+		DeviceId:  id,
+		Tag:       tag,
+		Value:     value,
+		Requester: requester,
+		Selected:  now,
+		Expires:   now.Add(timeout),
+	}
+	err = g.selector.reserve(sel)
+	if err != nil {
+		return nil, err
+	}
+	v := *sel
+	return &v, nil
+}
+
+// Execute 执行选择时的值，令牌只能使用一次，执行记录在审计中
+func (g *GaTaskPool) Execute(token string, requester string) ([]byte, error) {
+	sel := g.selector.find(token)
+	if sel == nil {
+		return nil, SelectNotFoundError
+	}
+	if sel.Requester != requester {
+		return nil, fmt.Errorf("%w: %s", SelectConflictError, sel.Tag)
+	}
+	opt := command.NewCarrierByDevId(sel.DeviceId).
+		FlushWritePointCmd(sel.Tag, sel.Value).
+		FlushSboToken(token).
+		FlushRequester(requester)
+	return g.Exec(opt)
+}
+
+// Cancel 取消选择
+func (g *GaTaskPool) Cancel(token string, requester string) error {
+	sel := g.selector.find(token)
+	if sel == nil {
+		return SelectNotFoundError
+	}
+	if sel.Requester != requester {
+		return fmt.Errorf("%w: %s", SelectConflictError, sel.Tag)
+	}
+	g.selector.release(token)
+	return nil
+}
+
+// Selections 所有没有超时的选择
+func (g *GaTaskPool) Selections() []*model.Selection {
+	return g.selector.list()
+}
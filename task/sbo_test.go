@@ -0,0 +1,128 @@
+package task
+
+import (
+	"errors"
+	"sentinels/command"
+	"sentinels/model"
+	"testing"
+	"time"
+)
+
+func testSelection(requester string, value float64, expires time.Time) *model.Selection {
+	return &model.Selection{
+		Token:     newToken(),
+		DeviceId:  "d1",
+		Tag:       "BRK",
+		Value:     value,
+		Requester: requester,
+		Selected:  time.Now(),
+		Expires:   expires,
+	}
+}
+
+func TestSelectorReserve(t *testing.T) {
+	s := newSelector()
+	expires := time.Now().Add(time.Minute)
+	first := testSelection("a", 1, expires)
+	if err := s.reserve(first); err != nil {
+		t.Fatal(err)
+	}
+	//其他请求方选择同一点位时拒绝，错误中不包含占用方
+	err := s.reserve(testSelection("b", 1, expires))
+	if !errors.Is(err, SelectConflictError) {
+		t.Fatalf("conflict: got %v", err)
+	}
+	if err.Error() != SelectConflictError.Error()+": BRK" {
+		t.Errorf("conflict error leaks holder: %v", err)
+	}
+	//同一请求方重新选择时替换原来的选择
+	second := testSelection("a", 0, expires)
+	if err = s.reserve(second); err != nil {
+		t.Fatal(err)
+	}
+	if s.find(first.Token) != nil || s.find(second.Token) == nil {
+		t.Error("reselect should replace the previous selection")
+	}
+}
+
+func TestSelectorExpired(t *testing.T) {
+	s := newSelector()
+	now := time.Now()
+	old := testSelection("a", 1, now.Add(-time.Second))
+	s.byPoint[selectKey(old.DeviceId, old.Tag)] = old
+	s.clean(now)
+	if len(s.byPoint) != 0 {
+		t.Fatal("expired selection should be cleaned")
+	}
+	//超时的选择不再占用点位
+	s.byPoint[selectKey(old.DeviceId, old.Tag)] = old
+	if err := s.reserve(testSelection("b", 1, now.Add(time.Minute))); err != nil {
+		t.Errorf("reserve after expiry: %v", err)
+	}
+	if s.find(old.Token) != nil {
+		t.Error("expired token should not be found")
+	}
+}
+
+func TestSelectorAuthorize(t *testing.T) {
+	point := &model.Point{Tag: "BRK", Sbo: true}
+	write := func(tag string, value float64, token, requester string) *command.ControlCarrier {
+		return command.NewCarrierByDevId("d1").FlushWritePointCmd(tag, value).FlushSboToken(token).FlushRequester(requester)
+	}
+	s := newSelector()
+	if err := s.authorize("d1", point, write("BRK", 1, "", "a")); !errors.Is(err, SelectRequiredError) {
+		t.Errorf("no selection: got %v", err)
+	}
+	if err := s.authorize("d1", point, write("BRK", 1, "unknown", "a")); !errors.Is(err, SelectNotFoundError) {
+		t.Errorf("unknown token: got %v", err)
+	}
+	sel := testSelection("a", 1, time.Now().Add(time.Minute))
+	if err := s.reserve(sel); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		opt  *command.ControlCarrier
+	}{
+		{"other value", write("BRK", 0, sel.Token, "a")},
+		{"other token", write("BRK", 1, "", "a")},
+		{"other requester", write("BRK", 1, sel.Token, "b")},
+	}
+	for _, c := range cases {
+		if err := s.authorize("d1", point, c.opt); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+	//其他点位的选择不能用于写入该点位
+	other := &model.Point{Tag: "VALVE", Sbo: true}
+	if err := s.authorize("d1", other, write("VALVE", 1, sel.Token, "a")); !errors.Is(err, SelectNotFoundError) {
+		t.Errorf("other point: got %v", err)
+	}
+	if err := s.authorize("d1", point, write("BRK", 1, sel.Token, "a")); err != nil {
+		t.Fatal(err)
+	}
+	//令牌只能使用一次
+	if err := s.authorize("d1", point, write("BRK", 1, sel.Token, "a")); !errors.Is(err, SelectNotFoundError) {
+		t.Errorf("reused token: got %v", err)
+	}
+}
+
+func TestSelectorGuardRaw(t *testing.T) {
+	s := newSelector()
+	plain := []*model.Point{{Tag: "BRK"}}
+	if err := s.guardRaw("d1", plain, true); err != nil {
+		t.Errorf("unselected point: %v", err)
+	}
+	if err := s.reserve(testSelection("a", 1, time.Now().Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.guardRaw("d1", plain, true); !errors.Is(err, SelectRequiredError) {
+		t.Errorf("selected point: got %v", err)
+	}
+	if err := s.guardRaw("d2", plain, true); err != nil {
+		t.Errorf("other device: %v", err)
+	}
+	if err := s.guardRaw("d1", []*model.Point{{Tag: "VALVE", Sbo: true}}, true); !errors.Is(err, SelectRequiredError) {
+		t.Errorf("sbo point: got %v", err)
+	}
+}
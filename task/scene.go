@@ -0,0 +1,464 @@
+package task
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sentinels/store"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sceneEnd          = "end" //分支跳转到end时结束场景
+	maxSceneSteps     = 1000  //一次执行最多执行的步骤数，防止分支死循环
+	defaultPollPeriod = time.Second
+)
+
+var SceneRunningError = errors.New("scene is already running")
+
+// sceneSteps 解析后的场景
+type sceneSteps struct {
+	scene    *model.Scene
+	steps    []*model.SceneStep
+	rollback []*model.SceneStep
+	index    map[string]int
+}
+
+// ValidateScene 校验场景的步骤
+func ValidateScene(scene *model.Scene) error {
+	_, err := compileScene(scene)
+	return err
+}
+
+func compileScene(scene *model.Scene) (*sceneSteps, error) {
+	ss := &sceneSteps{scene: scene, index: make(map[string]int)}
+	if err := json.Unmarshal(scene.Steps, &ss.steps); err != nil || len(ss.steps) == 0 {
+		return nil, fmt.Errorf("scene steps is invalid: %v", err)
+	}
+	if len(scene.Rollback) > 0 {
+		if err := json.Unmarshal(scene.Rollback, &ss.rollback); err != nil {
+			return nil, fmt.Errorf("scene rollback is invalid: %w", err)
+		}
+	}
+	for i, step := range ss.steps {
+		if step.Name == "" {
+			continue
+		}
+		if step.Name == sceneEnd {
+			return nil, fmt.Errorf("step name %q is reserved", sceneEnd)
+		}
+		if _, ok := ss.index[step.Name]; ok {
+			return nil, fmt.Errorf("step name %q is duplicated", step.Name)
+		}
+		ss.index[step.Name] = i
+	}
+	for i, step := range ss.steps {
+		if err := ss.check(step); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	for i, step := range ss.rollback {
+		if step.Kind == global.StepBranch {
+			return nil, fmt.Errorf("rollback step %d: branch is not allowed", i+1)
+		}
+		if err := ss.check(step); err != nil {
+			return nil, fmt.Errorf("rollback step %d: %w", i+1, err)
+		}
+	}
+	return ss, nil
+}
+
+func (ss *sceneSteps) check(step *model.SceneStep) error {
+	switch step.Kind {
+	case global.StepWrite:
+		if strings.TrimSpace(step.DeviceId) == "" {
+			return errors.New("write needs deviceId")
+		}
+		cmd, err := stepCommand(step)
+		if err != nil {
+			return err
+		}
+		return cmd.Check()
+	case global.StepWait:
+		if step.Duration <= 0 {
+			return errors.New("wait needs duration")
+		}
+	case global.StepWaitUntil:
+		if strings.TrimSpace(step.DeviceId) == "" || strings.TrimSpace(step.Tag) == "" {
+			return errors.New("waitUntil needs deviceId and tag")
+		}
+		if step.Timeout <= 0 {
+			return errors.New("waitUntil needs timeout")
+		}
+	case global.StepBranch:
+		if strings.TrimSpace(step.Condition) == "" {
+			return errors.New("branch needs condition")
+		}
+		for _, target := range []string{step.Goto, step.Else} {
+			if _, ok := ss.index[target]; !ok && target != "" && target != sceneEnd {
+				return fmt.Errorf("branch target %q not found", target)
+			}
+		}
+	default:
+		return fmt.Errorf("step kind must be %s, %s, %s or %s",
+			global.StepWrite, global.StepWait, global.StepWaitUntil, global.StepBranch)
+	}
+	return nil
+}
+
+// 每次执行都重新解析，避免命令被修改
+func stepCommand(step *model.SceneStep) (*command.OperateCmd, error) {
+	var cmd *command.OperateCmd
+	if err := json.Unmarshal(step.Cmd, &cmd); err != nil || cmd == nil {
+		return nil, fmt.Errorf("write cmd is invalid: %v", err)
+	}
+	if cmd.Value == nil {
+		cmd.Value = make(map[string]string)
+	}
+	return cmd, nil
+}
+
+// 跳转目标的序号，为空时为下一步
+func (ss *sceneSteps) target(name string, pc int) int {
+	switch name {
+	case "":
+		return pc + 1
+	case sceneEnd:
+		return len(ss.steps)
+	default:
+		return ss.index[name]
+	}
+}
+
+// sceneExecution 正在执行的场景
+type sceneExecution struct {
+	run    *model.SceneRun
+	cancel context.CancelFunc
+	seq    int
+}
+
+// sceneRunner 管理正在执行的场景并分发执行进度
+type sceneRunner struct {
+	lock        sync.Mutex
+	running     map[string]*sceneExecution //场景id
+	subscribers map[int]chan *model.SceneEvent
+	nextId      int
+}
+
+func newSceneRunner() *sceneRunner {
+	return &sceneRunner{
+		running:     make(map[string]*sceneExecution),
+		subscribers: make(map[int]chan *model.SceneEvent),
+	}
+}
+
+// 分发进度，订阅者处理不过来时丢弃，不阻塞场景执行
+func (r *sceneRunner) publish(event *model.SceneEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+			global.SystemLog.Warnf("scene subscriber is full, drop event of run %d", event.RunId)
+		}
+	}
+}
+
+func (r *sceneRunner) subscribe(buffer int) (<-chan *model.SceneEvent, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan *model.SceneEvent, buffer)
+	r.lock.Lock()
+	id := r.nextId
+	r.nextId++
+	r.subscribers[id] = ch
+	r.lock.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			r.lock.Lock()
+			delete(r.subscribers, id)
+			r.lock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// RunScene 开始执行场景，同一场景同时只能执行一次，返回执行记录，进度通过SubscribeScenes获取
+func (g *GaTaskPool) RunScene(id string, requester string) (*model.SceneRun, error) {
+	scene, err := store.DbClient.SelectSceneById(id)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := compileScene(scene)
+	if err != nil {
+		return nil, err
+	}
+	if requester == "" {
+		requester = "scene:" + scene.ID
+	}
+	r := g.scenes
+	r.lock.Lock()
+	if _, ok := r.running[scene.ID]; ok {
+		r.lock.Unlock()
+		return nil, fmt.Errorf("%w: %s", SceneRunningError, scene.Name)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	exec := &sceneExecution{
+		run: &model.SceneRun{
+			SceneId:   scene.ID,
+			Requester: requester,
+			Status:    global.SceneRunning,
+			Start:     time.Now().UnixMilli(),
+		},
+		cancel: cancel,
+	}
+	if err = store.DbClient.SaveSceneRun(exec.run); err != nil {
+		r.lock.Unlock()
+		cancel()
+		return nil, err
+	}
+	r.running[scene.ID] = exec
+	r.lock.Unlock()
+	global.SystemLog.Infof("scene %s(%s) run %d started by %s", scene.ID, scene.Name, exec.run.ID, requester)
+	run := *exec.run
+	go r.execute(ctx, ss, exec)
+	return &run, nil
+}
+
+// AbortScene 中止正在执行的场景，当前步骤完成后执行回滚
+func (g *GaTaskPool) AbortScene(runId uint) error {
+	r := g.scenes
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, exec := range r.running {
+		if exec.run.ID == runId {
+			exec.cancel()
+			return nil
+		}
+	}
+	return fmt.Errorf("scene run %d is not running", runId)
+}
+
+// SubscribeScenes 订阅所有场景的执行进度，使用完毕后调用返回的函数取消订阅
+func (g *GaTaskPool) SubscribeScenes(buffer int) (<-chan *model.SceneEvent, func()) {
+	return g.scenes.subscribe(buffer)
+}
+
+func (r *sceneRunner) execute(ctx context.Context, ss *sceneSteps, exec *sceneExecution) {
+	defer exec.cancel()
+	run := exec.run
+	r.publish(&model.SceneEvent{RunId: run.ID, SceneId: run.SceneId, Status: run.Status, Time: time.Now().UnixMilli()})
+	var failure error
+	for pc, count := 0, 0; pc < len(ss.steps); count++ {
+		if count >= maxSceneSteps {
+			failure = fmt.Errorf("more than %d steps executed, check branch loop", maxSceneSteps)
+			break
+		}
+		if ctx.Err() != nil {
+			failure = context.Canceled
+			break
+		}
+		step := ss.steps[pc]
+		r.progress(exec, stepLabel(step, pc))
+		result, next := r.step(ctx, exec, step, pc, false)
+		if result.Outcome != global.OutcomeSuccess {
+			failure = fmt.Errorf("step %s: %s", stepLabel(step, pc), result.Error)
+			break
+		}
+		if step.Kind == global.StepBranch {
+			pc = ss.target(next, pc)
+		} else {
+			pc++
+		}
+	}
+	status := global.SceneSuccess
+	if failure != nil {
+		status = global.SceneFailed
+		if errors.Is(failure, context.Canceled) || ctx.Err() != nil {
+			status = global.SceneAborted
+		}
+		global.SystemLog.Errorf("scene %s run %d %s: %s, rollback", run.SceneId, run.ID, status, failure.Error())
+		//回滚不受中止影响，单个步骤失败时继续执行后面的步骤
+		for i, step := range ss.rollback {
+			r.progress(exec, "rollback "+stepLabel(step, i))
+			result, _ := r.step(context.Background(), exec, step, i, true)
+			if result.Outcome != global.OutcomeSuccess {
+				global.SystemLog.Errorf("scene %s run %d rollback step %s failed: %s",
+					run.SceneId, run.ID, stepLabel(step, i), result.Error)
+			}
+		}
+	}
+	r.lock.Lock()
+	run.Status = status
+	run.Step = ""
+	run.Finish = time.Now().UnixMilli()
+	if failure != nil {
+		run.Error = failure.Error()
+	}
+	delete(r.running, run.SceneId)
+	final := *run
+	r.lock.Unlock()
+	if err := store.DbClient.SaveSceneRun(&final); err != nil {
+		global.SystemLog.Errorf("save scene run %d err:%s", final.ID, err.Error())
+	}
+	global.SystemLog.Infof("scene %s run %d finished: %s", final.SceneId, final.ID, status)
+	r.publish(&model.SceneEvent{RunId: final.ID, SceneId: final.SceneId, Status: status, Time: final.Finish})
+}
+
+// 记录正在执行的步骤
+func (r *sceneRunner) progress(exec *sceneExecution, label string) {
+	r.lock.Lock()
+	exec.run.Step = label
+	run := *exec.run
+	r.lock.Unlock()
+	if err := store.DbClient.SaveSceneRun(&run); err != nil {
+		global.SystemLog.Errorf("save scene run %d err:%s", run.ID, err.Error())
+	}
+}
+
+// 执行一个步骤并保存结果，branch返回跳转的步骤名称
+func (r *sceneRunner) step(ctx context.Context, exec *sceneExecution, step *model.SceneStep, index int, rollback bool) (*model.SceneStepResult, string) {
+	exec.seq++
+	result := &model.SceneStepResult{
+		RunId:    exec.run.ID,
+		Seq:      exec.seq,
+		Index:    index,
+		Name:     step.Name,
+		Kind:     step.Kind,
+		Rollback: rollback,
+		Start:    time.Now().UnixMilli(),
+	}
+	var next string
+	var err error
+	switch step.Kind {
+	case global.StepWrite:
+		err = r.write(exec, step, result)
+	case global.StepWait:
+		err = sleepContext(ctx, time.Duration(step.Duration)*time.Millisecond)
+	case global.StepWaitUntil:
+		err = waitUntil(ctx, step, result)
+	case global.StepBranch:
+		var ok bool
+		ok, err = snap.EvalInterlock(step.Condition, &snap.InterlockEnv{Lookup: realtime.lookup})
+		result.Value = strconv.FormatBool(ok)
+		next = step.Else
+		if ok {
+			next = step.Goto
+		}
+	}
+	result.Finish = time.Now().UnixMilli()
+	result.Outcome = global.OutcomeSuccess
+	if err != nil {
+		result.Outcome = global.OutcomeFailed
+		result.Error = err.Error()
+	}
+	if se := store.DbClient.SaveSceneStep(result); se != nil {
+		global.SystemLog.Errorf("save scene step of run %d err:%s", exec.run.ID, se.Error())
+	}
+	r.publish(&model.SceneEvent{
+		RunId:   exec.run.ID,
+		SceneId: exec.run.SceneId,
+		Status:  global.SceneRunning,
+		Step:    result,
+		Time:    result.Finish,
+	})
+	return result, next
+}
+
+// 通过Exec下发，唯一标识由执行记录与执行顺序组成
+func (r *sceneRunner) write(exec *sceneExecution, step *model.SceneStep, result *model.SceneStepResult) error {
+	cmd, err := stepCommand(step)
+	if err != nil {
+		return err
+	}
+	opt := command.NewCarrierByDevId(step.DeviceId).
+		FlushUniqueIdentifier(fmt.Sprintf("scene-%d-%d", exec.run.ID, exec.seq)).
+		FlushRequester(exec.run.Requester)
+	opt.ReplySize = step.ReplySize
+	opt.Cmd = cmd
+	resp, err := GTP.Exec(opt)
+	result.Response = hex.EncodeToString(resp)
+	return err
+}
+
+// 按间隔立即抄读点位，直到与目标值的偏差不超过tolerance
+func waitUntil(ctx context.Context, step *model.SceneStep, result *model.SceneStepResult) error {
+	interval := time.Duration(step.Interval) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultPollPeriod
+	}
+	deadline := time.Now().Add(time.Duration(step.Timeout) * time.Millisecond)
+	var last error
+	for {
+		values, err := GTP.ReadPoints(step.DeviceId, []string{step.Tag})
+		if err == nil && len(values) > 0 {
+			result.Value = fmt.Sprint(values[0].Value)
+			value, ok := numberOf(values[0].Value)
+			if ok && math.Abs(value-step.Value) <= step.Tolerance {
+				return nil
+			}
+			last = fmt.Errorf("%s is %s, want %v", step.Tag, result.Value, step.Value)
+		} else if err != nil {
+			last = err
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return fmt.Errorf("timeout after %dms: %v", step.Timeout, last)
+		}
+		if err = sleepContext(ctx, min(interval, wait)); err != nil {
+			return err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func numberOf(value interface{}) (float64, bool) {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	n, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+	return n, err == nil
+}
+
+func stepLabel(step *model.SceneStep, index int) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+// SceneRunDetail 场景执行记录与步骤结果
+func (g *GaTaskPool) SceneRunDetail(runId uint) (*model.SceneRun, []*model.SceneStepResult, error) {
+	run, err := store.DbClient.SelectSceneRunById(runId)
+	if err != nil {
+		return nil, nil, err
+	}
+	steps, err := store.DbClient.SelectSceneSteps(runId)
+	return run, steps, err
+}
@@ -0,0 +1,67 @@
+package task
+
+import (
+	"sentinels/model"
+	"strings"
+	"testing"
+)
+
+func testScene(steps, rollback string) *model.Scene {
+	scene := &model.Scene{ID: "s1", Steps: []byte(steps)}
+	if rollback != "" {
+		scene.Rollback = []byte(rollback)
+	}
+	return scene
+}
+
+func TestCompileSceneInvalid(t *testing.T) {
+	cases := []struct {
+		name     string
+		steps    string
+		rollback string
+		want     string
+	}{
+		{"empty", `[]`, "", "steps is invalid"},
+		{"duplicate name", `[{"name":"a","kind":"wait","duration":1},{"name":"a","kind":"wait","duration":1}]`, "", "duplicated"},
+		{"reserved name", `[{"name":"end","kind":"wait","duration":1}]`, "", "reserved"},
+		{"unknown goto", `[{"kind":"branch","condition":"true","goto":"x"}]`, "", "not found"},
+		{"unknown else", `[{"name":"a","kind":"wait","duration":1},{"kind":"branch","condition":"true","goto":"a","else":"b"}]`, "", "not found"},
+		{"rollback branch", `[{"name":"a","kind":"wait","duration":1}]`, `[{"kind":"branch","condition":"true","goto":"a"}]`, "branch is not allowed"},
+		{"unknown kind", `[{"kind":"sleep"}]`, "", "step kind"},
+		{"wait duration", `[{"kind":"wait"}]`, "", "duration"},
+		{"waitUntil timeout", `[{"kind":"waitUntil","deviceId":"d1","tag":"T"}]`, "", "timeout"},
+	}
+	for _, c := range cases {
+		_, err := compileScene(testScene(c.steps, c.rollback))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want error containing %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestSceneTarget(t *testing.T) {
+	ss, err := compileScene(testScene(`[
+		{"name":"start","kind":"wait","duration":1},
+		{"kind":"branch","condition":"true","goto":"done","else":"end"},
+		{"kind":"wait","duration":1},
+		{"name":"done","kind":"wait","duration":1}
+	]`, `[{"kind":"wait","duration":1}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		pc   int
+		want int
+	}{
+		{"", 1, 2},
+		{"end", 1, 4},
+		{"done", 1, 3},
+		{"start", 2, 0},
+	}
+	for _, c := range cases {
+		if got := ss.target(c.name, c.pc); got != c.want {
+			t.Errorf("target %q from %d: got %d, want %d", c.name, c.pc, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"fmt"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"time"
+)
+
+// 优先级分道，下标越大优先级越高
+const (
+	laneLow = iota
+	laneMiddle
+	laneHigh
+	priorityLanes
+)
+
+// 优先级对应的分道，未配置优先级的点位按低优先级处理
+func priorityRank(priority byte) int {
+	switch priority {
+	case global.PriorityHigh:
+		return laneHigh
+	case global.PriorityMiddle:
+		return laneMiddle
+	default:
+		return laneLow
+	}
+}
+
+// 点位中最高的优先级
+func highestPriority(points []*model.Point) byte {
+	var priority byte
+	for _, point := range points {
+		if priority == 0 || priorityRank(point.Priority) > priorityRank(priority) {
+			priority = point.Priority
+		}
+	}
+	return priority
+}
+
+// 各分道的权重，最小为1
+func priorityWeights(low, middle, high int) [priorityLanes]int {
+	weights := [priorityLanes]int{
+		laneLow:    low,
+		laneMiddle: middle,
+		laneHigh:   high,
+	}
+	for lane, weight := range weights {
+		if weight < 1 {
+			weights[lane] = 1
+		}
+	}
+	return weights
+}
+
+// scheduled 一个采集组的调度信息
+type scheduled struct {
+	ps       snap.PointSnap
+	points   int
+	priority byte
+	interval time.Duration
+	next     time.Time //下次计划采集时间
+	queued   bool      //已经到期，等待采集
+	polls    int64
+	overruns int64
+	lastLate time.Duration
+	lastPoll time.Time
+}
+
+func newScheduled(ps snap.PointSnap, points []*model.Point, priority byte, interval int) *scheduled {
+	if interval <= 0 {
+		interval = pointsInterval(points)
+	}
+	if interval <= 0 {
+		interval = global.Config.CollectInterval
+	}
+	if interval <= 0 {
+		interval = 1
+	}
+	return &scheduled{
+		ps:       ps,
+		points:   len(points),
+		priority: priority,
+		interval: time.Duration(interval) * time.Millisecond,
+	}
+}
+
+// 同组点位取最小的采集间隔
+func pointsInterval(points []*model.Point) int {
+	interval := 0
+	for _, point := range points {
+		if point.Interval > 0 && (interval == 0 || point.Interval < interval) {
+			interval = point.Interval
+		}
+	}
+	return interval
+}
+
+// 记录一次采集并计算下次计划时间，错过的周期不再补采
+func (s *scheduled) polled(now time.Time) {
+	late := now.Sub(s.next)
+	if late < 0 {
+		late = 0
+	}
+	if late >= s.interval {
+		s.overruns++
+	}
+	s.polls++
+	s.lastLate = late
+	s.lastPoll = now
+	s.queued = false
+	//与计划时间对齐，同周期的组在同一轮采集
+	s.next = s.next.Add(s.interval)
+	if !s.next.After(now) {
+		s.next = s.next.Add(s.interval * (now.Sub(s.next)/s.interval + 1))
+	}
+}
+
+func (s *scheduled) label() string {
+	return fmt.Sprintf("%x@%x", s.ps.FunctionCode(), s.ps.Address())
+}
+
+func (s *scheduled) snapshot() *model.GroupSchedule {
+	return &model.GroupSchedule{
+		Group:    s.label(),
+		Points:   s.points,
+		Priority: s.priority,
+		Interval: s.interval.Milliseconds(),
+		Polls:    s.polls,
+		Overruns: s.overruns,
+		LastLate: s.lastLate.Milliseconds(),
+		LastPoll: s.lastPoll,
+		NextDue:  s.next,
+	}
+}
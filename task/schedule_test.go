@@ -0,0 +1,175 @@
+package task
+
+import (
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"testing"
+	"time"
+)
+
+func testGroup(addr uint16, priority byte, interval int, next time.Time) *scheduled {
+	ps := &snap.ModbusPointSnap{FuncCode: 0x03, StartAddress: addr, EndAddress: addr, Size: 1}
+	group := newScheduled(ps, []*model.Point{{Priority: priority}}, priority, interval)
+	group.next = next
+	return group
+}
+
+func testBinder(groups ...*scheduled) *PointBinder {
+	return &PointBinder{groups: groups, weights: priorityWeights(1, 1, 1)}
+}
+
+// 采集组的起始地址，没有到期的组时为-1
+func polledAddr(ps snap.PointSnap) int {
+	if ps == nil {
+		return -1
+	}
+	return int(ps.(*snap.ModbusPointSnap).StartAddress)
+}
+
+func TestBinderIntervals(t *testing.T) {
+	start := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	fast := testGroup(1, global.PriorityLow, 100, start)
+	slow := testGroup(2, global.PriorityLow, 300, start)
+	b := testBinder(fast, slow)
+	//采集不耗时，每次没有到期的组时等待到下一个计划时间
+	counts := make(map[int]int)
+	for now := start; now.Before(start.Add(1200 * time.Millisecond)); {
+		ps, wait := b.Next(now)
+		if ps == nil {
+			now = now.Add(wait)
+			continue
+		}
+		if wait != 0 {
+			t.Fatalf("at %v: got wait %v with a group", now, wait)
+		}
+		counts[polledAddr(ps)]++
+	}
+	if counts[1] != 12 || counts[2] != 4 {
+		t.Errorf("got %v, want 12 fast and 4 slow polls", counts)
+	}
+	if fast.overruns != 0 || slow.overruns != 0 {
+		t.Errorf("unexpected overruns: %d %d", fast.overruns, slow.overruns)
+	}
+}
+
+func TestBinderMergeDue(t *testing.T) {
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	b := testBinder(
+		testGroup(1, global.PriorityLow, 1000, now.Add(-20*time.Millisecond)),
+		testGroup(2, global.PriorityLow, 1000, now),
+		testGroup(3, global.PriorityLow, 1000, now.Add(30*time.Millisecond)),
+	)
+	//已经到期的组在同一轮依次采集，不需要等待
+	for _, want := range []int{1, 2} {
+		ps, wait := b.Next(now)
+		if polledAddr(ps) != want || wait != 0 {
+			t.Fatalf("got group %d wait %v, want group %d", polledAddr(ps), wait, want)
+		}
+	}
+	if ps, wait := b.Next(now); ps != nil || wait != 30*time.Millisecond {
+		t.Errorf("got group %d wait %v, want wait 30ms", polledAddr(ps), wait)
+	}
+}
+
+func TestBinderWait(t *testing.T) {
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		b    *PointBinder
+		want time.Duration
+	}{
+		{"no groups", testBinder(), global.IdleWait},
+		{"earliest", testBinder(
+			testGroup(1, global.PriorityLow, 1000, now.Add(50*time.Millisecond)),
+			testGroup(2, global.PriorityHigh, 1000, now.Add(20*time.Millisecond)),
+			testGroup(3, global.PriorityMiddle, 1000, now.Add(70*time.Millisecond)),
+		), 20 * time.Millisecond},
+		{"idle cap", testBinder(testGroup(1, global.PriorityLow, 1000, now.Add(global.IdleWait+time.Second))), global.IdleWait},
+	}
+	for _, c := range cases {
+		if ps, wait := c.b.Next(now); ps != nil || wait != c.want {
+			t.Errorf("%s: got group %d wait %v, want %v", c.name, polledAddr(ps), wait, c.want)
+		}
+	}
+}
+
+func TestScheduledPolled(t *testing.T) {
+	start := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	group := testGroup(1, global.PriorityLow, 100, start)
+	cases := []struct {
+		at       time.Duration //采集时间，相对start
+		late     time.Duration
+		overruns int64
+		next     time.Duration
+	}{
+		{ms(0), 0, 0, ms(100)},
+		//在计划时间之前采集时不算延迟
+		{ms(90), 0, 0, ms(200)},
+		{ms(250), ms(50), 0, ms(300)},
+		//延迟达到一个周期记为超时，错过的周期不再补采，仍与计划时间对齐
+		{ms(400), ms(100), 1, ms(500)},
+		{ms(880), ms(380), 2, ms(900)},
+	}
+	for _, c := range cases {
+		group.polled(start.Add(c.at))
+		if group.lastLate != c.late || group.overruns != c.overruns || !group.next.Equal(start.Add(c.next)) {
+			t.Errorf("at %v: got late %v overruns %d next %v, want %v %d %v",
+				c.at, group.lastLate, group.overruns, group.next.Sub(start), c.late, c.overruns, c.next)
+		}
+	}
+	if group.polls != int64(len(cases)) || group.queued {
+		t.Errorf("got polls %d queued %v", group.polls, group.queued)
+	}
+}
+
+func TestPickLaneEmpty(t *testing.T) {
+	b := testBinder()
+	if lane := b.pickLane(); lane != -1 {
+		t.Errorf("no due groups: got lane %d", lane)
+	}
+	//只有一个分道有到期的组时总是选择该分道
+	b.lanes[laneLow] = []*scheduled{testGroup(1, global.PriorityLow, 100, time.Time{})}
+	for i := 0; i < 5; i++ {
+		if lane := b.pickLane(); lane != laneLow {
+			t.Fatalf("pick %d: got lane %d", i, lane)
+		}
+	}
+}
+
+func TestPriorityWeights(t *testing.T) {
+	if got := priorityWeights(0, -3, 8); got != [priorityLanes]int{1, 1, 8} {
+		t.Errorf("got %v, want weights of at least 1", got)
+	}
+}
+
+func TestPickLaneRatio(t *testing.T) {
+	cases := []struct{ low, middle, high int }{{1, 3, 5}, {1, 1, 1}, {2, 1, 10}, {0, 0, 4}}
+	for _, c := range cases {
+		b := testBinder()
+		b.weights = priorityWeights(c.low, c.middle, c.high)
+		//各分道一直有到期的组
+		for lane := range b.lanes {
+			b.lanes[lane] = []*scheduled{testGroup(uint16(lane), global.PriorityLow, 100, time.Time{})}
+		}
+		round := b.weights[laneLow] + b.weights[laneMiddle] + b.weights[laneHigh]
+		var counts [priorityLanes]int
+		sinceLow := 0
+		for i := 0; i < round*10; i++ {
+			lane := b.pickLane()
+			counts[lane]++
+			if lane == laneLow {
+				sinceLow = 0
+			} else if sinceLow++; sinceLow >= round {
+				t.Fatalf("%v: low lane not served within %d picks", c, round)
+			}
+		}
+		for lane, weight := range b.weights {
+			if counts[lane] != weight*10 {
+				t.Errorf("%v: got %v picks, want ratio %v", c, counts, b.weights)
+				break
+			}
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package task
 
 import (
+	"errors"
 	"fmt"
 	"sentinels/command"
 	"sentinels/global"
+	"sentinels/model"
 	"sentinels/store"
+	"sort"
+	"sync"
+	"time"
 )
 
 var GTP *GaTaskPool
@@ -12,17 +17,69 @@ var GTP *GaTaskPool
 type GaTaskPool struct {
 	GTPSnapshotById        map[string]*GaTaskProcessor
 	GTPSnapshotByTableFlag map[string]*GaTaskProcessor
+	lock                   sync.RWMutex
+	reloadLock             sync.Mutex //同一时间只有一次重新加载
+	pauser                 *pauser    //全局暂停
+	supervisor             *supervisor
+	dedup                  *deduplicator
+	selector               *selector
+	jobs                   *jobScheduler
+	scenes                 *sceneRunner
+	virtuals               *virtualEngine //虚拟设备
 }
 
 func (g *GaTaskPool) Append(id string, tableFlag string, gtpr *GaTaskProcessor) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
 	g.GTPSnapshotById[id] = gtpr
 	g.GTPSnapshotByTableFlag[tableFlag] = gtpr
 }
 
+// Remove 移除设备的调度器
+func (g *GaTaskPool) Remove(id string) *GaTaskProcessor {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	gtp, ok := g.GTPSnapshotById[id]
+	if !ok {
+		return nil
+	}
+	delete(g.GTPSnapshotById, id)
+	if g.GTPSnapshotByTableFlag[gtp.device.Table] == gtp {
+		delete(g.GTPSnapshotByTableFlag, gtp.device.Table)
+	}
+	return gtp
+}
+
+// Get 根据设备id获取调度器
+func (g *GaTaskPool) Get(id string) (*GaTaskProcessor, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	gtp, ok := g.GTPSnapshotById[id]
+	return gtp, ok
+}
+
 func init() {
 	GTP = &GaTaskPool{
 		GTPSnapshotById:        map[string]*GaTaskProcessor{},
 		GTPSnapshotByTableFlag: map[string]*GaTaskProcessor{},
+		pauser:                 newPauser(pauseKey),
+		supervisor:             newSupervisor(),
+		dedup:                  newDeduplicator(),
+		selector:               newSelector(),
+		jobs:                   newJobScheduler(),
+		scenes:                 newSceneRunner(),
+		virtuals:               newVirtualEngine(time.Duration(global.Config.VirtualStale) * time.Millisecond),
+	}
+	//虚拟点位
+	realtime.notify = GTP.virtuals.changed
+	go GTP.virtuals.run()
+	//定时控制
+	if err := GTP.jobs.load(); err != nil {
+		global.SystemLog.Errorf("load control jobs err:%s", err.Error())
+	}
+	go GTP.jobs.run()
+	if err := store.DbClient.InterruptSceneRuns(); err != nil {
+		global.SystemLog.Errorf("interrupt scene runs err:%s", err.Error())
 	}
 	//查询切入的设备
 	devices := store.DbClient.SelectCutInDevice()
@@ -30,42 +87,127 @@ func init() {
 		return
 	}
 	for _, device := range devices {
-		//创建调度器
-		gtp, err := NewGaTaskProcessor(devices[0])
+		//创建调度器并启动
+		err := GTP.start(device)
 		if err != nil {
 			global.SystemLog.Error(fmt.Sprintf("id:%s name:%s type:%s err:%s", device.Id, device.Name, device.Code, err.Error()))
-			continue
 		}
-		go func() {
-			_ = gtp.Start()
-		}()
-		GTP.Append(device.Id, device.Table, gtp)
 	}
 }
 
+// Monitor 所有设备的运行状态
+func (g *GaTaskPool) Monitor() []*model.DeviceMonitor {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	result := make([]*model.DeviceMonitor, 0, len(g.GTPSnapshotById))
+	for _, gtp := range g.GTPSnapshotById {
+		result = append(result, gtp.Monitor())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Exec 执行控制，过期的命令不会下发，相同唯一标识的命令在去重窗口内只执行一次，每次执行都会记录审计
 func (g *GaTaskPool) Exec(opt *command.ControlCarrier) ([]byte, error) {
+	audit := newAudit(opt)
+	resp, err := g.exec(opt, audit)
+	finishAudit(audit, opt, resp, err)
+	return resp, err
+}
+
+func (g *GaTaskPool) exec(opt *command.ControlCarrier, audit *model.ControlAudit) ([]byte, error) {
 	err := opt.Check()
 	if err != nil {
+		audit.Outcome = global.OutcomeRejected
 		return nil, err
 	}
+	if opt.Expired(time.Now()) {
+		audit.Outcome = global.OutcomeExpired
+		return nil, ControlExpiredError
+	}
+	//重复的命令返回首次执行的结果
+	entry, first := g.dedup.begin(opt.UniqueIdentifier())
+	if !first {
+		audit.Outcome = global.OutcomeDuplicate
+		return entry.wait()
+	}
+	var resp []byte
+	defer func() {
+		g.dedup.finish(opt.UniqueIdentifier(), entry, resp, err)
+	}()
 	var gtp *GaTaskProcessor
 	signType, sign := opt.ObtainSign()
+	g.lock.RLock()
 	if signType == global.LogoTypeId {
 		gtp = g.GTPSnapshotById[sign]
 	} else {
 		gtp = g.GTPSnapshotByTableFlag[sign]
 	}
+	g.lock.RUnlock()
 	if gtp == nil {
-		return nil, fmt.Errorf("not found GaTaskProcessor by: %s, use:%s", sign, signType)
+		audit.Outcome = global.OutcomeRejected
+		err = fmt.Errorf("not found GaTaskProcessor by: %s, use:%s", sign, signType)
+		return nil, err
 	}
-	//开始执行命令
-	var resp []byte
-	for index := 0; index <= opt.ReplySize; index++ {
-		resp, err = gtp.operate(opt.Cmd)
+	audit.DeviceId = gtp.device.Id
+	cmd := opt.Cmd
+	var point *model.Point
+	if cmd.CmdType == global.WritePoint {
+		point, cmd, err = gtp.pointCmd(opt.Cmd)
 		if err != nil {
-			continue
+			audit.Outcome = global.OutcomeRejected
+			return nil, err
+		}
+		audit.FuncCode = cmd.FuncCode
+	}
+	//联锁，原始设置命令按功能码与地址范围换算为写入的点位
+	targets := []*model.Point{point}
+	resolved := true
+	if point == nil {
+		targets, err = gtp.rawTargets(cmd)
+		resolved = !errors.Is(err, UnresolvedWriteError)
+		if err != nil && resolved {
+			audit.Outcome = global.OutcomeRejected
+			return nil, err
 		}
-		return resp, nil
+	}
+	err = checkInterlocks(gtp.device.Id, pointTags(targets), resolved, opt, audit)
+	if err != nil {
+		audit.Outcome = global.OutcomeInterlock
+		return nil, err
+	}
+	//需要先选择的点位或已被选择的点位校验令牌，原始设置命令不能写入这些点位
+	if point != nil {
+		err = g.selector.authorize(gtp.device.Id, point, opt)
+	} else {
+		err = g.selector.guardRaw(gtp.device.Id, targets, resolved)
+	}
+	if err != nil {
+		audit.Outcome = global.OutcomeRejected
+		return nil, err
+	}
+	//开始执行命令，超过有效期后不再重试
+	deadline := time.Now().Add(global.DefaultTimeout)
+	if opt.ValidityPeriod > 0 {
+		deadline = time.UnixMilli(opt.ValidityPeriod)
+	}
+	for index := 0; index <= opt.ReplySize; index++ {
+		audit.Retries = index
+		resp, err = gtp.operate(cmd, deadline)
+		opt.Cmd.FlushFrame(cmd.Frame())
+		if err == nil {
+			audit.Outcome = global.OutcomeSuccess
+			return resp, nil
+		}
+		if errors.Is(err, ControlExpiredError) || errors.Is(err, ControlQueueFullError) {
+			break
+		}
+	}
+	audit.Outcome = global.OutcomeFailed
+	if errors.Is(err, ControlExpiredError) {
+		audit.Outcome = global.OutcomeExpired
 	}
 	return nil, err
 }
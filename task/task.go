@@ -3,14 +3,16 @@ package task
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"sentinels/catch"
 	"sentinels/command"
 	"sentinels/global"
 	"sentinels/model"
-	"sentinels/protocol"
 	"sentinels/snap"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -18,91 +20,206 @@ import (
 
 func NewGaTaskProcessor(device *model.Device) (*GaTaskProcessor, error) {
 	//创建空调度器
-	gtp := &GaTaskProcessor{}
-	//获取调度器创建连接器的方法
-	ctFunc, ok := catch.ConnectorBuilder[device.InterfaceType]
-	if !ok {
-		return nil, errors.New("connector not found for " + device.InterfaceType)
-	}
-	//创建连接器
-	gtp.Connector = ctFunc(device)
-	//获取编解码器
-	ptFunc, ok := protocol.ProtoBuilder[device.ProtocolType]
-	if !ok {
-		return nil, errors.New("protocol not found for " + device.ProtocolType)
-	}
-
+	gtp := &GaTaskProcessor{device: device, reconnect: newReconnector(), controls: newControlQueue(), pauser: newPauser(pauseKeyPrefix + device.Id)}
+	//创建各通道的连接器与编解码器
 	var err error
-	gtp.Codec, err = ptFunc(device.DeviceAddress)
+	gtp.channels, err = loadChannels(device)
 	if err != nil {
 		return nil, err
 	}
-	gtp.Connector.AddProtocolCodec(gtp.Codec.Copy())
+	gtp.useChannel(0)
 	//构建点位约束器
-	gtp.pb, err = buildBinder(device)
+	pb, err := buildBinder(device)
+	if err != nil {
+		return nil, err
+	}
+	gtp.pb.Store(pb)
+	gtp.sign, err = connectionSign(device)
 	if err != nil {
 		return nil, err
 	}
 	//创建日志组件
 	gtp.logger = global.CreateLog(device.Identifier())
-	gtp.Connector.AddLogger(gtp.logger)
+	for _, ch := range gtp.channels {
+		ch.Connector.AddLogger(gtp.logger)
+		ch.Connector.AddSwapCallback(gtp.swapWrapper(ch))
+	}
 	//添加各种回调
 	gtp.AddSuccessLinkedCallBack(devConnected)
 	gtp.AddFailLinkedCallBack(devDisConnected)
 	gtp.AddSwapCallback(devSwap)
 	gtp.AddCollectPointFailCallback(collectPointsFail)
+	gtp.transition(global.StateCreated, "processor created")
 	return gtp, nil
 }
 
 // GaTaskProcessor 采集控制调度器
 type GaTaskProcessor struct {
-	Connector catch.Connector        //连接器
-	Codec     protocol.ProtoConvener //编解码器
-	pb        *PointBinder           //点位集束器
+	device    *model.Device
+	channels  []*taskChannel              //所有通道，下标0为主通道
+	current   atomic.Pointer[taskChannel] //当前通道，切换时整体替换
+	lastProbe time.Time                   //上次探测主通道的时间，只由采集协程读写
+	probing   atomic.Bool                 //正在探测主通道
+	primaryOk atomic.Bool                 //主通道探测成功，等待切回
+	events    []*model.ChannelEvent
+	eventLock sync.Mutex
+	swap      catch.SwapCallback
+	lastSwap  atomic.Int64                //最后一次收到数据的时间
+	reconnect *reconnector                //重连状态
+	pauser    *pauser                     //暂停状态
+	pb        atomic.Pointer[PointBinder] //点位集束器，点位变化时整体替换
+	sign      string                      //连接参数的签名，变化时需要重建调度器
 	ctx       context.Context
 	cancel    context.CancelFunc
+	done      chan struct{} //serve退出时关闭
+	retired   atomic.Bool   //已被移除，不再接受控制
 	logger    *zap.SugaredLogger
+	lifecycle lifecycle     //生命周期状态
+	controls  *controlQueue //控制队列
 	lock      sync.Mutex
 }
 
-func (g *GaTaskProcessor) Start() error {
-	var err error
-	//自动重连
-	for {
-		err = g.Connector.Open()
-		if err != nil {
-			time.Sleep(time.Millisecond * 1000 * 5)
-			continue
-		}
-		break
+// 收到数据说明通道正常
+func (g *GaTaskProcessor) swapWrapper(ch *taskChannel) catch.SwapCallback {
+	return func(dev *model.Device, data map[string]interface{}, ts int64) {
+		g.received(ch, g.pb.Load().label(data), ts)
+	}
+}
+
+func (g *GaTaskProcessor) received(ch *taskChannel, data map[string]interface{}, ts int64) {
+	ch.unanswered.Store(0)
+	g.lastSwap.Store(ts)
+	if ch == g.channel() && !g.paused() {
+		g.healthy()
+	}
+	if g.swap != nil {
+		g.swap(g.device, data, ts)
 	}
+}
+
+// Start 启动采集，连接与重连在后台进行
+func (g *GaTaskProcessor) Start() error {
 	g.ctx, g.cancel = context.WithCancel(context.Background())
-	go func() {
-		err = g.run()
-		if err != nil {
-			_ = g.Stop()
-			go func() {
-				_ = g.Start()
-			}()
-		}
-	}()
+	g.done = make(chan struct{})
+	go g.serve(g.ctx)
 	return nil
 }
 
+// Stop 停止采集并断开连接，等待采集协程退出
 func (g *GaTaskProcessor) Stop() error {
-	err := g.Connector.Close()
-	g.cancel()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	err := g.channel().Connector.Close()
+	if g.done != nil {
+		<-g.done
+	}
+	g.reconnect.stopped()
+	g.transition(global.StateOffline, "stopped")
 	return err
 }
 
-func (g *GaTaskProcessor) run() error {
-	var err error
+// 连接并采集，断开后按重连策略重新连接
+func (g *GaTaskProcessor) serve(ctx context.Context) {
+	defer close(g.done)
+	defer g.controls.failAll(errors.New("processor stopped, device:" + g.device.Identifier()))
+	if !g.sleep(ctx, g.reconnect.startDelay()) {
+		return
+	}
+	reason := "start"
+	for {
+		g.transition(global.StateConnecting, reason)
+		if !g.connect(ctx) {
+			return
+		}
+		if g.channel().index != 0 {
+			g.transition(global.StateDegraded, "connected on backup channel")
+		} else {
+			g.transition(global.StateOnline, "connected")
+		}
+		err := g.run(ctx)
+		_ = g.channel().Connector.Close()
+		if err == nil {
+			return
+		}
+		delay := g.reconnect.disconnected(err)
+		g.logger.Warnf("collect stopped, reconnect after %s, err:%s", delay.Round(time.Millisecond), err.Error())
+		reason = "reconnect: " + err.Error()
+		g.transition(global.StateOffline, err.Error())
+		if !g.sleep(ctx, delay) {
+			return
+		}
+	}
+}
+
+// 打开连接器直到成功，ctx结束时返回false
+func (g *GaTaskProcessor) connect(ctx context.Context) bool {
+	for {
+		if ctx.Err() != nil {
+			return false
+		}
+		err := g.channel().Connector.Open()
+		if err == nil {
+			g.reconnect.connected()
+			return true
+		}
+		g.channelFailed(err)
+		g.transition(global.StateOffline, err.Error())
+		delay, tripped := g.reconnect.failed(err)
+		if tripped {
+			g.logger.Errorf("open failed %d times, device faulted, probe every %s, err:%s",
+				global.Config.BreakerThreshold, delay.Round(time.Second), err.Error())
+		} else {
+			g.logger.Debugf("open err:%s, retry after %s", err.Error(), delay.Round(time.Millisecond))
+		}
+		if !g.sleep(ctx, delay) {
+			return false
+		}
+	}
+}
+
+func (g *GaTaskProcessor) sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (g *GaTaskProcessor) run(ctx context.Context) error {
 	for {
 		select {
-		case <-g.ctx.Done():
+		case <-ctx.Done():
 			return nil
 		default:
-			err = g.collect(g.pb.Next())
+			//控制优先于采集
+			g.execControls()
+			if g.paused() {
+				//暂停时保持连接，断开后仍然重连
+				if !g.channel().Connector.IsLinked() {
+					return io.EOF
+				}
+				g.transition(global.StatePaused, "collect paused")
+				if !g.wait(ctx, global.IdleWait) {
+					return nil
+				}
+				continue
+			}
+			if g.State() == global.StatePaused {
+				g.healthy()
+			}
+			point, wait := g.pb.Load().Next(time.Now())
+			if point == nil {
+				//没有到期的组
+				if !g.wait(ctx, wait) {
+					return nil
+				}
+				continue
+			}
+			err := g.collect(point)
 			if err != nil && errors.Is(err, io.EOF) {
 				return err
 			}
@@ -110,56 +227,187 @@ func (g *GaTaskProcessor) run() error {
 	}
 }
 
+// 等待一段时间，有新的控制时立即返回
+func (g *GaTaskProcessor) wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-g.controls.signal:
+		return true
+	case <-timer.C:
+		return true
+	}
+}
+
 func (g *GaTaskProcessor) collect(point snap.PointSnap) error {
 	//剔除无用的点位
 	if point == nil {
 		return nil
 	}
+	//使用备用通道时探测主通道
+	g.probePrimary(point)
 	//判断连接是否正常
-	if !g.Connector.IsLinked() {
-		g.logger.Error("collector not linked, device:", g.Connector.ObtainDevice().Identifier())
+	ch := g.channel()
+	if !ch.Connector.IsLinked() {
+		g.logger.Error("collector not linked, device:", ch.Connector.ObtainDevice().Identifier())
 		return io.EOF
 	}
 	//根据点位组装报文
-	key, frame, err := g.Codec.BuildBySnap(point)
+	key, frame, err := ch.Codec.BuildBySnap(point)
 	if err != nil {
 		g.logger.Errorf("build by snap:\n%s \n err:%s", point.String(), err.Error())
 	}
+	if len(frame) > 0 {
+		//连续多次采集没有回复时切换通道，由serve打开新的通道
+		if fails := ch.unanswered.Load(); fails >= g.failover() {
+			if g.switchNext(fmt.Sprintf("%d consecutive polls without response", fails)) {
+				return io.EOF
+			}
+		}
+		if ch.unanswered.Add(1) > 2 {
+			g.transition(global.StateDegraded, "polls without response")
+		}
+	}
 	//发送报文
-	err = g.Connector.Collect(key, frame, point)
+	err = ch.Connector.Collect(key, frame, point)
 	if err != nil {
 		g.logger.Errorf("read by snap:\n%s \n err:%s", point.String(), err.Error())
+		realtime.invalidate(g.device.Id, snapTags(point)...)
+	}
+	//两次请求之间保持最小间隔，有控制时提前结束
+	if len(frame) > 0 && global.Config.CollectGap > 0 {
+		g.wait(g.ctx, time.Duration(global.Config.CollectGap)*time.Millisecond)
 	}
-	//暂停一段时间
-	time.Sleep(time.Millisecond * 200 * 5 * 2) //暂停
 	return nil
 }
 
 func (g *GaTaskProcessor) ObtainDevice() *model.Device {
-	return g.Connector.ObtainDevice()
+	return g.device
 }
 
 func (g *GaTaskProcessor) AddSuccessLinkedCallBack(call catch.SuccessLinked) {
-	g.Connector.AddSuccessLinkedCallBack(call)
+	for _, ch := range g.channels {
+		ch.Connector.AddSuccessLinkedCallBack(call)
+	}
 }
 
 func (g *GaTaskProcessor) AddFailLinkedCallBack(call catch.FailLinked) {
-	g.Connector.AddFailLinkedCallBack(call)
+	for _, ch := range g.channels {
+		ch.Connector.AddFailLinkedCallBack(call)
+	}
 }
 
 func (g *GaTaskProcessor) AddSwapCallback(callback catch.SwapCallback) {
-	g.Connector.AddSwapCallback(callback)
+	g.swap = callback
 }
 
 func (g *GaTaskProcessor) AddCollectPointFailCallback(cps catch.CollectPointsFailCallBack) {
-	g.Connector.AddCollectPointFailCallback(cps)
+	for _, ch := range g.channels {
+		ch.Connector.AddCollectPointFailCallback(cps)
+	}
+}
+
+// Monitor 设备的运行状态
+func (g *GaTaskProcessor) Monitor() *model.DeviceMonitor {
+	id, _ := strconv.Atoi(g.device.Id)
+	ch := g.channel()
+	dm := &model.DeviceMonitor{
+		ID:              id,
+		Name:            g.device.Name,
+		Code:            g.device.Code,
+		TotalPoints:     g.pb.Load().points,
+		Status:          "离线",
+		Channel:         ch.index,
+		ChannelAddress:  ch.device.Address,
+		Reconnect:       g.reconnect.snapshot(),
+		State:           g.State(),
+		PendingControls: g.controls.size(),
+	}
+	if pause := g.pauser.current(); pause.Paused {
+		dm.Pause = &pause
+	} else if pause = GTP.PauseState(); pause.Paused {
+		dm.Pause = &pause
+	}
+	if ch.Connector.IsLinked() {
+		dm.Status = "在线"
+		if dm.Pause != nil {
+			dm.Status = "暂停"
+		}
+	} else if dm.Reconnect.State == global.ReconnectFaulted {
+		dm.Status = "故障"
+	}
+	if ts := g.lastSwap.Load(); ts > 0 {
+		dm.LastCommunicationTime = time.UnixMilli(ts)
+	}
+	return dm
+}
+
+// Schedule 各采集组的调度情况
+func (g *GaTaskProcessor) Schedule() []*model.GroupSchedule {
+	return g.pb.Load().Schedule()
+}
+
+// 控制进入队列，由采集协程在下一次采集前下发，deadline前没有下发时返回错误
+func (g *GaTaskProcessor) operate(opt *command.OperateCmd, deadline time.Time) ([]byte, error) {
+	if g.retired.Load() {
+		return nil, errors.New("processor reloaded, device:" + g.device.Identifier())
+	}
+	if ch := g.channel(); !ch.Connector.IsLinked() {
+		return nil, errors.New("connector not linked, device:" + ch.Connector.ObtainDevice().Identifier())
+	}
+	r := g.submit(&controlRequest{cmd: opt, deadline: deadline, result: make(chan controlResult, 1)})
+	return r.resp, r.err
+}
+
+// 放入控制队列并等待结果，deadline前没有下发时返回过期错误
+func (g *GaTaskProcessor) submit(req *controlRequest) controlResult {
+	if !time.Now().Before(req.deadline) {
+		return controlResult{err: ControlExpiredError}
+	}
+	err := g.controls.push(req)
+	if err != nil {
+		return controlResult{err: err}
+	}
+	timer := time.NewTimer(time.Until(req.deadline))
+	defer timer.Stop()
+	select {
+	case r := <-req.result:
+		return r
+	case <-timer.C:
+		if g.controls.remove(req) {
+			return controlResult{err: ControlExpiredError}
+		}
+		//已经下发，等待结果
+		return <-req.result
+	}
+}
+
+// 下发队列中的所有控制
+func (g *GaTaskProcessor) execControls() {
+	for req := g.controls.pop(); req != nil; req = g.controls.pop() {
+		g.lock.Lock()
+		var result controlResult
+		if req.read != nil {
+			result = g.readSnap(req.read)
+		} else {
+			result.resp, result.err = g.channel().Connector.Operate(req.cmd)
+		}
+		g.lock.Unlock()
+		req.result <- result
+		g.controls.done()
+	}
 }
 
-func (g *GaTaskProcessor) operate(opt *command.OperateCmd) ([]byte, error) {
-	if !g.Connector.IsLinked() {
-		return nil, errors.New("connector not linked, device:" + g.Connector.ObtainDevice().Identifier())
+// 停止被移除的调度器，队列中与正在执行的控制完成后再断开连接
+// 连接已断开时队列中的控制不会再下发，直接返回错误，只等待正在执行的控制
+func (g *GaTaskProcessor) retire() {
+	g.retired.Store(true)
+	if !g.channel().Connector.IsLinked() {
+		g.controls.failAll(errors.New("connector not linked, device:" + g.device.Identifier()))
 	}
-	g.lock.Lock()
-	defer g.lock.Unlock()
-	return g.Connector.Operate(opt)
+	<-g.controls.drained()
+	_ = g.Stop()
+	g.transition(global.StateRemoved, "processor removed")
 }
@@ -0,0 +1,162 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/store"
+	"strconv"
+	"strings"
+)
+
+// valueMapper 解析后的值映射
+type valueMapper struct {
+	kind    string
+	enum    map[int64]string
+	flags   []flagEntry
+	fallout string
+}
+
+type flagEntry struct {
+	bit  uint
+	text string
+}
+
+// ValidateValueMap 校验值映射的配置
+func ValidateValueMap(m *model.ValueMap) error {
+	_, err := compileValueMap(m)
+	return err
+}
+
+func compileValueMap(m *model.ValueMap) (*valueMapper, error) {
+	if strings.TrimSpace(m.Name) == "" {
+		return nil, errors.New("value map name is empty")
+	}
+	if m.Kind != global.MapEnum && m.Kind != global.MapFlags {
+		return nil, fmt.Errorf("value map kind must be %s or %s", global.MapEnum, global.MapFlags)
+	}
+	vm := &valueMapper{kind: m.Kind, enum: make(map[int64]string), fallout: m.Default}
+	for _, item := range strings.Split(m.Entries, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, text, ok := strings.Cut(item, "=")
+		text = strings.TrimSpace(text)
+		n, err := strconv.ParseInt(strings.TrimSpace(key), 0, 64)
+		if !ok || err != nil || text == "" {
+			return nil, fmt.Errorf("value map entry %q must be value=text", item)
+		}
+		if m.Kind == global.MapEnum {
+			vm.enum[n] = text
+			continue
+		}
+		if n < 0 || n > 63 {
+			return nil, fmt.Errorf("value map entry %q: bit must be 0~63", item)
+		}
+		vm.flags = append(vm.flags, flagEntry{bit: uint(n), text: text})
+	}
+	if len(vm.enum) == 0 && len(vm.flags) == 0 {
+		return nil, errors.New("value map entries is empty")
+	}
+	return vm, nil
+}
+
+// 按映射转换，不是数值时返回nil
+func (vm *valueMapper) apply(value interface{}) *model.StateValue {
+	n, ok := numberOf(value)
+	if !ok {
+		return nil
+	}
+	sv := &model.StateValue{Value: value}
+	if vm.kind == global.MapEnum {
+		if text, found := vm.enum[int64(n)]; found && n == math.Trunc(n) {
+			sv.Text = text
+		} else if vm.fallout != "" {
+			sv.Text = vm.fallout
+		} else {
+			sv.Text = strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		return sv
+	}
+	bits := uint64(int64(n))
+	for _, flag := range vm.flags {
+		if bits&(1<<flag.bit) != 0 {
+			sv.Flags = append(sv.Flags, flag.text)
+		}
+	}
+	sv.Text = strings.Join(sv.Flags, ",")
+	return sv
+}
+
+// 设备点位使用的值映射，map[tag]，找不到或配置错误的映射只记录日志
+func loadValueMappers(device *model.Device, points []*model.Point) (map[string]*valueMapper, []*model.ValueMap) {
+	var used []*model.ValueMap
+	mappers := make(map[string]*valueMapper)
+	needed := false
+	for _, p := range points {
+		needed = needed || p.ValueMap != ""
+	}
+	if !needed {
+		return mappers, used
+	}
+	maps, err := store.DbClient.SelectValueMaps()
+	if err != nil {
+		global.SystemLog.Errorf("device %s load value maps err:%s", device.Identifier(), err.Error())
+		return mappers, used
+	}
+	byId := make(map[string]*model.ValueMap, len(maps))
+	for _, m := range maps {
+		byId[m.ID] = m
+	}
+	compiled := make(map[string]*valueMapper)
+	for _, p := range points {
+		if p.ValueMap == "" {
+			continue
+		}
+		m, ok := byId[p.ValueMap]
+		if !ok {
+			global.SystemLog.Warnf("device %s point %s value map %s not found", device.Identifier(), p.Tag, p.ValueMap)
+			continue
+		}
+		vm, ok := compiled[m.ID]
+		if !ok {
+			if vm, err = compileValueMap(m); err != nil {
+				global.SystemLog.Errorf("device %s value map %s invalid: %s", device.Identifier(), m.Name, err.Error())
+			}
+			compiled[m.ID] = vm
+			used = append(used, m)
+		}
+		if vm != nil {
+			mappers[p.Tag] = vm
+		}
+	}
+	return mappers, used
+}
+
+// 为配置了值映射的点位附加文字，返回新的map，不修改data
+func (b *PointBinder) label(data map[string]interface{}) map[string]interface{} {
+	if b == nil || len(b.mappers) == 0 {
+		return data
+	}
+	result := make(map[string]interface{}, len(data))
+	for tag, value := range data {
+		result[tag] = value
+		if vm, ok := b.mappers[tag]; ok {
+			if sv := vm.apply(value); sv != nil {
+				result[tag] = sv
+			}
+		}
+	}
+	return result
+}
+
+// 采集数据中的值转为实时值，展开值映射
+func pointValue(tag string, value interface{}, ts int64) *model.PointValue {
+	pv := &model.PointValue{Tag: tag, Value: value, Ts: ts, Quality: global.QualityGood}
+	if sv, ok := value.(*model.StateValue); ok {
+		pv.Value, pv.Text, pv.Flags = sv.Value, sv.Text, sv.Flags
+	}
+	return pv
+}
@@ -0,0 +1,77 @@
+package task
+
+import (
+	"reflect"
+	"sentinels/global"
+	"sentinels/model"
+	"testing"
+)
+
+func TestCompileValueMapInvalid(t *testing.T) {
+	for _, m := range []*model.ValueMap{
+		{Name: "", Kind: global.MapEnum, Entries: "0=Off"},
+		{Name: "m", Kind: "other", Entries: "0=Off"},
+		{Name: "m", Kind: global.MapEnum, Entries: ""},
+		{Name: "m", Kind: global.MapEnum, Entries: " , "},
+		{Name: "m", Kind: global.MapEnum, Entries: "0"},
+		{Name: "m", Kind: global.MapEnum, Entries: "x=Off"},
+		{Name: "m", Kind: global.MapEnum, Entries: "0= "},
+		{Name: "m", Kind: global.MapFlags, Entries: "64=High"},
+		{Name: "m", Kind: global.MapFlags, Entries: "-1=Low"},
+	} {
+		if _, err := compileValueMap(m); err == nil {
+			t.Errorf("%+v: expected error", m)
+		}
+	}
+}
+
+func TestValueMapEnum(t *testing.T) {
+	vm, err := compileValueMap(&model.ValueMap{Name: "state", Kind: global.MapEnum, Entries: "0=Stopped, 1=Running,0x10=Fault"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		value interface{}
+		text  string
+	}{
+		{0.0, "Stopped"},
+		{int64(1), "Running"},
+		{16.0, "Fault"},
+		//没有对应的值且没有默认文字时为数值本身
+		{2.0, "2"},
+		{1.5, "1.5"},
+	}
+	for _, c := range cases {
+		sv := vm.apply(c.value)
+		if sv == nil || sv.Text != c.text || sv.Value != c.value {
+			t.Errorf("%v: got %+v, want %q", c.value, sv, c.text)
+		}
+	}
+	if sv := vm.apply("text"); sv != nil {
+		t.Errorf("non-number: got %+v", sv)
+	}
+	vm, err = compileValueMap(&model.ValueMap{Name: "state", Kind: global.MapEnum, Entries: "0=Stopped", Default: "Unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sv := vm.apply(3.0); sv.Text != "Unknown" {
+		t.Errorf("default: got %q", sv.Text)
+	}
+}
+
+func TestValueMapFlags(t *testing.T) {
+	vm, err := compileValueMap(&model.ValueMap{Name: "bits", Kind: global.MapFlags, Entries: "0=Alarm,3=Remote,63=Top"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := vm.apply(9.0)
+	if !reflect.DeepEqual(sv.Flags, []string{"Alarm", "Remote"}) || sv.Text != "Alarm,Remote" {
+		t.Errorf("got %+v", sv)
+	}
+	if sv = vm.apply(int64(-1 << 63)); !reflect.DeepEqual(sv.Flags, []string{"Top"}) {
+		t.Errorf("bit 63: got %+v", sv)
+	}
+	if sv = vm.apply(0.0); sv.Flags != nil || sv.Text != "" {
+		t.Errorf("no bits: got %+v", sv)
+	}
+}
@@ -0,0 +1,288 @@
+package task
+
+import (
+	"errors"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sentinels/store"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	virtualDebounce = 50 * time.Millisecond //输入变化后等待一段时间，合并多个输入的变化
+	virtualIdle     = time.Minute           //没有定时计算的点位时的等待时间
+)
+
+// virtualEngine 虚拟设备的点位，输入的值或质量变化时重新计算，配置了interval的点位同时定时计算
+type virtualEngine struct {
+	lock    sync.Mutex
+	devices map[string]*virtualDevice         //map[设备id]
+	inputs  map[string]map[*virtualPoint]bool //map[设备id/tag]，使用该输入的点位
+	dirty   map[*virtualPoint]bool            //等待计算的点位
+	wake    chan struct{}
+	stale   time.Duration //输入超过该时间没有更新时按bad处理，0为不检查
+}
+
+type virtualDevice struct {
+	device *model.Device
+	points []*virtualPoint
+	pb     *PointBinder //只使用值映射
+	sign   string
+}
+
+type virtualPoint struct {
+	dev    *virtualDevice
+	point  *model.Point
+	inputs map[string]bool //上一次计算读取的输入
+	next   time.Time       //下一次定时计算的时间
+	expire time.Time       //最早的输入超过virtualStale的时间，到期后重新计算，为零时不需要
+}
+
+func newVirtualEngine(stale time.Duration) *virtualEngine {
+	return &virtualEngine{
+		devices: make(map[string]*virtualDevice),
+		inputs:  make(map[string]map[*virtualPoint]bool),
+		dirty:   make(map[*virtualPoint]bool),
+		wake:    make(chan struct{}, 1),
+		stale:   stale,
+	}
+}
+
+func inputKey(id, tag string) string {
+	return id + "/" + tag
+}
+
+// 加载或更新虚拟设备，点位没有变化时不处理，加载后立即计算所有点位
+func (e *virtualEngine) load(device *model.Device) error {
+	points := store.DbClient.SelectPointsByDeviceId(device.Id)
+	for _, p := range points {
+		if strings.TrimSpace(p.LuaExpression) == "" {
+			return errors.New("virtual point " + p.Tag + " has no lua expression")
+		}
+	}
+	mappers, maps := loadValueMappers(device, points)
+	dev := &virtualDevice{device: device, pb: &PointBinder{mappers: mappers}, sign: sign(device, points, maps)}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if old, ok := e.devices[device.Id]; ok {
+		if old.sign == dev.sign {
+			return nil
+		}
+		e.drop(old)
+	}
+	for _, p := range points {
+		vp := &virtualPoint{dev: dev, point: p}
+		dev.points = append(dev.points, vp)
+		e.dirty[vp] = true
+	}
+	e.devices[device.Id] = dev
+	e.signal()
+	global.SystemLog.Infof("virtual device %s loaded, points:%d", device.Identifier(), len(points))
+	return nil
+}
+
+// 移除虚拟设备，返回是否存在
+func (e *virtualEngine) stop(id string) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	dev, ok := e.devices[id]
+	if !ok {
+		return false
+	}
+	e.drop(dev)
+	delete(e.devices, id)
+	global.SystemLog.Infof("virtual device %s stopped", dev.device.Identifier())
+	return true
+}
+
+func (e *virtualEngine) drop(dev *virtualDevice) {
+	for _, vp := range dev.points {
+		e.index(vp, nil)
+		delete(e.dirty, vp)
+	}
+}
+
+func (e *virtualEngine) ids() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	ids := make([]string, 0, len(e.devices))
+	for id := range e.devices {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// 更新输入与点位的对应关系，需要持有锁
+func (e *virtualEngine) index(vp *virtualPoint, inputs map[string]bool) {
+	for key := range vp.inputs {
+		if !inputs[key] {
+			delete(e.inputs[key], vp)
+			if len(e.inputs[key]) == 0 {
+				delete(e.inputs, key)
+			}
+		}
+	}
+	for key := range inputs {
+		if e.inputs[key] == nil {
+			e.inputs[key] = make(map[*virtualPoint]bool)
+		}
+		e.inputs[key][vp] = true
+	}
+	vp.inputs = inputs
+}
+
+// 实时值变化时由realtimeCache调用
+func (e *virtualEngine) changed(id string, tags []string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	marked := false
+	for _, tag := range tags {
+		for vp := range e.inputs[inputKey(id, tag)] {
+			e.dirty[vp] = true
+			marked = true
+		}
+	}
+	if marked {
+		e.signal()
+	}
+}
+
+func (e *virtualEngine) signal() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *virtualEngine) run() {
+	for {
+		timer := time.NewTimer(e.nextWait(time.Now()))
+		select {
+		case <-e.wake:
+			time.Sleep(virtualDebounce)
+		case <-timer.C:
+		}
+		timer.Stop()
+		e.compute(time.Now())
+	}
+}
+
+// 距离下一次定时计算的时间
+func (e *virtualEngine) nextWait(now time.Time) time.Duration {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	wait := virtualIdle
+	for _, dev := range e.devices {
+		for _, vp := range dev.points {
+			if vp.point.Interval > 0 {
+				wait = min(wait, max(vp.next.Sub(now), 0))
+			}
+			if !vp.expire.IsZero() {
+				wait = min(wait, max(vp.expire.Sub(now), 0))
+			}
+		}
+	}
+	return wait
+}
+
+// 计算输入变化、定时到期与输入即将失效的点位，正常的结果按设备通过devSwap发出，输入失效或计算出错的点位标记为采集失败
+func (e *virtualEngine) compute(now time.Time) {
+	e.lock.Lock()
+	due := e.dirty
+	e.dirty = make(map[*virtualPoint]bool)
+	for _, dev := range e.devices {
+		for _, vp := range dev.points {
+			if vp.point.Interval > 0 && !now.Before(vp.next) {
+				due[vp] = true
+			}
+			if !vp.expire.IsZero() && !now.Before(vp.expire) {
+				due[vp] = true
+			}
+		}
+	}
+	for vp := range due {
+		if vp.point.Interval > 0 {
+			vp.next = now.Add(time.Duration(vp.point.Interval) * time.Millisecond)
+		}
+	}
+	e.lock.Unlock()
+	if len(due) == 0 {
+		return
+	}
+	results := make(map[*virtualDevice]map[string]interface{})
+	failed := make(map[*virtualDevice][]string)
+	inputs := make(map[*virtualPoint]map[string]bool, len(due))
+	expires := make(map[*virtualPoint]time.Time, len(due))
+	for vp := range due {
+		value, used, expire, good := vp.eval(now, e.stale)
+		inputs[vp] = used
+		expires[vp] = expire
+		if !good {
+			failed[vp.dev] = append(failed[vp.dev], vp.point.Tag)
+			continue
+		}
+		if results[vp.dev] == nil {
+			results[vp.dev] = make(map[string]interface{})
+		}
+		results[vp.dev][vp.point.Tag] = value
+	}
+	e.lock.Lock()
+	live := make(map[*virtualDevice]bool, len(e.devices))
+	for _, dev := range e.devices {
+		live[dev] = true
+	}
+	for vp, used := range inputs {
+		if live[vp.dev] {
+			e.index(vp, used)
+			vp.expire = expires[vp]
+		}
+	}
+	e.lock.Unlock()
+	//在锁外发出，其他虚拟点位会收到变化
+	ts := now.UnixMilli()
+	for dev, tags := range failed {
+		if live[dev] {
+			sort.Strings(tags)
+			realtime.invalidate(dev.device.Id, tags...)
+		}
+	}
+	for dev, data := range results {
+		if live[dev] {
+			devSwap(dev.device, dev.pb.label(data), ts)
+		}
+	}
+}
+
+// 计算点位，返回结果、读取的输入、最早的正常输入失效的时间与是否正常
+// 任意一个输入没有值、质量为bad或超过stale没有更新时结果不正常
+func (vp *virtualPoint) eval(now time.Time, stale time.Duration) (float64, map[string]bool, time.Time, bool) {
+	used := make(map[string]bool)
+	good := true
+	var expire time.Time
+	value, err := snap.EvalVirtual(vp.point, func(id, tag string) (interface{}, string, bool) {
+		used[inputKey(id, tag)] = true
+		values := realtime.get(id, tag)
+		if len(values) == 0 {
+			good = false
+			return nil, "", false
+		}
+		pv := values[0]
+		if stale > 0 {
+			deadline := time.UnixMilli(pv.Ts).Add(stale)
+			if !now.Before(deadline) {
+				pv.Quality = global.QualityBad
+			} else if expire.IsZero() || deadline.Before(expire) {
+				expire = deadline
+			}
+		}
+		if pv.Quality != global.QualityGood {
+			good = false
+		}
+		return pv.Value, pv.Quality, true
+	})
+	return value, used, expire, good && err == nil
+}
@@ -0,0 +1,57 @@
+package task
+
+import (
+	"sentinels/model"
+	"testing"
+	"time"
+)
+
+// 读取设备id的A、B两个输入求和的虚拟点位，没有值的输入按0计算，表达式不会出错
+func testVirtualPoint(id string) *virtualPoint {
+	expression := `(value("` + id + `", "A") or 0) + (value("` + id + `", "B") or 0)`
+	return &virtualPoint{point: &model.Point{ID: "vp-" + id, Tag: "SUM", LuaExpression: expression}}
+}
+
+func TestVirtualEval(t *testing.T) {
+	id := "test-" + newToken()
+	vp := testVirtualPoint(id)
+	now := time.Now().Truncate(time.Millisecond)
+	stale := 3 * time.Second
+	realtime.update(id, map[string]interface{}{"A": 1.0}, now.Add(-2*time.Second).UnixMilli())
+	realtime.update(id, map[string]interface{}{"B": 2.0}, now.Add(-time.Second).UnixMilli())
+
+	value, used, expire, good := vp.eval(now, stale)
+	if !good || value != 3 || !used[inputKey(id, "A")] || !used[inputKey(id, "B")] {
+		t.Fatalf("got %v %v %v", value, used, good)
+	}
+	//最早失效的输入为A
+	if want := now.Add(time.Second); !expire.Equal(want) {
+		t.Errorf("expire: got %v, want %v", expire, want)
+	}
+	//A超过stale没有更新
+	if _, _, expire, good = vp.eval(now.Add(time.Second), stale); good {
+		t.Error("stale input should make the result bad")
+	} else if want := now.Add(2 * time.Second); !expire.Equal(want) {
+		t.Errorf("expire after A is stale: got %v, want %v", expire, want)
+	}
+	//stale为0时不检查
+	if _, _, expire, good = vp.eval(now.Add(time.Hour), 0); !good || !expire.IsZero() {
+		t.Errorf("no stale check: got good %v expire %v", good, expire)
+	}
+	//输入质量为bad
+	realtime.invalidate(id, "B")
+	if _, _, _, good = vp.eval(now, stale); good {
+		t.Error("bad quality input should make the result bad")
+	}
+}
+
+func TestVirtualEvalMissing(t *testing.T) {
+	id := "test-" + newToken()
+	vp := testVirtualPoint(id)
+	now := time.Now()
+	realtime.update(id, map[string]interface{}{"A": 1.0}, now.UnixMilli())
+	value, used, _, good := vp.eval(now, time.Second)
+	if good || value != 1 || !used[inputKey(id, "B")] {
+		t.Errorf("missing input: got %v %v %v", value, used, good)
+	}
+}
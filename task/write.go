@@ -0,0 +1,103 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sentinels/command"
+	"sentinels/global"
+	"sentinels/model"
+	"sentinels/snap"
+	"sentinels/store"
+	"strconv"
+	"strings"
+)
+
+// UnresolvedWriteError 无法确定写入哪些点位的命令，例如透传与非modbus规约的设置命令
+var UnresolvedWriteError = errors.New("write target cannot be resolved to points")
+
+// 把按点位写入的命令换算为协议的设置命令
+func (g *GaTaskProcessor) pointCmd(cmd *command.OperateCmd) (*model.Point, *command.OperateCmd, error) {
+	tag, value, err := cmd.WritePointItems()
+	if err != nil {
+		return nil, nil, err
+	}
+	point, result, err := g.writeCmd(tag, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Timeout = cmd.Timeout
+	return point, result, nil
+}
+
+// 查询点位并把工程值编码为协议的设置命令
+func (g *GaTaskProcessor) writeCmd(tag string, value float64) (*model.Point, *command.OperateCmd, error) {
+	point, err := store.DbClient.SelectPointByTag(g.device.Id, tag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("point %s not found in device %s: %w", tag, g.device.Id, err)
+	}
+	switch g.device.ProtocolType {
+	case global.ModbusTCP, global.ModbusRTU:
+		fc, address, registers, ee := snap.EncodeModbusWrite(point, value)
+		if ee != nil {
+			return nil, nil, ee
+		}
+		return point, command.NewModbusSetCmd(fc, address, registers...), nil
+	default:
+		return nil, nil, fmt.Errorf("write point is not supported by protocol %s", g.device.ProtocolType)
+	}
+}
+
+// 原始设置命令写入的点位，按功能码与地址范围匹配，线圈写入匹配01功能码的点位，寄存器写入匹配03功能码的点位
+func (g *GaTaskProcessor) rawTargets(cmd *command.OperateCmd) ([]*model.Point, error) {
+	if cmd.CmdType == global.CopyRead {
+		return nil, nil
+	}
+	if cmd.CmdType != global.SetCmd || (g.device.ProtocolType != global.ModbusTCP && g.device.ProtocolType != global.ModbusRTU) {
+		return nil, UnresolvedWriteError
+	}
+	fc, err := strconv.ParseUint(strings.TrimSpace(cmd.FuncCode), 0, 8)
+	if err != nil {
+		return nil, fmt.Errorf("func code error: %w", err)
+	}
+	start, err := cmd.ModbusStartAddress()
+	if err != nil {
+		return nil, err
+	}
+	var pointFc byte
+	count := 1
+	switch byte(fc) {
+	case 0x05:
+		pointFc = 0x01
+	case 0x06:
+		pointFc = 0x03
+	case 0x0F:
+		pointFc = 0x01
+		bits, ee := cmd.ModbusBits()
+		if ee != nil {
+			return nil, ee
+		}
+		count = len(bits)
+	case 0x10:
+		pointFc = 0x03
+		length, ee := cmd.ModbusLength()
+		if ee != nil {
+			return nil, ee
+		}
+		count = int(length)
+	default:
+		return nil, UnresolvedWriteError
+	}
+	end := int(start) + count
+	var targets []*model.Point
+	for _, p := range store.DbClient.SelectPointsByDeviceId(g.device.Id) {
+		pfc, fe := strconv.ParseUint(strings.TrimSpace(p.FunctionCode), 0, 8)
+		address, ae := strconv.ParseUint(strings.TrimSpace(p.Address), 0, 16)
+		if fe != nil || ae != nil || byte(pfc) != pointFc {
+			continue
+		}
+		if int(address) < end && int(address)+int(snap.RegisterWidth(pointFc, p)) > int(start) {
+			targets = append(targets, p)
+		}
+	}
+	return targets, nil
+}